@@ -0,0 +1,28 @@
+package auth
+
+import "slices"
+
+// APIKeyPrefix starts all API keys, so they are told apart from JWTs and found by secret scanners.
+const APIKeyPrefix = "dwf_"
+
+// The scopes of access tokens and API keys. The tokens of logins get all scopes, API keys the scopes chosen on
+// creation.
+const (
+	ScopeFormsRead        = "forms:read"
+	ScopeFormsWrite       = "forms:write"
+	ScopeSubmissionsRead  = "submissions:read"
+	ScopeSubmissionsWrite = "submissions:write"
+)
+
+var Scopes = []string{ScopeFormsRead, ScopeFormsWrite, ScopeSubmissionsRead, ScopeSubmissionsWrite}
+
+// HasScopes reports whether granted contains all required scopes.
+func HasScopes(granted []string, required ...string) bool {
+	for _, scope := range required {
+		if !slices.Contains(granted, scope) {
+			return false
+		}
+	}
+
+	return true
+}
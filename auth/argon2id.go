@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"strconv"
+	"strings"
+)
+
+const argon2idID = "argon2id"
+
+// Argon2idParams are the cost parameters of Argon2id, Memory is given in KiB.
+type Argon2idParams struct {
+	Memory      uint32 `json:"memory" validate:"min=8192"`
+	Iterations  uint32 `json:"iterations" validate:"min=1"`
+	Parallelism uint8  `json:"parallelism" validate:"min=1"`
+}
+
+// DefaultArgon2idParams are the minimum parameters recommended by OWASP.
+var DefaultArgon2idParams = Argon2idParams{Memory: 19 * 1024, Iterations: 2, Parallelism: 1}
+
+const (
+	argon2idSaltLength = 16
+	argon2idKeyLength  = 32
+)
+
+// Argon2idHasher hashes passwords with Argon2id. With a pepper the password is keyed with HMAC-SHA256 before
+// hashing, the ID of the pepper is stored in the keyid parameter of the hash, so peppers can be rotated.
+type Argon2idHasher struct {
+	params   Argon2idParams
+	pepperID string
+	peppers  map[string][]byte
+}
+
+var _ Hasher = (*Argon2idHasher)(nil)
+
+type Argon2idHasherOption func(*Argon2idHasher) error
+
+// WithPeppers sets the peppers of the hasher by ID. New hashes use the pepper currentID, the others are used to
+// verify hashes created before the pepper was rotated.
+func WithPeppers(currentID string, peppers map[string][]byte) Argon2idHasherOption {
+	return func(h *Argon2idHasher) error {
+		if pepper, ok := peppers[currentID]; !ok || len(pepper) == 0 {
+			return fmt.Errorf("missing pepper %q", currentID)
+		}
+
+		for id := range peppers {
+			if id == "" || strings.ContainsAny(id, "$,=") {
+				return fmt.Errorf("invalid pepper id %q", id)
+			}
+		}
+
+		h.pepperID = currentID
+		h.peppers = peppers
+		return nil
+	}
+}
+
+func NewArgon2idHasher(params Argon2idParams, options ...Argon2idHasherOption) (*Argon2idHasher, error) {
+	if params.Memory < 8*uint32(params.Parallelism) || params.Iterations < 1 || params.Parallelism < 1 {
+		return nil, errors.New("invalid argon2id parameters")
+	}
+
+	hasher := Argon2idHasher{params: params}
+	for _, option := range options {
+		if err := option(&hasher); err != nil {
+			return nil, err
+		}
+	}
+
+	return &hasher, nil
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2idSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key, err := h.key(h.params, h.pepperID, salt, password)
+	if err != nil {
+		return "", err
+	}
+
+	hash := argon2idHash{params: h.params, keyID: h.pepperID, salt: salt, key: key}
+	return hash.String(), nil
+}
+
+func (h *Argon2idHasher) Verify(hash string, password string) error {
+	parsed, err := parseArgon2idHash(hash)
+	if err != nil {
+		return err
+	}
+
+	key, err := h.key(parsed.params, parsed.keyID, parsed.salt, password)
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare(key, parsed.key) != 1 {
+		return ErrMismatchedPassword
+	}
+	return nil
+}
+
+func (h *Argon2idHasher) Supports(id string) bool {
+	return id == argon2idID
+}
+
+func (h *Argon2idHasher) NeedsRehash(hash string) bool {
+	parsed, err := parseArgon2idHash(hash)
+	return err != nil || parsed.params != h.params || parsed.keyID != h.pepperID ||
+		len(parsed.key) != argon2idKeyLength
+}
+
+func (h *Argon2idHasher) key(params Argon2idParams, keyID string, salt []byte, password string) ([]byte, error) {
+	input := []byte(password)
+	if keyID != "" {
+		pepper, ok := h.peppers[keyID]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown pepper %q", ErrUnsupportedHash, keyID)
+		}
+
+		mac := hmac.New(sha256.New, pepper)
+		mac.Write(input)
+		input = mac.Sum(nil)
+	}
+
+	return argon2.IDKey(input, salt, params.Iterations, params.Memory, params.Parallelism, argon2idKeyLength), nil
+}
+
+// argon2idHash is a hash in the PHC format $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>[,keyid=<id>]
+// $<salt>$<key> with salt and key encoded in base64 without padding.
+type argon2idHash struct {
+	params Argon2idParams
+	keyID  string
+	salt   []byte
+	key    []byte
+}
+
+func (a argon2idHash) String() string {
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", a.params.Memory, a.params.Iterations, a.params.Parallelism)
+	if a.keyID != "" {
+		params += ",keyid=" + a.keyID
+	}
+
+	return fmt.Sprintf("$%s$v=%d$%s$%s$%s", argon2idID, argon2.Version, params,
+		base64.RawStdEncoding.EncodeToString(a.salt), base64.RawStdEncoding.EncodeToString(a.key))
+}
+
+func parseArgon2idHash(hash string) (argon2idHash, error) {
+	var parsed argon2idHash
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != argon2idID {
+		return parsed, ErrUnsupportedHash
+	}
+
+	if parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return parsed, fmt.Errorf("%w: argon2 version %s", ErrUnsupportedHash, parts[2])
+	}
+
+	for _, param := range strings.Split(parts[3], ",") {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return parsed, ErrUnsupportedHash
+		}
+
+		var number uint64
+		var err error
+		switch name {
+		case "m":
+			number, err = strconv.ParseUint(value, 10, 32)
+			parsed.params.Memory = uint32(number)
+		case "t":
+			number, err = strconv.ParseUint(value, 10, 32)
+			parsed.params.Iterations = uint32(number)
+		case "p":
+			number, err = strconv.ParseUint(value, 10, 8)
+			parsed.params.Parallelism = uint8(number)
+		case "keyid":
+			parsed.keyID = value
+		default:
+			err = fmt.Errorf("unknown parameter %s", name)
+		}
+		if err != nil {
+			return parsed, fmt.Errorf("%w: %w", ErrUnsupportedHash, err)
+		}
+	}
+
+	if parsed.params.Memory == 0 || parsed.params.Iterations == 0 || parsed.params.Parallelism == 0 {
+		return parsed, ErrUnsupportedHash
+	}
+
+	var err error
+	if parsed.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return parsed, fmt.Errorf("%w: %w", ErrUnsupportedHash, err)
+	}
+	if parsed.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(parsed.key) == 0 {
+		return parsed, ErrUnsupportedHash
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultBcryptCost is the cost the bcrypt hashes of existing users were created with.
+const DefaultBcryptCost = bcrypt.DefaultCost
+
+// BcryptHasher hashes passwords with bcrypt, which only uses the first 72 bytes of a password. It is kept to
+// verify hashes created before Argon2id became the default.
+type BcryptHasher struct {
+	cost int
+}
+
+var _ Hasher = (*BcryptHasher)(nil)
+
+func NewBcryptHasher(cost int) (*BcryptHasher, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, errors.New("invalid cost")
+	}
+
+	return &BcryptHasher{cost: cost}, nil
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	return string(bytes), err
+}
+
+func (h *BcryptHasher) Verify(hash string, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) || errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return ErrMismatchedPassword
+	}
+	return err
+}
+
+func (h *BcryptHasher) Supports(id string) bool {
+	return id == "2a" || id == "2b" || id == "2y"
+}
+
+func (h *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.cost
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BreachedPasswordDirectory looks up passwords in a local copy of a breached password list, split like the range
+// API of Pwned Passwords: each file is named after the first five hex characters of the SHA-1 hashes it contains,
+// e.g. 5BAA6.txt, and lists the remaining 35 characters of one hash per line, optionally followed by :<count>.
+// A lookup only reads the file of its prefix, so the list never has to be loaded into memory.
+type BreachedPasswordDirectory struct {
+	dir string
+}
+
+func NewBreachedPasswordDirectory(dir string) (*BreachedPasswordDirectory, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error opening breached password directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breached password directory %s is not a directory", dir)
+	}
+
+	return &BreachedPasswordDirectory{dir: dir}, nil
+}
+
+func (b *BreachedPasswordDirectory) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(b.dir, prefix+".txt"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), ":")
+		if strings.EqualFold(strings.TrimSpace(line), suffix) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
@@ -11,6 +11,7 @@ import (
 
 type JWTService struct {
 	issuer            string
+	audience          string
 	signingMethod     jwt.SigningMethod
 	signingMethodAlg  []string
 	expiryTimeMinutes int
@@ -20,13 +21,33 @@ type JWTService struct {
 
 type JWTClaims struct {
 	jwt.RegisteredClaims
+	// Purpose is only set for tokens which are not access tokens, e.g. the challenge of a two-step login.
+	Purpose string `json:"purpose,omitempty"`
+	TokenGrants
 }
 
+// TokenGrants are the permissions carried by an access token, Scopes restrict the routes the token is accepted at.
+type TokenGrants struct {
+	Roles  []string `json:"roles,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
+	Tenant string   `json:"tenant,omitempty"`
+}
+
+const (
+	purposeTwoFactorChallenge = "2fa_challenge"
+	challengeExpiry           = 5 * time.Minute
+)
+
+var ErrTokenPurpose = errors.New("token issued for another purpose")
+
 type JWTServiceOption func(*JWTService) error
 
+// NewJWTService creates the service issuing and validating tokens. Without WithSigningKey the tokens are signed with
+// a random key, so only the same service accepts them.
 func NewJWTService(options ...JWTServiceOption) (*JWTService, error) {
 	service := JWTService{
 		issuer:            "dynamic-webforms",
+		audience:          "dynamic-webforms",
 		signingMethod:     jwt.SigningMethodHS512,
 		signingMethodAlg:  []string{jwt.SigningMethodHS512.Alg()},
 		expiryTimeMinutes: 30,
@@ -47,8 +68,8 @@ func NewJWTService(options ...JWTServiceOption) (*JWTService, error) {
 		}
 	}
 
-	service.parser = jwt.NewParser(jwt.WithIssuer(service.issuer), jwt.WithExpirationRequired(), jwt.WithIssuedAt(),
-		jwt.WithValidMethods(service.signingMethodAlg))
+	service.parser = jwt.NewParser(jwt.WithIssuer(service.issuer), jwt.WithAudience(service.audience),
+		jwt.WithExpirationRequired(), jwt.WithIssuedAt(), jwt.WithValidMethods(service.signingMethodAlg))
 
 	return &service, nil
 }
@@ -60,6 +81,20 @@ func WithIssuer(issuer string) JWTServiceOption {
 	}
 }
 
+// WithAudience sets the audience of the issued tokens, only tokens for the audience are accepted. Servers of
+// different clients sharing the key of WithSigningKey use different audiences, so tokens issued for one of them are
+// rejected by the others.
+func WithAudience(audience string) JWTServiceOption {
+	return func(s *JWTService) error {
+		if audience == "" {
+			return errors.New("audience must not be empty")
+		}
+
+		s.audience = audience
+		return nil
+	}
+}
+
 func WithExpiryTimeMinutes(expiryTimeMinutes int) JWTServiceOption {
 	return func(s *JWTService) error {
 		if expiryTimeMinutes <= 0 {
@@ -93,28 +128,56 @@ func WithSigningKey(signingKey []byte) JWTServiceOption {
 	}
 }
 
-func (j *JWTService) NewToken(userID uuid.UUID) (string, error) {
-	currentTime := time.Now().UTC()
+// NewToken returns an access token with the ID tokenID, e.g. the ID of the session of a login.
+func (j *JWTService) NewToken(userID uuid.UUID, tokenID uuid.UUID, grants TokenGrants) (string, error) {
+	return j.newToken(userID, tokenID, "", grants, j.Expiry())
+}
+
+// Expiry returns how long access tokens are valid.
+func (j *JWTService) Expiry() time.Duration {
+	return time.Minute * time.Duration(j.expiryTimeMinutes)
+}
 
+// NewChallengeToken returns a short-lived token proving the password of a user, which is exchanged together with
+// the second factor for an access token.
+func (j *JWTService) NewChallengeToken(userID uuid.UUID) (string, error) {
 	randomID, err := uuid.NewRandom()
 	if err != nil {
 		return "", fmt.Errorf("failed to generate random ID: %w", err)
 	}
 
+	return j.newToken(userID, randomID, purposeTwoFactorChallenge, TokenGrants{}, challengeExpiry)
+}
+
+func (j *JWTService) newToken(userID uuid.UUID, tokenID uuid.UUID, purpose string, grants TokenGrants, expiry time.Duration) (string, error) {
+	currentTime := time.Now().UTC()
+
 	claims := JWTClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    j.issuer,
 			Subject:   userID.String(),
-			ExpiresAt: jwt.NewNumericDate(currentTime.Add(time.Minute * time.Duration(j.expiryTimeMinutes))),
+			Audience:  jwt.ClaimStrings{j.audience},
+			ExpiresAt: jwt.NewNumericDate(currentTime.Add(expiry)),
 			IssuedAt:  jwt.NewNumericDate(currentTime),
-			ID:        randomID.String(),
+			ID:        tokenID.String(),
 		},
+		Purpose:     purpose,
+		TokenGrants: grants,
 	}
 
 	return jwt.NewWithClaims(j.signingMethod, claims).SignedString(j.signingKey)
 }
 
+// ValidateToken validates an access token.
 func (j *JWTService) ValidateToken(tokenString string) (JWTClaims, error) {
+	return j.validateToken(tokenString, "")
+}
+
+func (j *JWTService) ValidateChallengeToken(tokenString string) (JWTClaims, error) {
+	return j.validateToken(tokenString, purposeTwoFactorChallenge)
+}
+
+func (j *JWTService) validateToken(tokenString string, purpose string) (JWTClaims, error) {
 	claims := &JWTClaims{}
 	_, err := j.parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		return j.signingKey, nil
@@ -124,5 +187,9 @@ func (j *JWTService) ValidateToken(tokenString string) (JWTClaims, error) {
 		return JWTClaims{}, err
 	}
 
+	if claims.Purpose != purpose {
+		return JWTClaims{}, ErrTokenPurpose
+	}
+
 	return *claims, nil
 }
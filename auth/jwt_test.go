@@ -24,11 +24,11 @@ func TestNewJWTService(t *testing.T) {
 func TestJWTService_NewToken(t *testing.T) {
 	service, _ := NewJWTService()
 	userID, _ := uuid.NewUUID()
-	token, err := service.NewToken(userID)
+	token, err := service.NewToken(userID, uuid.New(), TokenGrants{})
 	assert.NoError(t, err)
 	assert.NotEmpty(t, token)
 
-	token2, _ := service.NewToken(userID)
+	token2, _ := service.NewToken(userID, uuid.New(), TokenGrants{})
 	assert.NotEmpty(t, token2)
 	assert.NotEqual(t, token, token2)
 }
@@ -115,7 +115,7 @@ func TestJWTService_ValidateTokenInvalid(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, service)
 
-	token, err := service.NewToken(uuid.New())
+	token, err := service.NewToken(uuid.New(), uuid.New(), TokenGrants{})
 	assert.NoError(t, err)
 	assert.NotEmpty(t, token)
 
@@ -134,8 +134,60 @@ func TestJWTService_ValidateTokenInvalid(t *testing.T) {
 
 	// invalid signing key
 	service2, _ := NewJWTService(WithSigningKey([]byte("test-valid-and-secure-long-signing-key-greater-than-64-bytes-but-different!!!!")))
-	token, err = service2.NewToken(uuid.New())
+	token, err = service2.NewToken(uuid.New(), uuid.New(), TokenGrants{})
 	claims, err = service.ValidateToken(token)
 	assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
 	assert.Empty(t, claims)
 }
+
+func TestJWTService_ChallengeToken(t *testing.T) {
+	service, err := NewJWTService()
+	assert.NoError(t, err)
+	userID := uuid.New()
+
+	challenge, err := service.NewChallengeToken(userID)
+	assert.NoError(t, err)
+	claims, err := service.ValidateChallengeToken(challenge)
+	assert.NoError(t, err)
+	assert.Equal(t, userID.String(), claims.Subject)
+
+	// challenges cannot be used as access tokens and the other way around
+	_, err = service.ValidateToken(challenge)
+	assert.ErrorIs(t, err, ErrTokenPurpose)
+	token, err := service.NewToken(userID, uuid.New(), TokenGrants{})
+	assert.NoError(t, err)
+	_, err = service.ValidateChallengeToken(token)
+	assert.ErrorIs(t, err, ErrTokenPurpose)
+}
+
+func TestJWTService_TokenGrants(t *testing.T) {
+	service, err := NewJWTService()
+	assert.NoError(t, err)
+	grants := TokenGrants{Roles: []string{"admin"}, Scopes: []string{ScopeFormsRead}, Tenant: "acme"}
+
+	token, err := service.NewToken(uuid.New(), uuid.New(), grants)
+	assert.NoError(t, err)
+	claims, err := service.ValidateToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, grants, claims.TokenGrants)
+	assert.Equal(t, jwt.ClaimStrings{"dynamic-webforms"}, claims.Audience)
+}
+
+func TestWithAudience(t *testing.T) {
+	signingKey := WithSigningKey([]byte("test-valid-and-secure-long-signing-key-greater-than-64-bytes!!!!"))
+	web, err := NewJWTService(signingKey, WithAudience("web"))
+	assert.NoError(t, err)
+	cli, err := NewJWTService(signingKey, WithAudience("cli"))
+	assert.NoError(t, err)
+	_, err = NewJWTService(WithAudience(""))
+	assert.Error(t, err)
+
+	token, err := web.NewToken(uuid.New(), uuid.New(), TokenGrants{})
+	assert.NoError(t, err)
+	_, err = web.ValidateToken(token)
+	assert.NoError(t, err)
+
+	// tokens signed with the same key are not accepted for another audience
+	_, err = cli.ValidateToken(token)
+	assert.ErrorIs(t, err, jwt.ErrTokenInvalidAudience)
+}
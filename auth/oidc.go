@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/oauth2"
+	"io"
+	"time"
+)
+
+// OIDCConfig configures the login with an OpenID Connect provider. RedirectURL is the callback endpoint of the
+// server registered at the provider. Without an issuer the login is disabled.
+type OIDCConfig struct {
+	IssuerURL    string   `json:"issuerURL" validate:"omitempty,url"`
+	ClientID     string   `json:"clientID" validate:"required_with=IssuerURL"`
+	ClientSecret string   `json:"clientSecret"`
+	RedirectURL  string   `json:"redirectURL" validate:"required_with=IssuerURL,omitempty,url"`
+	Scopes       []string `json:"scopes"`
+	// StateSecret is the secret the key sealing the state of logins is derived from. All replicas of the server
+	// need the same secret, as the callback of a login may reach another replica than its start.
+	StateSecret string `json:"stateSecret" validate:"required_with=IssuerURL,omitempty,min=32"`
+}
+
+// OIDCIdentity holds the claims of a verified ID token used to find or provision the user.
+type OIDCIdentity struct {
+	Issuer            string `json:"iss"`
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// oidcLogin is the state of a login kept by the client between redirecting to the provider and the callback.
+type oidcLogin struct {
+	State        string    `json:"state"`
+	Nonce        string    `json:"nonce"`
+	CodeVerifier string    `json:"codeVerifier"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+const oidcLoginExpiry = 10 * time.Minute
+
+var ErrOIDCLogin = errors.New("OIDC login failed")
+
+// oidcStateKeyInfo separates the key sealing the state of logins from other keys derived from the same secret.
+const oidcStateKeyInfo = "dynamic-webforms oidc login state"
+
+// OIDCProvider implements the authorization code flow with PKCE. The state of a login is sealed with a key derived
+// from the configured secret, so the client cannot read the PKCE verifier or change the state it keeps for the
+// callback.
+type OIDCProvider struct {
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+	aead     cipher.AEAD
+}
+
+// NewOIDCProvider reads the endpoints and keys of the provider from its discovery document.
+func NewOIDCProvider(ctx context.Context, config OIDCConfig) (*OIDCProvider, error) {
+	provider, err := oidc.NewProvider(ctx, config.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed discovering OIDC provider: %w", err)
+	}
+
+	scopes := config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"profile", "email"}
+	}
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(config.StateSecret), nil, []byte(oidcStateKeyInfo)),
+		key); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCProvider{
+		oauth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  config.RedirectURL,
+			Scopes:       append([]string{oidc.ScopeOpenID}, scopes...),
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+		aead:     aead,
+	}, nil
+}
+
+// StartLogin returns the URL of the login page of the provider and the sealed state of the login, which the client
+// keeps until the callback, e.g. in a cookie.
+func (p *OIDCProvider) StartLogin() (string, string, error) {
+	login := oidcLogin{
+		State:        oauth2.GenerateVerifier(),
+		Nonce:        oauth2.GenerateVerifier(),
+		CodeVerifier: oauth2.GenerateVerifier(),
+		ExpiresAt:    time.Now().Add(oidcLoginExpiry),
+	}
+
+	sealed, err := p.seal(login)
+	if err != nil {
+		return "", "", err
+	}
+
+	return p.oauth2.AuthCodeURL(login.State, oidc.Nonce(login.Nonce), oauth2.S256ChallengeOption(login.CodeVerifier)),
+		sealed, nil
+}
+
+// FinishLogin exchanges the code of the callback for an ID token and returns its verified identity. It returns an
+// error wrapping ErrOIDCLogin if the state does not belong to the sealed login or the token is invalid.
+func (p *OIDCProvider) FinishLogin(ctx context.Context, sealedLogin string, state string, code string) (OIDCIdentity, error) {
+	login, err := p.open(sealedLogin)
+	if err != nil {
+		return OIDCIdentity{}, fmt.Errorf("%w: invalid login state", ErrOIDCLogin)
+	}
+
+	if state == "" || state != login.State || time.Now().After(login.ExpiresAt) {
+		return OIDCIdentity{}, fmt.Errorf("%w: state mismatch or expired", ErrOIDCLogin)
+	}
+
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(login.CodeVerifier))
+	if err != nil {
+		return OIDCIdentity{}, fmt.Errorf("%w: %w", ErrOIDCLogin, err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return OIDCIdentity{}, fmt.Errorf("%w: no ID token in token response", ErrOIDCLogin)
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return OIDCIdentity{}, fmt.Errorf("%w: %w", ErrOIDCLogin, err)
+	}
+
+	if idToken.Nonce != login.Nonce {
+		return OIDCIdentity{}, fmt.Errorf("%w: nonce mismatch", ErrOIDCLogin)
+	}
+
+	var identity OIDCIdentity
+	if err := idToken.Claims(&identity); err != nil {
+		return OIDCIdentity{}, fmt.Errorf("%w: %w", ErrOIDCLogin, err)
+	}
+
+	return identity, nil
+}
+
+func (p *OIDCProvider) seal(login oidcLogin) (string, error) {
+	data, err := json.Marshal(login)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(p.aead.Seal(nonce, nonce, data, nil)), nil
+}
+
+func (p *OIDCProvider) open(sealed string) (oidcLogin, error) {
+	data, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil || len(data) < p.aead.NonceSize() {
+		return oidcLogin{}, errors.New("invalid sealed login")
+	}
+
+	data, err = p.aead.Open(nil, data[:p.aead.NonceSize()], data[p.aead.NonceSize():], nil)
+	if err != nil {
+		return oidcLogin{}, err
+	}
+
+	var login oidcLogin
+	err = json.Unmarshal(data, &login)
+	return login, err
+}
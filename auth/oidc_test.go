@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"github.com/sean-b-martin/dynamic-webforms-server/auth/oidctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+)
+
+const testStateSecret = "0123456789abcdef0123456789abcdef"
+
+func newTestOIDCProvider(t *testing.T, mock *oidctest.Provider, stateSecret string) *OIDCProvider {
+	provider, err := NewOIDCProvider(context.Background(), OIDCConfig{
+		IssuerURL:   mock.Issuer(),
+		ClientID:    oidctest.ClientID,
+		RedirectURL: "http://localhost:3000/users/oidc/callback",
+		StateSecret: stateSecret,
+	})
+	require.NoError(t, err)
+	return provider
+}
+
+// startLogin starts a login and returns the sealed login with the query of the callback.
+func startLogin(t *testing.T, provider *OIDCProvider, mock *oidctest.Provider) (string, url.Values) {
+	authURL, sealed, err := provider.StartLogin()
+	require.NoError(t, err)
+	callback, err := mock.Authorize(authURL)
+	require.NoError(t, err)
+	return sealed, callback.Query()
+}
+
+func TestOIDCProvider_FinishLogin(t *testing.T) {
+	mock := oidctest.NewProvider(t)
+	provider := newTestOIDCProvider(t, mock, testStateSecret)
+	mock.SetUser(oidctest.Claims{Subject: "1234", Email: "alice@example.com", EmailVerified: true,
+		PreferredUsername: "alice"})
+
+	sealed, callback := startLogin(t, provider, mock)
+	identity, err := provider.FinishLogin(context.Background(), sealed, callback.Get("state"), callback.Get("code"))
+	require.NoError(t, err)
+	assert.Equal(t, OIDCIdentity{Issuer: mock.Issuer(), Subject: "1234", Email: "alice@example.com",
+		EmailVerified: true, PreferredUsername: "alice"}, identity)
+
+	// replicas sharing the secret finish the logins started by each other
+	replica := newTestOIDCProvider(t, mock, testStateSecret)
+	sealed, callback = startLogin(t, provider, mock)
+	_, err = replica.FinishLogin(context.Background(), sealed, callback.Get("state"), callback.Get("code"))
+	assert.NoError(t, err)
+}
+
+func TestOIDCProvider_FinishLoginInvalid(t *testing.T) {
+	mock := oidctest.NewProvider(t)
+	provider := newTestOIDCProvider(t, mock, testStateSecret)
+	mock.SetUser(oidctest.Claims{Subject: "1234"})
+	otherProvider := newTestOIDCProvider(t, mock, "fedcba9876543210fedcba9876543210")
+
+	tests := []struct {
+		name   string
+		modify func(sealed string, callback url.Values) (string, url.Values)
+	}{
+		{name: "state mismatch", modify: func(sealed string, callback url.Values) (string, url.Values) {
+			callback.Set("state", "other")
+			return sealed, callback
+		}},
+		{name: "tampered login", modify: func(sealed string, callback url.Values) (string, url.Values) {
+			return "x" + sealed[1:], callback
+		}},
+		{name: "login of another login", modify: func(_ string, callback url.Values) (string, url.Values) {
+			// the state of the other login matches the callback, but its PKCE verifier does not
+			sealed, other := startLogin(t, provider, mock)
+			callback.Set("state", other.Get("state"))
+			return sealed, callback
+		}},
+		{name: "login sealed with another secret", modify: func(_ string, callback url.Values) (string, url.Values) {
+			sealed, _, err := otherProvider.StartLogin()
+			require.NoError(t, err)
+			return sealed, callback
+		}},
+		{name: "invalid code", modify: func(sealed string, callback url.Values) (string, url.Values) {
+			callback.Set("code", "invalid")
+			return sealed, callback
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, callback := tt.modify(startLogin(t, provider, mock))
+			_, err := provider.FinishLogin(context.Background(), sealed, callback.Get("state"), callback.Get("code"))
+			assert.ErrorIs(t, err, ErrOIDCLogin)
+		})
+	}
+
+	// codes are single-use
+	sealed, callback := startLogin(t, provider, mock)
+	_, err := provider.FinishLogin(context.Background(), sealed, callback.Get("state"), callback.Get("code"))
+	require.NoError(t, err)
+	_, err = provider.FinishLogin(context.Background(), sealed, callback.Get("state"), callback.Get("code"))
+	assert.ErrorIs(t, err, ErrOIDCLogin)
+}
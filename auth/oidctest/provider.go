@@ -0,0 +1,202 @@
+// Package oidctest implements a minimal OpenID Connect provider for tests of the OIDC login.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/go-jose/go-jose/v4"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+const ClientID = "webforms-test"
+
+// Provider logs in the user set by SetUser without asking for credentials. It checks the PKCE verifier of the
+// token requests and signs the ID tokens with a key generated per provider.
+type Provider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	signer jose.Signer
+
+	mu    sync.Mutex
+	user  Claims
+	codes map[string]authorization
+}
+
+// Claims are the claims of the ID tokens issued for the user.
+type Claims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+}
+
+type authorization struct {
+	claims        Claims
+	nonce         string
+	codeChallenge string
+	redirectURI   string
+}
+
+// NewProvider starts a provider which is stopped at the end of the test.
+func NewProvider(t *testing.T) *Provider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: key, KeyID: "test"}},
+		(&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Provider{key: key, signer: signer, codes: make(map[string]authorization)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /keys", p.keys)
+	mux.HandleFunc("GET /authorize", p.authorize)
+	mux.HandleFunc("POST /token", p.token)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+func (p *Provider) Issuer() string {
+	return p.server.URL
+}
+
+// SetUser sets the user logged in by the following authorization requests.
+func (p *Provider) SetUser(claims Claims) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.user = claims
+}
+
+// Authorize follows the authorization URL the way a browser of a logged-in user would and returns the callback URL
+// the provider redirects to.
+func (p *Provider) Authorize(authURL string) (*url.URL, error) {
+	client := http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return resp.Location()
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"issuer":                                p.server.URL,
+		"authorization_endpoint":                p.server.URL + "/authorize",
+		"token_endpoint":                        p.server.URL + "/token",
+		"jwks_uri":                              p.server.URL + "/keys",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *Provider) keys(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &p.key.PublicKey, KeyID: "test", Algorithm: string(jose.RS256), Use: "sig"},
+	}})
+}
+
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != ClientID || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	p.mu.Lock()
+	p.codes[code] = authorization{claims: p.user, nonce: query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"), redirectURI: query.Get("redirect_uri")}
+	p.mu.Unlock()
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	callback := redirect.Query()
+	callback.Set("code", code)
+	callback.Set("state", query.Get("state"))
+	redirect.RawQuery = callback.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// codes are single-use
+	p.mu.Lock()
+	auth, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || auth.codeChallenge != base64.RawURLEncoding.EncodeToString(challenge[:]) ||
+		auth.redirectURI != r.PostForm.Get("redirect_uri") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":            p.server.URL,
+		"sub":            auth.claims.Subject,
+		"aud":            ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Minute).Unix(),
+		"nonce":          auth.nonce,
+		"email":          auth.claims.Email,
+		"email_verified": auth.claims.EmailVerified,
+	}
+	if auth.claims.PreferredUsername != "" {
+		claims["preferred_username"] = auth.claims.PreferredUsername
+	}
+
+	payload, _ := json.Marshal(claims)
+	signed, err := p.signer.Sign(payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	idToken, _ := signed.CompactSerialize()
+
+	writeJSON(w, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	data := make([]byte, 16)
+	_, _ = rand.Read(data)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordPolicyConfig configures the rules new passwords must satisfy. Lengths are counted in characters.
+// MinStrengthBits is compared with a rough entropy estimate which discounts repeated and sequential characters.
+// BreachedPasswordsDir is an optional directory of breached password hashes, see BreachedPasswordDirectory.
+type PasswordPolicyConfig struct {
+	MinLength            int     `json:"minLength" validate:"min=1"`
+	MaxLength            int     `json:"maxLength" validate:"gtefield=MinLength"`
+	MinCharacterClasses  int     `json:"minCharacterClasses" validate:"min=0,max=4"`
+	RejectUsername       bool    `json:"rejectUsername"`
+	MinStrengthBits      float64 `json:"minStrengthBits" validate:"min=0"`
+	BreachedPasswordsDir string  `json:"breachedPasswordsDir"`
+}
+
+var DefaultPasswordPolicyConfig = PasswordPolicyConfig{
+	MinLength:       8,
+	MaxLength:       1024,
+	RejectUsername:  true,
+	MinStrengthBits: 30,
+}
+
+// PolicyViolation is a rule of the password policy a password does not satisfy, Param is the configured value of
+// the rule.
+type PolicyViolation struct {
+	Rule    string
+	Param   string
+	Message string
+}
+
+// PasswordPolicyError is returned if a password violates the password policy.
+type PasswordPolicyError struct {
+	Violations []PolicyViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.Message
+	}
+
+	return "password violates the password policy: " + strings.Join(messages, ", ")
+}
+
+type PasswordPolicy struct {
+	config   PasswordPolicyConfig
+	breached *BreachedPasswordDirectory
+}
+
+func NewPasswordPolicy(config PasswordPolicyConfig) (*PasswordPolicy, error) {
+	if config.MinLength < 1 || config.MaxLength < config.MinLength {
+		return nil, errors.New("invalid password length limits")
+	}
+
+	policy := PasswordPolicy{config: config}
+	if config.BreachedPasswordsDir != "" {
+		var err error
+		if policy.breached, err = NewBreachedPasswordDirectory(config.BreachedPasswordsDir); err != nil {
+			return nil, err
+		}
+	}
+
+	return &policy, nil
+}
+
+// Check returns a *PasswordPolicyError listing all rules the password of the user violates.
+func (p *PasswordPolicy) Check(username string, password string) error {
+	var violations []PolicyViolation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.config.MinLength {
+		violations = append(violations, PolicyViolation{Rule: "min_length", Param: strconv.Itoa(p.config.MinLength),
+			Message: fmt.Sprintf("must contain at least %d characters", p.config.MinLength)})
+	}
+	if length > p.config.MaxLength {
+		violations = append(violations, PolicyViolation{Rule: "max_length", Param: strconv.Itoa(p.config.MaxLength),
+			Message: fmt.Sprintf("must contain at most %d characters", p.config.MaxLength)})
+	}
+
+	if classes := characterClasses(password); classes < p.config.MinCharacterClasses {
+		violations = append(violations, PolicyViolation{Rule: "character_classes",
+			Param: strconv.Itoa(p.config.MinCharacterClasses),
+			Message: fmt.Sprintf("must contain %d of lowercase letters, uppercase letters, digits and symbols",
+				p.config.MinCharacterClasses)})
+	}
+
+	if p.config.RejectUsername && username != "" &&
+		strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		violations = append(violations, PolicyViolation{Rule: "contains_username",
+			Message: "must not contain the username"})
+	}
+
+	if p.config.MinStrengthBits > 0 && estimateStrength(password) < p.config.MinStrengthBits {
+		violations = append(violations, PolicyViolation{Rule: "strength",
+			Param:   strconv.FormatFloat(p.config.MinStrengthBits, 'f', -1, 64),
+			Message: "is too easy to guess, use a longer password with fewer repetitions"})
+	}
+
+	if p.breached != nil {
+		breached, err := p.breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			violations = append(violations, PolicyViolation{Rule: "breached",
+				Message: "appeared in a data breach and must not be used"})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+const (
+	classLower = 1 << iota
+	classUpper
+	classDigit
+	classSymbol
+)
+
+func characterClass(r rune) int {
+	switch {
+	case unicode.IsLower(r):
+		return classLower
+	case unicode.IsUpper(r):
+		return classUpper
+	case unicode.IsDigit(r):
+		return classDigit
+	default:
+		return classSymbol
+	}
+}
+
+func characterClasses(password string) int {
+	classes := 0
+	for _, r := range password {
+		classes |= characterClass(r)
+	}
+
+	count := 0
+	for ; classes > 0; classes &= classes - 1 {
+		count++
+	}
+	return count
+}
+
+// estimateStrength estimates the entropy of a password in bits from the size of the alphabet of its character
+// classes. Characters repeating or continuing a sequence of the previous ones, e.g. aaaa or 1234, are not counted.
+func estimateStrength(password string) float64 {
+	alphabets := map[int]float64{classLower: 26, classUpper: 26, classDigit: 10, classSymbol: 33}
+
+	classes := 0
+	effectiveLength := 0
+	previous := rune(-1)
+	for _, r := range password {
+		classes |= characterClass(r)
+
+		if r != previous && r != previous+1 && r != previous-1 {
+			effectiveLength++
+		}
+		previous = r
+	}
+
+	alphabet := 0.0
+	for class, size := range alphabets {
+		if classes&class != 0 {
+			alphabet += size
+		}
+	}
+	if alphabet == 0 {
+		return 0
+	}
+
+	return float64(effectiveLength) * math.Log2(alphabet)
+}
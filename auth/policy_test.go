@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPasswordPolicy_Check(t *testing.T) {
+	policy, err := NewPasswordPolicy(PasswordPolicyConfig{MinLength: 8, MaxLength: 16, MinCharacterClasses: 3,
+		RejectUsername: true})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		username  string
+		password  string
+		wantRules []string
+	}{
+		{name: "valid password", username: "alice", password: "Secret-pass"},
+		{name: "too long", username: "alice", password: "Secret-pass-Secret-pass", wantRules: []string{"max_length"}},
+		{name: "unicode characters", username: "alice", password: "Pässwörter🔒", wantRules: nil},
+		{name: "two character classes", username: "alice", password: "secretpass1", wantRules: []string{"character_classes"}},
+		{name: "username in other case", username: "alice", password: "ALICE-pass1", wantRules: []string{"contains_username"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.username, tt.password)
+			if tt.wantRules == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var policyErr *PasswordPolicyError
+			require.ErrorAs(t, err, &policyErr)
+			rules := make([]string, len(policyErr.Violations))
+			for i, violation := range policyErr.Violations {
+				rules[i] = violation.Rule
+			}
+			assert.Equal(t, tt.wantRules, rules)
+		})
+	}
+}
+
+func TestBreachedPasswordDirectory(t *testing.T) {
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "5BAA6.txt"),
+		[]byte("003D68EB55068C33ACE09247EE4C639306B:3\r\n1e4c9b93f3f0682250b6cf8331b7ee68fd8:9545824\r\n"), 0o600))
+
+	breached, err := NewBreachedPasswordDirectory(dir)
+	require.NoError(t, err)
+
+	contains, err := breached.Contains("password")
+	require.NoError(t, err)
+	assert.True(t, contains)
+
+	// no range file for the prefix of the hash
+	contains, err = breached.Contains("correct horse battery staple")
+	require.NoError(t, err)
+	assert.False(t, contains)
+
+	_, err = NewBreachedPasswordDirectory(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
@@ -1,27 +1,111 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
-	"golang.org/x/crypto/bcrypt"
+	"strings"
 )
 
+// NoPassword is stored instead of a hash for users without a password, e.g. users provisioned for an external
+// identity. No password matches it.
+const NoPassword = "!"
+
+var (
+	ErrMismatchedPassword = errors.New("password does not match the hash")
+	ErrUnsupportedHash    = errors.New("unsupported password hash")
+)
+
+// Hasher hashes passwords with one algorithm. Hashes are PHC strings, $<id>$<params>$<salt>$<hash>, so the
+// algorithm of a stored hash is known when verifying it.
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Verify returns ErrMismatchedPassword if password does not match hash.
+	Verify(hash string, password string) error
+	// Supports reports whether hashes with the algorithm identifier id can be verified by the hasher.
+	Supports(id string) bool
+	// NeedsRehash reports whether a supported hash was created with parameters other than the current ones.
+	NeedsRehash(hash string) bool
+}
+
+// PasswordService hashes new passwords with its hasher and verifies hashes of all algorithms of its hashers, so
+// stored hashes of previous algorithms stay valid until they are rehashed.
 type PasswordService struct {
-	cost int
+	hasher  Hasher
+	hashers []Hasher
+	// dummyHash is a hash of a random password for VerifyDummy
+	dummyHash string
 }
 
-func NewPasswordService(cost int) (*PasswordService, error) {
-	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
-		return nil, errors.New("invalid cost")
+// NewPasswordService creates a password service hashing with hasher. previous are only used to verify hashes.
+func NewPasswordService(hasher Hasher, previous ...Hasher) (*PasswordService, error) {
+	if hasher == nil {
+		return nil, errors.New("missing hasher")
+	}
+
+	dummyPassword := make([]byte, 16)
+	if _, err := rand.Read(dummyPassword); err != nil {
+		return nil, err
 	}
 
-	return &PasswordService{cost: cost}, nil
+	dummyHash, err := hasher.Hash(hex.EncodeToString(dummyPassword))
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasswordService{hasher: hasher, hashers: append([]Hasher{hasher}, previous...), dummyHash: dummyHash}, nil
 }
 
 func (s *PasswordService) HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), s.cost)
-	return string(bytes), err
+	return s.hasher.Hash(password)
 }
 
 func (s *PasswordService) VerifyPassword(hash, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if hash == NoPassword {
+		s.VerifyDummy(password)
+		return ErrMismatchedPassword
+	}
+
+	hasher, err := s.hasherOf(hash)
+	if err != nil {
+		return err
+	}
+
+	return hasher.Verify(hash, password)
+}
+
+// VerifyDummy verifies password against a hash no password matches, so rejecting a login without verifying a stored
+// hash, e.g. of an unknown user, takes as long as rejecting a wrong password.
+func (s *PasswordService) VerifyDummy(password string) {
+	_ = s.hasher.Verify(s.dummyHash, password)
+}
+
+// NeedsRehash reports whether a hash should be replaced by a new hash of the password, because it was created
+// with another algorithm or outdated parameters.
+func (s *PasswordService) NeedsRehash(hash string) bool {
+	if hash == NoPassword {
+		return false
+	}
+
+	hasher, err := s.hasherOf(hash)
+	if err != nil {
+		return true
+	}
+
+	return hasher != s.hasher || hasher.NeedsRehash(hash)
+}
+
+func (s *PasswordService) hasherOf(hash string) (Hasher, error) {
+	id, _, ok := strings.Cut(strings.TrimPrefix(hash, "$"), "$")
+	if !ok || !strings.HasPrefix(hash, "$") {
+		return nil, ErrUnsupportedHash
+	}
+
+	for _, hasher := range s.hashers {
+		if hasher.Supports(id) {
+			return hasher, nil
+		}
+	}
+
+	return nil, ErrUnsupportedHash
 }
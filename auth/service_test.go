@@ -2,11 +2,15 @@ package auth
 
 import (
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/bcrypt"
+	"strings"
 	"testing"
 )
 
-func TestNewPasswordService(t *testing.T) {
+var testArgon2idParams = Argon2idParams{Memory: 8 * 1024, Iterations: 1, Parallelism: 1}
+
+func TestNewBcryptHasher(t *testing.T) {
 	type args struct {
 		cost int
 	}
@@ -22,49 +26,146 @@ func TestNewPasswordService(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			service, err := NewPasswordService(tt.args.cost)
+			hasher, err := NewBcryptHasher(tt.args.cost)
 			if tt.wantError {
 				assert.Error(t, err)
-				assert.Nil(t, service)
+				assert.Nil(t, hasher)
 			} else {
 				assert.NoError(t, err)
-				assert.NotNil(t, service)
-				assert.Equal(t, tt.args.cost, service.cost)
+				assert.NotNil(t, hasher)
+				assert.Equal(t, tt.args.cost, hasher.cost)
 			}
 		})
 	}
 }
 
-func TestPasswordService_Hash(t *testing.T) {
-	type fields struct {
-		cost int
+func TestNewArgon2idHasher(t *testing.T) {
+	tests := []struct {
+		name      string
+		params    Argon2idParams
+		options   []Argon2idHasherOption
+		wantError bool
+	}{
+		{name: "default parameters", params: DefaultArgon2idParams},
+		{name: "no iterations", params: Argon2idParams{Memory: 8 * 1024, Parallelism: 1}, wantError: true},
+		{name: "no parallelism", params: Argon2idParams{Memory: 8 * 1024, Iterations: 1}, wantError: true},
+		{name: "pepper", params: DefaultArgon2idParams,
+			options: []Argon2idHasherOption{WithPeppers("1", map[string][]byte{"1": []byte("pepper")})}},
+		{name: "missing current pepper", params: DefaultArgon2idParams,
+			options: []Argon2idHasherOption{WithPeppers("2", map[string][]byte{"1": []byte("pepper")})}, wantError: true},
+		{name: "invalid pepper id", params: DefaultArgon2idParams,
+			options: []Argon2idHasherOption{WithPeppers("a$b", map[string][]byte{"a$b": []byte("pepper")})}, wantError: true},
 	}
-	type args struct {
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hasher, err := NewArgon2idHasher(tt.params, tt.options...)
+			if tt.wantError {
+				assert.Error(t, err)
+				assert.Nil(t, hasher)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, hasher)
+			}
+		})
+	}
+}
+
+func TestArgon2idHasher_Hash(t *testing.T) {
+	hasher, err := NewArgon2idHasher(testArgon2idParams)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
 		password string
+	}{
+		{name: "empty password", password: ""},
+		{name: "normal password", password: "abc"},
+		{name: "password with unicode", password: "🔒🔒unicode-password🔒🔒"},
+		// bcrypt ignores everything after 72 bytes
+		{name: "password longer than 72 bytes", password: strings.Repeat("a", 100)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := hasher.Hash(tt.password)
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=8192,t=1,p=1$"), hash)
+			assert.LessOrEqual(t, len(hash), 255)
+
+			assert.NoError(t, hasher.Verify(hash, tt.password))
+			assert.ErrorIs(t, hasher.Verify(hash, tt.password+"x"), ErrMismatchedPassword)
+		})
 	}
+
+	truncated, err := hasher.Hash(strings.Repeat("a", 72) + "b")
+	require.NoError(t, err)
+	assert.ErrorIs(t, hasher.Verify(truncated, strings.Repeat("a", 72)+"c"), ErrMismatchedPassword)
+}
+
+func TestArgon2idHasher_Verify(t *testing.T) {
+	hasher, err := NewArgon2idHasher(testArgon2idParams)
+	require.NoError(t, err)
+
 	tests := []struct {
-		name   string
-		fields fields
-		args   args
+		name      string
+		hash      string
+		password  string
+		wantError error
 	}{
-		{name: "empty password", fields: fields{cost: bcrypt.DefaultCost}, args: args{password: ""}},
-		{name: "normal password", fields: fields{cost: bcrypt.DefaultCost}, args: args{password: "abc"}},
-		{name: "long password", fields: fields{cost: bcrypt.DefaultCost}, args: args{password: "A#4zT!fW9Pq@&eR6m^X*o(3K=+Lh|~78d%_CnG}"}},
-		{name: "password with unicode", fields: fields{cost: bcrypt.DefaultCost}, args: args{password: "🔒🔒unicode-password🔒🔒"}},
+		// stored hashes must stay valid, the parameters of a hash are used instead of the ones of the hasher
+		{name: "stored hash", hash: "$argon2id$v=19$m=8192,t=1,p=1$c29tZXNhbHQxMjM0NTY3OA$pKjxKVlWc+fzUpxRpJzIQKWh1vQKWmBRYnVOOczA+NY",
+			password: "password"},
+		{name: "stored hash, invalid", hash: "$argon2id$v=19$m=8192,t=1,p=1$c29tZXNhbHQxMjM0NTY3OA$pKjxKVlWc+fzUpxRpJzIQKWh1vQKWmBRYnVOOczA+NY",
+			password: "passwort", wantError: ErrMismatchedPassword},
+		{name: "other parameters", hash: "$argon2id$v=19$m=8192,t=2,p=1$c29tZXNhbHQxMjM0NTY3OA$pKjxKVlWc+fzUpxRpJzIQKWh1vQKWmBRYnVOOczA+NY",
+			password: "password", wantError: ErrMismatchedPassword},
+		{name: "other version", hash: "$argon2id$v=16$m=8192,t=1,p=1$c29tZXNhbHQxMjM0NTY3OA$pKjxKVlWc+fzUpxRpJzIQKWh1vQKWmBRYnVOOczA+NY",
+			password: "password", wantError: ErrUnsupportedHash},
+		{name: "unknown parameter", hash: "$argon2id$v=19$m=8192,t=1,p=1,x=1$c29tZXNhbHQxMjM0NTY3OA$pKjxKVlWc+fzUpxRpJzIQKWh1vQKWmBRYnVOOczA+NY",
+			password: "password", wantError: ErrUnsupportedHash},
+		{name: "unknown pepper", hash: "$argon2id$v=19$m=8192,t=1,p=1,keyid=1$c29tZXNhbHQxMjM0NTY3OA$pKjxKVlWc+fzUpxRpJzIQKWh1vQKWmBRYnVOOczA+NY",
+			password: "password", wantError: ErrUnsupportedHash},
+		{name: "parallelism out of range", hash: "$argon2id$v=19$m=8192,t=1,p=256$c29tZXNhbHQxMjM0NTY3OA$pKjxKVlWc+fzUpxRpJzIQKWh1vQKWmBRYnVOOczA+NY",
+			password: "password", wantError: ErrUnsupportedHash},
+		{name: "invalid base64", hash: "$argon2id$v=19$m=8192,t=1,p=1$c29tZXNhbHQxMjM0NTY3OA$!!!", password: "password",
+			wantError: ErrUnsupportedHash},
+		{name: "bcrypt hash", hash: "$2a$10$nIhWUx57Dc44tOxXUN.dB.ihWQY4wTVuSTrIDGpFAgnqgEGj79qkK", password: "password",
+			wantError: ErrUnsupportedHash},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			service, err := NewPasswordService(tt.fields.cost)
-			assert.NoError(t, err)
-			got, err := service.HashPassword(tt.args.password)
-			assert.NoError(t, err)
-			assert.NotEmpty(t, got)
-			assert.Len(t, got, 60)
+			err := hasher.Verify(tt.hash, tt.password)
+			if tt.wantError != nil {
+				assert.ErrorIs(t, err, tt.wantError)
+			} else {
+				assert.NoError(t, err)
+			}
 		})
 	}
 }
 
-func TestPasswordService_VerifyPassword(t *testing.T) {
+func TestArgon2idHasher_Pepper(t *testing.T) {
+	peppers := map[string][]byte{"1": []byte("old pepper"), "2": []byte("new pepper")}
+	old, err := NewArgon2idHasher(testArgon2idParams, WithPeppers("1", peppers))
+	require.NoError(t, err)
+	current, err := NewArgon2idHasher(testArgon2idParams, WithPeppers("2", peppers))
+	require.NoError(t, err)
+	withoutPepper, err := NewArgon2idHasher(testArgon2idParams)
+	require.NoError(t, err)
+
+	hash, err := old.Hash("password")
+	require.NoError(t, err)
+	assert.Contains(t, hash, ",keyid=1$")
+
+	// hashes of rotated peppers are verified but replaced
+	assert.NoError(t, current.Verify(hash, "password"))
+	assert.True(t, current.NeedsRehash(hash))
+	assert.False(t, old.NeedsRehash(hash))
+
+	// the pepper is required to verify a hash
+	assert.ErrorIs(t, withoutPepper.Verify(hash, "password"), ErrUnsupportedHash)
+}
+
+func TestBcryptHasher_Verify(t *testing.T) {
 	type fields struct {
 		cost int
 	}
@@ -87,14 +188,88 @@ func TestPasswordService_VerifyPassword(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			service, err := NewPasswordService(tt.fields.cost)
+			hasher, err := NewBcryptHasher(tt.fields.cost)
 			assert.NoError(t, err)
 
 			if tt.wantError {
-				assert.Error(t, service.VerifyPassword(tt.args.hash, tt.args.password))
+				assert.ErrorIs(t, hasher.Verify(tt.args.hash, tt.args.password), ErrMismatchedPassword)
+			} else {
+				assert.NoError(t, hasher.Verify(tt.args.hash, tt.args.password))
+			}
+		})
+	}
+}
+
+func TestPasswordService(t *testing.T) {
+	argon2id, err := NewArgon2idHasher(testArgon2idParams)
+	require.NoError(t, err)
+	stronger, err := NewArgon2idHasher(Argon2idParams{Memory: 16 * 1024, Iterations: 1, Parallelism: 1})
+	require.NoError(t, err)
+	bcryptHasher, err := NewBcryptHasher(bcrypt.MinCost)
+	require.NoError(t, err)
+
+	service, err := NewPasswordService(argon2id, bcryptHasher)
+	require.NoError(t, err)
+
+	hash, err := service.HashPassword("password")
+	require.NoError(t, err)
+	strongerHash, err := stronger.Hash("password")
+	require.NoError(t, err)
+	bcryptHash, err := bcryptHasher.Hash("password")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		hash            string
+		wantError       error
+		wantNeedsRehash bool
+	}{
+		{name: "current hash", hash: hash},
+		{name: "other parameters", hash: strongerHash, wantNeedsRehash: true},
+		{name: "previous algorithm", hash: bcryptHash, wantNeedsRehash: true},
+		{name: "unknown algorithm", hash: "$scrypt$ln=16,r=8,p=1$c2FsdA$aGFzaA", wantError: ErrUnsupportedHash,
+			wantNeedsRehash: true},
+		{name: "no PHC string", hash: "password", wantError: ErrUnsupportedHash, wantNeedsRehash: true},
+		{name: "no password", hash: NoPassword, wantError: ErrMismatchedPassword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.VerifyPassword(tt.hash, "password")
+			if tt.wantError != nil {
+				assert.ErrorIs(t, err, tt.wantError)
 			} else {
-				assert.NoError(t, service.VerifyPassword(tt.args.hash, tt.args.password))
+				assert.NoError(t, err)
+				assert.ErrorIs(t, service.VerifyPassword(tt.hash, "wrong"), ErrMismatchedPassword)
 			}
+			assert.Equal(t, tt.wantNeedsRehash, service.NeedsRehash(tt.hash))
 		})
 	}
+
+	_, err = NewPasswordService(nil)
+	assert.Error(t, err)
+}
+
+// countingHasher counts the verified passwords.
+type countingHasher struct {
+	Hasher
+	verified int
+}
+
+func (h *countingHasher) Verify(hash string, password string) error {
+	h.verified++
+	return h.Hasher.Verify(hash, password)
+}
+
+func TestPasswordService_VerifyDummy(t *testing.T) {
+	argon2id, err := NewArgon2idHasher(testArgon2idParams)
+	require.NoError(t, err)
+	hasher := &countingHasher{Hasher: argon2id}
+	service, err := NewPasswordService(hasher)
+	require.NoError(t, err)
+
+	// rejecting a login without a stored hash costs as much as rejecting a wrong password
+	service.VerifyDummy("password")
+	assert.Equal(t, 1, hasher.verified)
+	assert.ErrorIs(t, service.VerifyPassword(NoPassword, "password"), ErrMismatchedPassword)
+	assert.Equal(t, 2, hasher.verified)
 }
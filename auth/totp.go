@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP generates and validates the time-based one-time passwords of RFC 6238 with the parameters supported by all
+// authenticator apps: HMAC-SHA1, 6 digits and a period of 30 seconds.
+type TOTP struct {
+	issuer string
+	digits int
+	period int64
+	// skew is the number of periods a code is accepted before and after the current one, as clocks drift
+	skew int64
+}
+
+const totpSecretSize = 20
+
+var ErrInvalidTOTPSecret = errors.New("invalid TOTP secret")
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTP creates TOTPs for the accounts of issuer, which authenticator apps show next to the codes.
+func NewTOTP(issuer string) *TOTP {
+	return &TOTP{issuer: issuer, digits: 6, period: 30, skew: 1}
+}
+
+// GenerateSecret returns a random base32 encoded secret.
+func (t *TOTP) GenerateSecret() (string, error) {
+	secret := make([]byte, totpSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// ProvisioningURI returns the otpauth URI of a secret, which authenticator apps read from a QR code.
+func (t *TOTP) ProvisioningURI(secret string, accountName string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", t.issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(t.digits))
+	query.Set("period", fmt.Sprint(t.period))
+
+	label := url.PathEscape(t.issuer + ":" + accountName)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// Code returns the code of the secret at the given time.
+func (t *TOTP) Code(secret string, at time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", ErrInvalidTOTPSecret
+	}
+
+	return t.code(key, at.Unix()/t.period), nil
+}
+
+// Validate returns the time step of code if it is valid at the given time. Callers store the step of the last
+// accepted code and reject codes of the same or earlier steps, so a code cannot be used twice.
+func (t *TOTP) Validate(secret string, code string, at time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != t.digits {
+		return 0, false
+	}
+
+	current := at.Unix() / t.period
+	for step := current - t.skew; step <= current+t.skew; step++ {
+		if subtle.ConstantTimeCompare([]byte(t.code(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// code implements the dynamic truncation of RFC 4226.
+func (t *TOTP) code(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < t.digits; i++ {
+		modulo *= 10
+	}
+
+	return fmt.Sprintf("%0*d", t.digits, value%modulo)
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"encoding/base32"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTOTP_Code(t *testing.T) {
+	// test vectors of RFC 6238 for HMAC-SHA1, which use 8 digits
+	totp := &TOTP{digits: 8, period: 30, skew: 1}
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		time int64
+		code string
+	}{
+		{time: 59, code: "94287082"},
+		{time: 1111111109, code: "07081804"},
+		{time: 1111111111, code: "14050471"},
+		{time: 1234567890, code: "89005924"},
+		{time: 2000000000, code: "69279037"},
+		{time: 20000000000, code: "65353130"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			code, err := totp.Code(secret, time.Unix(tt.time, 0))
+			require.NoError(t, err)
+			assert.Equal(t, tt.code, code)
+		})
+	}
+}
+
+func TestTOTP_Validate(t *testing.T) {
+	totp := NewTOTP("Webforms")
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	now := time.Unix(1_700_000_000, 0)
+	code, err := totp.Code(secret, now)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		at     time.Time
+		wantOK bool
+	}{
+		{name: "current period", secret: secret, code: code, at: now, wantOK: true},
+		{name: "previous period", secret: secret, code: code, at: now.Add(30 * time.Second), wantOK: true},
+		{name: "next period", secret: secret, code: code, at: now.Add(-30 * time.Second), wantOK: true},
+		{name: "too old", secret: secret, code: code, at: now.Add(90 * time.Second), wantOK: false},
+		{name: "wrong code", secret: secret, code: "000000", at: now.Add(time.Hour), wantOK: false},
+		{name: "wrong length", secret: secret, code: code[:5], at: now, wantOK: false},
+		{name: "invalid secret", secret: "not base32!", code: code, at: now, wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := totp.Validate(tt.secret, tt.code, tt.at)
+			assert.Equal(t, tt.wantOK, ok)
+			if ok {
+				assert.Equal(t, now.Unix()/30, step)
+			}
+		})
+	}
+}
+
+func TestTOTP_ProvisioningURI(t *testing.T) {
+	totp := NewTOTP("Dynamic Webforms")
+	uri, err := url.Parse(totp.ProvisioningURI("JBSWY3DPEHPK3PXP", "alice"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Dynamic Webforms:alice", uri.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", uri.Query().Get("secret"))
+	assert.Equal(t, "Dynamic Webforms", uri.Query().Get("issuer"))
+	assert.Equal(t, "6", uri.Query().Get("digits"))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sean-b-martin/dynamic-webforms-server/auth"
+	"github.com/sean-b-martin/dynamic-webforms-server/database"
+	"github.com/sean-b-martin/dynamic-webforms-server/mail"
+	"github.com/sean-b-martin/dynamic-webforms-server/middleware"
+	"github.com/sean-b-martin/dynamic-webforms-server/ratelimit"
+	"github.com/sean-b-martin/dynamic-webforms-server/service"
+	"github.com/sean-b-martin/dynamic-webforms-server/tracing"
+	"os"
+)
+
+// Config is read from config.json. The database settings are embedded, so they stay at the top level of the file.
+type Config struct {
+	database.ConnectionConfig
+	TrashRetentionDays     int    `json:"trashRetentionDays" validate:"min=0"`
+	DatabaseTimeoutSeconds int    `json:"databaseTimeoutSeconds" validate:"min=0"`
+	LogLevel               string `json:"logLevel" validate:"omitempty,oneof=debug info warn error"`
+	ShutdownDelaySeconds   int    `json:"shutdownDelaySeconds" validate:"min=0"`
+	// ProxyHeader is the header containing the client IP if the server runs behind a reverse proxy, e.g.
+	// X-Forwarded-For. The rate limits per IP would apply to all clients of the proxy together otherwise. The header
+	// is only read from requests of TrustedProxies, the IPs or CIDR ranges of the proxies.
+	ProxyHeader     string                    `json:"proxyHeader"`
+	TrustedProxies  []string                  `json:"trustedProxies" validate:"required_with=ProxyHeader,dive,ip|cidr"`
+	RateLimits      RateLimitConfig           `json:"rateLimits"`
+	PasswordHashing PasswordHashingConfig     `json:"passwordHashing"`
+	PasswordPolicy  auth.PasswordPolicyConfig `json:"passwordPolicy"`
+	Lockout         service.LockoutPolicy     `json:"lockout"`
+	Tracing         tracing.Config            `json:"tracing"`
+	Mail            MailConfig                `json:"mail"`
+	// TOTPIssuer is the name authenticator apps show next to the codes of the server.
+	TOTPIssuer string `json:"totpIssuer" validate:"required"`
+	// JWTSigningKey is the base64 encoded key of at least 64 bytes signing the tokens. All replicas of the server
+	// share it, so tokens and sessions are accepted by each of them and stay valid across restarts.
+	JWTSigningKey string `json:"jwtSigningKey" validate:"required,base64"`
+	// JWTAudience is the audience of the tokens issued by the server, which only accepts tokens for it. Servers of
+	// different clients sharing JWTSigningKey use different audiences.
+	JWTAudience string `json:"jwtAudience" validate:"required"`
+	// SessionCookie configures the session cookie browser apps may log in with instead of receiving the token.
+	SessionCookie middleware.SessionCookieConfig `json:"sessionCookie"`
+	// OIDC configures the single sign-on with an OpenID Connect provider, which is disabled without an issuer.
+	OIDC auth.OIDCConfig `json:"oidc"`
+}
+
+// MailConfig configures the emails sent to users. Without an SMTP host the emails are only logged. The URLs point
+// to the pages of the frontend completing a password reset or an email verification, {token} is replaced with the
+// token sent to the user.
+type MailConfig struct {
+	SMTP                 mail.SMTPConfig `json:"smtp"`
+	PasswordResetURL     string          `json:"passwordResetURL" validate:"required,url,contains={token}"`
+	EmailVerificationURL string          `json:"emailVerificationURL" validate:"required,url,contains={token}"`
+}
+
+// RateLimitConfig configures the throttling of the endpoints used without authentication. The database store
+// shares the limits between all replicas of the server.
+type RateLimitConfig struct {
+	Store            string          `json:"store" validate:"omitempty,oneof=memory database"`
+	LoginPerIP       ratelimit.Limit `json:"loginPerIP"`
+	LoginPerUsername ratelimit.Limit `json:"loginPerUsername"`
+	RegisterPerIP    ratelimit.Limit `json:"registerPerIP"`
+	// the password reset limits also prevent flooding the mailbox of a user with reset links
+	PasswordResetPerIP    ratelimit.Limit `json:"passwordResetPerIP"`
+	PasswordResetPerEmail ratelimit.Limit `json:"passwordResetPerEmail"`
+	// the limits of changing emails and resending verification links, which send emails as well
+	EmailPerUser    ratelimit.Limit `json:"emailPerUser"`
+	EmailPerAddress ratelimit.Limit `json:"emailPerAddress"`
+}
+
+// PasswordHashingConfig configures the Argon2id hashing of passwords. Peppers holds the base64 encoded peppers by
+// ID, new hashes use the pepper PepperID and the others are kept to verify hashes created before a rotation.
+type PasswordHashingConfig struct {
+	Argon2id auth.Argon2idParams `json:"argon2id"`
+	PepperID string              `json:"pepperID" validate:"required_with=Peppers"`
+	Peppers  map[string]string   `json:"peppers" validate:"omitempty,dive,base64"`
+}
+
+// newPasswordService creates the password service hashing with Argon2id. bcrypt hashes of existing users are still
+// verified and replaced on their next login.
+func newPasswordService(config PasswordHashingConfig) (*auth.PasswordService, error) {
+	var options []auth.Argon2idHasherOption
+	if config.PepperID != "" {
+		peppers := make(map[string][]byte, len(config.Peppers))
+		for id, pepper := range config.Peppers {
+			decoded, err := base64.StdEncoding.DecodeString(pepper)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding pepper %s: %w", id, err)
+			}
+			peppers[id] = decoded
+		}
+		options = append(options, auth.WithPeppers(config.PepperID, peppers))
+	}
+
+	argon2id, err := auth.NewArgon2idHasher(config.Argon2id, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	bcryptHasher, err := auth.NewBcryptHasher(auth.DefaultBcryptCost)
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.NewPasswordService(argon2id, bcryptHasher)
+}
+
+func loadConfig(path string) (Config, error) {
+	config := Config{
+		TrashRetentionDays:     30,
+		DatabaseTimeoutSeconds: 10,
+		ShutdownDelaySeconds:   5,
+		RateLimits: RateLimitConfig{
+			Store:                 ratelimit.StoreMemory,
+			LoginPerIP:            ratelimit.Limit{Requests: 20, WindowSeconds: 60},
+			LoginPerUsername:      ratelimit.Limit{Requests: 10, WindowSeconds: 15 * 60},
+			RegisterPerIP:         ratelimit.Limit{Requests: 5, WindowSeconds: 60 * 60},
+			PasswordResetPerIP:    ratelimit.Limit{Requests: 10, WindowSeconds: 60 * 60},
+			PasswordResetPerEmail: ratelimit.Limit{Requests: 3, WindowSeconds: 60 * 60},
+			EmailPerUser:          ratelimit.Limit{Requests: 5, WindowSeconds: 60 * 60},
+			EmailPerAddress:       ratelimit.Limit{Requests: 3, WindowSeconds: 60 * 60},
+		},
+		PasswordHashing: PasswordHashingConfig{Argon2id: auth.DefaultArgon2idParams},
+		PasswordPolicy:  auth.DefaultPasswordPolicyConfig,
+		Lockout:         service.LockoutPolicy{Threshold: 5, BaseSeconds: 60, MaxSeconds: 60 * 60},
+		Tracing:         tracing.Config{SampleRatio: 1},
+		TOTPIssuer:      "Dynamic Webforms",
+		JWTAudience:     "dynamic-webforms",
+		SessionCookie: middleware.SessionCookieConfig{Name: "session", Secure: true,
+			SameSite: fiber.CookieSameSiteStrictMode, AppURL: "http://localhost:3000/"},
+		Mail: MailConfig{
+			PasswordResetURL:     "http://localhost:3000/reset-password?token={token}",
+			EmailVerificationURL: "http://localhost:3000/verify-email?token={token}",
+		},
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	if err = json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+
+	if err = validator.New(validator.WithRequiredStructEnabled()).Struct(config); err != nil {
+		return config, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+
+	return config, nil
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/middleware"
+	"github.com/sean-b-martin/dynamic-webforms-server/service"
+)
+
+type APIKeyController struct {
+	service service.APIKeyService
+}
+
+// NewAPIKeyController registers the management of the API keys of the current user and of the tenant of the user,
+// which requires a login, so an API key cannot create further keys.
+func NewAPIKeyController(router fiber.Router, authMiddleware *middleware.JWTAuth, service service.APIKeyService) *APIKeyController {
+	controller := APIKeyController{service: service}
+	router.Use(authMiddleware.Handle())
+	router.Get("/", controller.GetAPIKeys)
+	router.Delete("/:apiKeyID", controller.DeleteAPIKey)
+	router.Post("/", middleware.AllowedContentTypeWithJSON(), controller.CreateAPIKey)
+
+	return &controller
+}
+
+func (a *APIKeyController) GetAPIKeys(ctx *fiber.Ctx) error {
+	keys, err := a.service.GetAPIKeys(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID))
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(keys)
+}
+
+// CreateAPIKey responds with the key, which is only shown once.
+func (a *APIKeyController) CreateAPIKey(ctx *fiber.Ctx) error {
+	var data requestDataCreateAPIKey
+	if err := parseAndValidateRequestData(ctx, nil, &data); err != nil {
+		return err
+	}
+
+	key, apiKey, err := a.service.CreateAPIKey(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID),
+		data.Name, data.Scopes, data.ExpiresAt, data.Tenant)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{"key": key, "apiKey": apiKey})
+}
+
+func (a *APIKeyController) DeleteAPIKey(ctx *fiber.Ctx) error {
+	var id requestPathAPIKeyID
+	if err := parseAndValidateRequestData(ctx, &id, nil); err != nil {
+		return err
+	}
+
+	if err := a.service.DeleteAPIKey(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID),
+		id.APIKeyID); err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(fiber.StatusOK)
+}
@@ -0,0 +1,1413 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/auth"
+	"github.com/sean-b-martin/dynamic-webforms-server/auth/oidctest"
+	"github.com/sean-b-martin/dynamic-webforms-server/database"
+	"github.com/sean-b-martin/dynamic-webforms-server/health"
+	"github.com/sean-b-martin/dynamic-webforms-server/logging"
+	"github.com/sean-b-martin/dynamic-webforms-server/mail"
+	"github.com/sean-b-martin/dynamic-webforms-server/middleware"
+	"github.com/sean-b-martin/dynamic-webforms-server/model"
+	"github.com/sean-b-martin/dynamic-webforms-server/ratelimit"
+	"github.com/sean-b-martin/dynamic-webforms-server/service"
+	"github.com/sean-b-martin/dynamic-webforms-server/service/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestPasswordService(t *testing.T) *auth.PasswordService {
+	argon2id, err := auth.NewArgon2idHasher(auth.Argon2idParams{Memory: 8 * 1024, Iterations: 1, Parallelism: 1})
+	require.NoError(t, err)
+	bcryptHasher, err := auth.NewBcryptHasher(bcrypt.MinCost)
+	require.NoError(t, err)
+	passwordService, err := auth.NewPasswordService(argon2id, bcryptHasher)
+	require.NoError(t, err)
+	return passwordService
+}
+
+// breachedTestPassword is the only password in the breached password list of the test app.
+const breachedTestPassword = "breached-password"
+
+func newTestPasswordPolicy(t *testing.T) *auth.PasswordPolicy {
+	sum := sha1.Sum([]byte(breachedTestPassword))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte(hash[5:]+":42\n"), 0o600))
+
+	config := auth.DefaultPasswordPolicyConfig
+	config.BreachedPasswordsDir = dir
+	policy, err := auth.NewPasswordPolicy(config)
+	require.NoError(t, err)
+	return policy
+}
+
+// recordingSender records the messages sent by the test app instead of sending them.
+type recordingSender struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (s *recordingSender) Send(_ context.Context, message mail.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, message)
+	return nil
+}
+
+// lastToken returns the token in the link of the last message sent to the address.
+func (s *recordingSender) lastToken(t *testing.T, to string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if s.messages[i].To == to {
+			match := regexp.MustCompile(`token=([\w-]+)`).FindStringSubmatch(s.messages[i].Body)
+			require.NotNil(t, match, s.messages[i].Body)
+			return match[1]
+		}
+	}
+
+	require.Fail(t, "no message sent to "+to)
+	return ""
+}
+
+func (s *recordingSender) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.messages)
+}
+
+// waitForCount waits until count messages were sent, for emails sent in the background.
+func (s *recordingSender) waitForCount(t *testing.T, count int) {
+	require.Eventually(t, func() bool { return s.count() >= count }, time.Second, time.Millisecond)
+}
+
+// testAppConfig configures the optional features of the test app, the OIDC login is registered unless oidc is nil.
+// With a database, the app stores all data in it and serves submissions as well.
+type testAppConfig struct {
+	store         *memory.Store
+	db            *bun.DB
+	mailer        mail.Sender
+	oidc          *auth.OIDCProvider
+	sessionCookie middleware.SessionCookieConfig
+	rateLimits    UserRateLimits
+}
+
+type testAppOption func(*testAppConfig)
+
+// withStore lets the test access the data of the app.
+func withStore(store *memory.Store) testAppOption {
+	return func(c *testAppConfig) { c.store = store }
+}
+
+// withMailer lets the test read the emails sent by the app.
+func withDatabase(db *bun.DB) testAppOption {
+	return func(c *testAppConfig) { c.db = db }
+}
+
+func withMailer(mailer mail.Sender) testAppOption {
+	return func(c *testAppConfig) { c.mailer = mailer }
+}
+
+func withOIDC(provider *auth.OIDCProvider) testAppOption {
+	return func(c *testAppConfig) { c.oidc = provider }
+}
+
+func withSessionCookie(sessionCookie middleware.SessionCookieConfig) testAppOption {
+	return func(c *testAppConfig) { c.sessionCookie = sessionCookie }
+}
+
+func withRateLimits(rateLimits UserRateLimits) testAppOption {
+	return func(c *testAppConfig) { c.rateLimits = rateLimits }
+}
+
+// newTestApp creates the app with an empty memory store and without rate limits, OIDC and session cookies unless
+// options configure them.
+func newTestApp(t *testing.T, options ...testAppOption) *fiber.App {
+	config := testAppConfig{store: memory.NewStore(), mailer: &recordingSender{}}
+	for _, option := range options {
+		option(&config)
+	}
+	var store service.Store = config.store
+	if config.db != nil {
+		store = service.NewDBStore(config.db)
+	}
+	jwtService, err := auth.NewJWTService()
+	require.NoError(t, err)
+	passwordService := newTestPasswordService(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: NewErrorHandler(logging.NewLogger(io.Discard, slog.LevelError))})
+	app.Use(middleware.RequestID())
+	if config.sessionCookie.Enabled {
+		app.Use(middleware.CSRF(config.sessionCookie))
+	}
+	apiKeyService := service.NewAPIKeyService(store)
+	sessionService := service.NewSessionService(store)
+	authMiddleware := middleware.NewJWTAuth(jwtService, apiKeyService, sessionService,
+		middleware.WithSessionCookie(config.sessionCookie))
+	userService := service.NewUserService(store, passwordService, newTestPasswordPolicy(t), jwtService, config.mailer,
+		service.UserServiceConfig{
+			Lockout:              service.LockoutPolicy{Threshold: 3, BaseSeconds: 60, MaxSeconds: 60},
+			PasswordResetURL:     "https://forms.example.com/reset-password?token={token}",
+			EmailVerificationURL: "https://forms.example.com/verify-email?token={token}",
+			TOTPIssuer:           "Webforms Test",
+		})
+	if config.oidc != nil {
+		NewOIDCController(app.Group("/users/oidc"), config.oidc, userService, nil, config.sessionCookie)
+	}
+	NewUserController(app.Group("/users"), authMiddleware, userService, sessionService, config.rateLimits, config.sessionCookie)
+	NewAPIKeyController(app.Group("/api-keys"), authMiddleware, apiKeyService)
+	NewSessionController(app.Group("/sessions"), authMiddleware, sessionService)
+	NewFormController(app.Group("/forms"), authMiddleware, service.NewFormService(store))
+	NewSchemaController(app.Group("/forms/:formID/"), authMiddleware, service.NewSchemaService(store))
+	if config.db != nil {
+		NewSubmissionController(app.Group("/forms/:formID/schemas/:schemaID/submissions"), authMiddleware,
+			service.NewSubmissionService(config.db))
+	}
+	return app
+}
+
+// newTestDatabase creates an empty SQLite database.
+func newTestDatabase(t *testing.T) *bun.DB {
+	db, err := database.CreateDatabaseConnection(database.ConnectionConfig{Driver: database.DriverSQLite,
+		Path: filepath.Join(t.TempDir(), "forms.db")})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	database.CreateTables(db)
+	return db
+}
+
+func doRequest(t *testing.T, app *fiber.App, method string, path string, token string, body interface{}, header http.Header) *http.Response {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	if token != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+
+	resp, err := app.Test(req, -1)
+	require.NoError(t, err)
+	return resp
+}
+
+func decodeResponse(t *testing.T, resp *http.Response, out interface{}) {
+	defer resp.Body.Close()
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+}
+
+func registerAndLogin(t *testing.T, app *fiber.App, username string) string {
+	user := fiber.Map{"username": username, "password": "password123"}
+	resp := doRequest(t, app, http.MethodPost, "/users/register", "", user, nil)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	return login(t, app, user)
+}
+
+func login(t *testing.T, app *fiber.App, user fiber.Map) string {
+	resp := doRequest(t, app, http.MethodPost, "/users/login", "", user, nil)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	decodeResponse(t, resp, &login)
+	require.NotEmpty(t, login.Token)
+	return login.Token
+}
+
+func createForm(t *testing.T, app *fiber.App, token string, body fiber.Map) model.FormModel {
+	resp := doRequest(t, app, http.MethodPost, "/forms/", token, body, nil)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	var forms []model.FormModel
+	decodeResponse(t, doRequest(t, app, http.MethodGet, "/forms/my-forms", token, nil, nil), &forms)
+	require.NotEmpty(t, forms)
+	return forms[0]
+}
+
+func ifMatch(etag string) http.Header {
+	return http.Header{fiber.HeaderIfMatch: {etag}}
+}
+
+func TestUserController_Login(t *testing.T) {
+	app := newTestApp(t)
+	token := registerAndLogin(t, app, "alice")
+
+	resp := doRequest(t, app, http.MethodPost, "/users/login", "",
+		fiber.Map{"username": "alice", "password": "wrong-password"}, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+
+	resp = doRequest(t, app, http.MethodGet, "/users/login", "", nil, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+
+	resp = doRequest(t, app, http.MethodGet, "/users/login", token, nil, nil)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var user struct {
+		Username string `json:"username"`
+	}
+	decodeResponse(t, resp, &user)
+	assert.Equal(t, "alice", user.Username)
+}
+
+func TestUserController_RegisterPasswordPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		password  string
+		wantRules []string
+	}{
+		{name: "valid password", password: "correct horse battery staple"},
+		{name: "too short", password: "x7#Kq", wantRules: []string{"min_length"}},
+		{name: "too short and weak", password: "aaaa", wantRules: []string{"min_length", "strength"}},
+		{name: "contains username", password: "my name is alice!", wantRules: []string{"contains_username"}},
+		{name: "repetitive", password: "aaaaaaaaaaaa", wantRules: []string{"strength"}},
+		{name: "sequence", password: "123456789", wantRules: []string{"strength"}},
+		{name: "breached", password: breachedTestPassword, wantRules: []string{"breached"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			resp := doRequest(t, app, http.MethodPost, "/users/register", "",
+				fiber.Map{"username": "alice", "password": tt.password}, nil)
+
+			if tt.wantRules == nil {
+				assert.Equal(t, fiber.StatusCreated, resp.StatusCode)
+				return
+			}
+
+			assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+			var p problem
+			decodeResponse(t, resp, &p)
+			assert.Equal(t, "password_policy_violated", p.Code)
+			rules := make([]string, len(p.Errors))
+			for i, e := range p.Errors {
+				assert.Equal(t, "password", e.Field)
+				assert.Nil(t, e.Value)
+				rules[i] = e.Failed.Constraint
+			}
+			assert.Equal(t, tt.wantRules, rules)
+		})
+	}
+}
+
+func TestUserController_UpdatePasswordPolicy(t *testing.T) {
+	app := newTestApp(t)
+	token := registerAndLogin(t, app, "alice")
+
+	resp := doRequest(t, app, http.MethodPatch, "/users/", token, fiber.Map{"password": "alice-password"}, nil)
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+
+	resp = doRequest(t, app, http.MethodPatch, "/users/", token, fiber.Map{"password": "new password 2026"}, nil)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
+
+func TestUserController_LoginRehash(t *testing.T) {
+	store := memory.NewStore()
+	app := newTestApp(t, withStore(store))
+
+	// users registered before Argon2id have bcrypt hashes
+	hash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user, err := store.Repositories().Users.InsertUser(context.Background(),
+		model.UserModel{Username: "alice", Password: string(hash)})
+	require.NoError(t, err)
+
+	credentials := fiber.Map{"username": "alice", "password": "password123"}
+	resp := doRequest(t, app, http.MethodPost, "/users/login", "", credentials, nil)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	user, err = store.Repositories().Users.GetUserByID(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(user.Password, "$argon2id$"), user.Password)
+
+	resp = doRequest(t, app, http.MethodPost, "/users/login", "", credentials, nil)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
+
+func TestUserController_LoginLockout(t *testing.T) {
+	app := newTestApp(t)
+	registerAndLogin(t, app, "alice")
+	wrong := fiber.Map{"username": "alice", "password": "wrong-password"}
+	correct := fiber.Map{"username": "alice", "password": "password123"}
+
+	// the test app locks accounts after three failed logins in a row
+	for i := 0; i < 3; i++ {
+		resp := doRequest(t, app, http.MethodPost, "/users/login", "", wrong, nil)
+		require.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+	}
+
+	// locked accounts cannot be told apart from unknown usernames
+	resp := doRequest(t, app, http.MethodPost, "/users/login", "", correct, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+	var p problem
+	decodeResponse(t, resp, &p)
+	assert.Equal(t, "invalid_credentials", p.Code)
+
+	// other accounts are not affected
+	registerAndLogin(t, app, "bob")
+}
+
+func TestUserController_EmailVerification(t *testing.T) {
+	mailer := &recordingSender{}
+	app := newTestApp(t, withMailer(mailer))
+	user := fiber.Map{"username": "alice", "password": "password123", "email": "Alice@Example.com"}
+	resp := doRequest(t, app, http.MethodPost, "/users/register", "", user, nil)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	firstToken := mailer.lastToken(t, "alice@example.com")
+
+	resp = doRequest(t, app, http.MethodPost, "/users/login", "", user, nil)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var login struct {
+		Token string `json:"token"`
+	}
+	decodeResponse(t, resp, &login)
+
+	var current struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"emailVerified"`
+	}
+	getCurrent := func() {
+		decodeResponse(t, doRequest(t, app, http.MethodGet, "/users/login", login.Token, nil, nil), &current)
+	}
+	getCurrent()
+	assert.Equal(t, "alice@example.com", current.Email)
+	assert.False(t, current.EmailVerified)
+
+	// unverified emails are not unique, registering does not reveal whether the email is used
+	bob := fiber.Map{"username": "bob", "password": "password123", "email": "alice@example.com"}
+	resp = doRequest(t, app, http.MethodPost, "/users/register", "", bob, nil)
+	assert.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	bobVerificationToken := mailer.lastToken(t, "alice@example.com")
+
+	// requesting a new link invalidates the first one
+	resp = doRequest(t, app, http.MethodPost, "/users/email/verification", login.Token, nil, nil)
+	require.Equal(t, fiber.StatusAccepted, resp.StatusCode)
+	secondToken := mailer.lastToken(t, "alice@example.com")
+	assert.NotEqual(t, firstToken, secondToken)
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{name: "invalidated token", token: firstToken, wantStatus: fiber.StatusBadRequest},
+		{name: "unknown token", token: "unknown", wantStatus: fiber.StatusBadRequest},
+		{name: "valid token", token: secondToken, wantStatus: fiber.StatusOK},
+		{name: "used token", token: secondToken, wantStatus: fiber.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, app, http.MethodPost, "/users/email/verify", "", fiber.Map{"token": tt.token}, nil)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+
+	getCurrent()
+	assert.True(t, current.EmailVerified)
+	resp = doRequest(t, app, http.MethodPost, "/users/email/verification", login.Token, nil, nil)
+	assert.Equal(t, fiber.StatusConflict, resp.StatusCode)
+
+	// verified emails are unique
+	resp = doRequest(t, app, http.MethodPost, "/users/email/verify", "", fiber.Map{"token": bobVerificationToken}, nil)
+	assert.Equal(t, fiber.StatusConflict, resp.StatusCode)
+
+	// changing the email requires the current password and a new verification
+	resp = doRequest(t, app, http.MethodPut, "/users/email", login.Token,
+		fiber.Map{"email": "alice@example.org", "password": "wrong-password"}, nil)
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+	resp = doRequest(t, app, http.MethodPut, "/users/email", login.Token,
+		fiber.Map{"email": "alice@example.org", "password": "password123"}, nil)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	getCurrent()
+	assert.Equal(t, "alice@example.org", current.Email)
+	assert.False(t, current.EmailVerified)
+
+	resp = doRequest(t, app, http.MethodPost, "/users/email/verify", "",
+		fiber.Map{"token": mailer.lastToken(t, "alice@example.org")}, nil)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
+
+func TestUserController_EmailRateLimits(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	app := newTestApp(t, withRateLimits(UserRateLimits{Email: []fiber.Handler{
+		middleware.RateLimit(store, "email-user", ratelimit.Limit{Requests: 3, WindowSeconds: 60}, middleware.KeyByUser),
+		middleware.RateLimit(store, "email-address", ratelimit.Limit{Requests: 1, WindowSeconds: 60},
+			middleware.KeyByEmail),
+	}}))
+	alice := registerAndLogin(t, app, "alice")
+	bob := registerAndLogin(t, app, "bob")
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       interface{}
+		wantStatus int
+	}{
+		{name: "change email", method: http.MethodPut, path: "/users/email", token: alice,
+			body: fiber.Map{"email": "alice@example.org", "password": "password123"}, wantStatus: fiber.StatusOK},
+		{name: "address limit", method: http.MethodPut, path: "/users/email", token: alice,
+			body: fiber.Map{"email": "Alice@example.org", "password": "password123"}, wantStatus: fiber.StatusTooManyRequests},
+		{name: "resend verification", method: http.MethodPost, path: "/users/email/verification", token: alice,
+			wantStatus: fiber.StatusAccepted},
+		{name: "user limit", method: http.MethodPost, path: "/users/email/verification", token: alice,
+			wantStatus: fiber.StatusTooManyRequests},
+		{name: "other user", method: http.MethodPut, path: "/users/email", token: bob,
+			body: fiber.Map{"email": "bob@example.org", "password": "password123"}, wantStatus: fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, app, tt.method, tt.path, tt.token, tt.body, nil)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+}
+
+func TestUserController_PasswordReset(t *testing.T) {
+	mailer := &recordingSender{}
+	store := memory.NewStore()
+	app := newTestApp(t, withStore(store), withMailer(mailer))
+	resp := doRequest(t, app, http.MethodPost, "/users/register", "",
+		fiber.Map{"username": "alice", "password": "password123", "email": "alice@example.com"}, nil)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	requestReset := func() {
+		resp := doRequest(t, app, http.MethodPost, "/users/password-reset", "", fiber.Map{"email": "alice@example.com"}, nil)
+		require.Equal(t, fiber.StatusAccepted, resp.StatusCode)
+	}
+
+	// reset links are neither sent to unknown nor to unverified emails
+	sent := mailer.count()
+	resp = doRequest(t, app, http.MethodPost, "/users/password-reset", "", fiber.Map{"email": "bob@example.com"}, nil)
+	assert.Equal(t, fiber.StatusAccepted, resp.StatusCode)
+	requestReset()
+	assert.Equal(t, sent, mailer.count())
+
+	resp = doRequest(t, app, http.MethodPost, "/users/email/verify", "",
+		fiber.Map{"token": mailer.lastToken(t, "alice@example.com")}, nil)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	sent = mailer.count()
+	requestReset()
+	mailer.waitForCount(t, sent+1)
+	token := mailer.lastToken(t, "alice@example.com")
+	sessionToken := login(t, app, fiber.Map{"username": "alice", "password": "password123"})
+
+	// a password violating the policy keeps the token valid
+	resp = doRequest(t, app, http.MethodPost, "/users/password-reset/confirm", "",
+		fiber.Map{"token": token, "password": breachedTestPassword}, nil)
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+
+	// the reset lifts a lock of the account
+	for i := 0; i < 3; i++ {
+		doRequest(t, app, http.MethodPost, "/users/login", "", fiber.Map{"username": "alice", "password": "wrong"}, nil)
+	}
+
+	resp = doRequest(t, app, http.MethodPost, "/users/password-reset/confirm", "",
+		fiber.Map{"token": token, "password": "new password 2026"}, nil)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	// the reset logs out all sessions
+	resp = doRequest(t, app, http.MethodGet, "/users/login", sessionToken, nil, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+	resp = doRequest(t, app, http.MethodPost, "/users/password-reset/confirm", "",
+		fiber.Map{"token": token, "password": "other password 2026"}, nil)
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	var p problem
+	decodeResponse(t, resp, &p)
+	assert.Equal(t, "invalid_token", p.Code)
+
+	resp = doRequest(t, app, http.MethodPost, "/users/login", "",
+		fiber.Map{"username": "alice", "password": "new password 2026"}, nil)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	// expired tokens are rejected
+	user, err := store.Repositories().Users.GetUserByUsername(context.Background(), "alice")
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte("expired-token"))
+	_, err = store.Repositories().Tokens.InsertToken(context.Background(), model.UserTokenModel{
+		UserID:    user.ID,
+		Purpose:   model.TokenPurposePasswordReset,
+		TokenHash: hex.EncodeToString(sum[:]),
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	require.NoError(t, err)
+	resp = doRequest(t, app, http.MethodPost, "/users/password-reset/confirm", "",
+		fiber.Map{"token": "expired-token", "password": "other password 2026"}, nil)
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+}
+
+func TestUserController_TwoFactor(t *testing.T) {
+	app := newTestApp(t)
+	token := registerAndLogin(t, app, "alice")
+	credentials := fiber.Map{"username": "alice", "password": "password123"}
+	totp := auth.NewTOTP("Webforms Test")
+
+	resp := doRequest(t, app, http.MethodPost, "/users/2fa", token, nil, nil)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	var enrollment struct {
+		Secret          string `json:"secret"`
+		ProvisioningURI string `json:"provisioningURI"`
+	}
+	decodeResponse(t, resp, &enrollment)
+	assert.Contains(t, enrollment.ProvisioningURI, "secret="+enrollment.Secret)
+
+	// the second factor is only required once the enrollment was confirmed with a code
+	login(t, app, credentials)
+	resp = doRequest(t, app, http.MethodPost, "/users/2fa/confirm", token, fiber.Map{"code": "000000"}, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+
+	now := time.Now()
+	code, err := totp.Code(enrollment.Secret, now)
+	require.NoError(t, err)
+	resp = doRequest(t, app, http.MethodPost, "/users/2fa/confirm", token, fiber.Map{"code": code}, nil)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var recovery struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	decodeResponse(t, resp, &recovery)
+	require.Len(t, recovery.RecoveryCodes, 10)
+
+	loginChallenge := func() string {
+		resp := doRequest(t, app, http.MethodPost, "/users/login", "", credentials, nil)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+		var challenge struct {
+			Token             string `json:"token"`
+			TwoFactorRequired bool   `json:"twoFactorRequired"`
+			ChallengeToken    string `json:"challengeToken"`
+		}
+		decodeResponse(t, resp, &challenge)
+		require.True(t, challenge.TwoFactorRequired)
+		require.Empty(t, challenge.Token)
+		return challenge.ChallengeToken
+	}
+	challenge := loginChallenge()
+
+	// challenges are no access tokens
+	resp = doRequest(t, app, http.MethodGet, "/users/login", challenge, nil, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+
+	nextCode, err := totp.Code(enrollment.Secret, now.Add(30*time.Second))
+	require.NoError(t, err)
+	tests := []struct {
+		name       string
+		challenge  string
+		code       string
+		wantStatus int
+	}{
+		{name: "invalid challenge", challenge: token, code: nextCode, wantStatus: fiber.StatusUnauthorized},
+		{name: "code used already", challenge: challenge, code: code, wantStatus: fiber.StatusUnauthorized},
+		{name: "valid code", challenge: challenge, code: nextCode, wantStatus: fiber.StatusOK},
+		{name: "recovery code", challenge: challenge, code: strings.ToUpper(recovery.RecoveryCodes[0]),
+			wantStatus: fiber.StatusOK},
+		{name: "recovery code used already", challenge: challenge, code: recovery.RecoveryCodes[0],
+			wantStatus: fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, app, http.MethodPost, "/users/login/2fa", "",
+				fiber.Map{"challengeToken": tt.challenge, "code": tt.code}, nil)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+
+	var current struct {
+		TwoFactorEnabled bool `json:"twoFactorEnabled"`
+	}
+	decodeResponse(t, doRequest(t, app, http.MethodGet, "/users/login", token, nil, nil), &current)
+	assert.True(t, current.TwoFactorEnabled)
+
+	// disabling requires a code as well
+	resp = doRequest(t, app, http.MethodDelete, "/users/2fa", token, fiber.Map{"code": recovery.RecoveryCodes[1]}, nil)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	login(t, app, credentials)
+}
+
+// oidcLogin logs in at the mock provider with the OIDC login of the test app and returns the callback response.
+func oidcLogin(t *testing.T, app *fiber.App, mock *oidctest.Provider) *http.Response {
+	resp := doRequest(t, app, http.MethodGet, "/users/oidc/login", "", nil, nil)
+	require.Equal(t, fiber.StatusFound, resp.StatusCode)
+	cookies := resp.Cookies()
+	require.Len(t, cookies, 1)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.Equal(t, "/users/oidc", cookies[0].Path)
+
+	callback, err := mock.Authorize(resp.Header.Get(fiber.HeaderLocation))
+	require.NoError(t, err)
+	return doRequest(t, app, http.MethodGet, callback.RequestURI(), "", nil,
+		http.Header{fiber.HeaderCookie: {cookies[0].Name + "=" + cookies[0].Value}})
+}
+
+func TestOIDCController(t *testing.T) {
+	mock := oidctest.NewProvider(t)
+	provider, err := auth.NewOIDCProvider(context.Background(), auth.OIDCConfig{IssuerURL: mock.Issuer(),
+		ClientID: oidctest.ClientID, RedirectURL: "http://localhost:3000/users/oidc/callback",
+		StateSecret: "0123456789abcdef0123456789abcdef"})
+	require.NoError(t, err)
+	mailer := &recordingSender{}
+	app := newTestApp(t, withMailer(mailer), withOIDC(provider))
+
+	type current struct {
+		ID            uuid.UUID `json:"id"`
+		Username      string    `json:"username"`
+		Email         string    `json:"email"`
+		EmailVerified bool      `json:"emailVerified"`
+	}
+	loginAs := func(t *testing.T, claims oidctest.Claims) current {
+		mock.SetUser(claims)
+		resp := oidcLogin(t, app, mock)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+		var login struct {
+			Token string `json:"token"`
+		}
+		decodeResponse(t, resp, &login)
+
+		var user current
+		decodeResponse(t, doRequest(t, app, http.MethodGet, "/users/login", login.Token, nil, nil), &user)
+		return user
+	}
+
+	// unknown identities are provisioned and log in as the same user afterwards
+	alice := loginAs(t, oidctest.Claims{Subject: "alice-id", Email: "Alice@Example.com", EmailVerified: true,
+		PreferredUsername: "alice"})
+	assert.Equal(t, current{ID: alice.ID, Username: "alice", Email: "alice@example.com", EmailVerified: true}, alice)
+	assert.Equal(t, alice, loginAs(t, oidctest.Claims{Subject: "alice-id", Email: "alice@example.org"}))
+
+	// provisioned users have no password
+	resp := doRequest(t, app, http.MethodPost, "/users/login", "",
+		fiber.Map{"username": "alice", "password": "password123"}, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+
+	// taken usernames get a suffix and unverified emails are not stored
+	other := loginAs(t, oidctest.Claims{Subject: "other-id", Email: "alice@example.net", PreferredUsername: "alice"})
+	assert.NotEqual(t, alice.ID, other.ID)
+	assert.Regexp(t, `^alice-[0-9a-f]{6}$`, other.Username)
+	assert.Empty(t, other.Email)
+
+	// identities are linked to users by verified emails
+	bobToken := registerAndLogin(t, app, "bob")
+	resp = doRequest(t, app, http.MethodPut, "/users/email", bobToken,
+		fiber.Map{"email": "bob@example.com", "password": "password123"}, nil)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	mock.SetUser(oidctest.Claims{Subject: "bob-id", Email: "bob@example.com", EmailVerified: true})
+	resp = oidcLogin(t, app, mock)
+	assert.Equal(t, fiber.StatusConflict, resp.StatusCode)
+
+	resp = doRequest(t, app, http.MethodPost, "/users/email/verify", "",
+		fiber.Map{"token": mailer.lastToken(t, "bob@example.com")}, nil)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	bob := loginAs(t, oidctest.Claims{Subject: "bob-id", Email: "bob@example.com", EmailVerified: true})
+	assert.Equal(t, "bob", bob.Username)
+
+	t.Run("invalid callback", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			query string
+		}{
+			{name: "provider error", query: "?error=access_denied"},
+			{name: "crafted provider error", query: "?error=call+support+at+evil.example"},
+			{name: "without login cookie", query: "?code=code&state=state"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				resp := doRequest(t, app, http.MethodGet, "/users/oidc/callback"+tt.query, "", nil, nil)
+				assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+				var p problem
+				decodeResponse(t, resp, &p)
+				assert.Equal(t, "oidc_login_failed", p.Code)
+				assert.NotContains(t, p.Detail, "evil.example")
+			})
+		}
+	})
+}
+
+var testSessionCookie = middleware.SessionCookieConfig{Enabled: true, Name: "session", Secure: true,
+	SameSite: fiber.CookieSameSiteStrictMode, AppURL: "https://forms.example.com/app"}
+
+func TestOIDCController_SessionCookie(t *testing.T) {
+	mock := oidctest.NewProvider(t)
+	provider, err := auth.NewOIDCProvider(context.Background(), auth.OIDCConfig{IssuerURL: mock.Issuer(),
+		ClientID: oidctest.ClientID, RedirectURL: "http://localhost:3000/users/oidc/callback",
+		StateSecret: "0123456789abcdef0123456789abcdef"})
+	require.NoError(t, err)
+	app := newTestApp(t, withOIDC(provider), withSessionCookie(testSessionCookie))
+	mock.SetUser(oidctest.Claims{Subject: "alice-id", Email: "alice@example.com", EmailVerified: true,
+		PreferredUsername: "alice"})
+	callbackCookies := func(resp *http.Response) map[string]string {
+		cookies := make(map[string]string)
+		for _, cookie := range resp.Cookies() {
+			cookies[cookie.Name] = cookie.Value
+		}
+		return cookies
+	}
+
+	// the browser is sent back to the app with the session cookie instead of receiving the token
+	resp := oidcLogin(t, app, mock)
+	require.Equal(t, fiber.StatusFound, resp.StatusCode)
+	assert.Equal(t, testSessionCookie.AppURL, resp.Header.Get(fiber.HeaderLocation))
+	cookies := callbackCookies(resp)
+	require.NotEmpty(t, cookies["session"])
+	require.NotEmpty(t, cookies[middleware.CSRFCookieName])
+	session := http.Header{
+		fiber.HeaderCookie: {"session=" + cookies["session"] + "; " + middleware.CSRFCookieName + "=" +
+			cookies[middleware.CSRFCookieName]},
+		middleware.CSRFHeader: {cookies[middleware.CSRFCookieName]},
+	}
+
+	resp = doRequest(t, app, http.MethodPost, "/users/2fa", "", nil, session)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	var enrollment struct {
+		Secret string `json:"secret"`
+	}
+	decodeResponse(t, resp, &enrollment)
+	code, err := auth.NewTOTP("Webforms Test").Code(enrollment.Secret, time.Now())
+	require.NoError(t, err)
+	resp = doRequest(t, app, http.MethodPost, "/users/2fa/confirm", "", fiber.Map{"code": code}, session)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	// users with a second factor get the challenge in the fragment of the redirect and no session yet
+	resp = oidcLogin(t, app, mock)
+	require.Equal(t, fiber.StatusFound, resp.StatusCode)
+	location, err := url.Parse(resp.Header.Get(fiber.HeaderLocation))
+	require.NoError(t, err)
+	assert.Empty(t, location.RawQuery)
+	fragment, err := url.ParseQuery(location.Fragment)
+	require.NoError(t, err)
+	assert.NotEmpty(t, fragment.Get("challengeToken"))
+	assert.NotContains(t, callbackCookies(resp), "session")
+}
+
+func TestUserController_SessionCookie(t *testing.T) {
+	app := newTestApp(t, withSessionCookie(testSessionCookie))
+	bearerToken := registerAndLogin(t, app, "alice")
+
+	resp := doRequest(t, app, http.MethodPost, "/users/login", "",
+		fiber.Map{"username": "alice", "password": "password123", "cookie": true}, nil)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var login map[string]string
+	decodeResponse(t, resp, &login)
+	assert.NotContains(t, login, "token")
+
+	cookies := make(map[string]*http.Cookie)
+	for _, cookie := range resp.Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	require.Contains(t, cookies, "session")
+	require.Contains(t, cookies, middleware.CSRFCookieName)
+	assert.True(t, cookies["session"].HttpOnly)
+	assert.True(t, cookies["session"].Secure)
+	assert.Equal(t, http.SameSiteStrictMode, cookies["session"].SameSite)
+	assert.False(t, cookies[middleware.CSRFCookieName].HttpOnly)
+	assert.Equal(t, login["csrfToken"], cookies[middleware.CSRFCookieName].Value)
+
+	cookieHeader := "session=" + cookies["session"].Value + "; " + middleware.CSRFCookieName + "=" + login["csrfToken"]
+	withCookies := func(csrfToken string) http.Header {
+		header := http.Header{fiber.HeaderCookie: {cookieHeader}}
+		if csrfToken != "" {
+			header.Set(middleware.CSRFHeader, csrfToken)
+		}
+		return header
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		header     http.Header
+		wantStatus int
+	}{
+		{name: "without CSRF token", header: withCookies(""), wantStatus: fiber.StatusForbidden},
+		{name: "invalid CSRF token", header: withCookies("invalid"), wantStatus: fiber.StatusForbidden},
+		{name: "valid CSRF token", header: withCookies(login["csrfToken"]), wantStatus: fiber.StatusCreated},
+		{name: "bearer token", token: bearerToken, header: withCookies(""), wantStatus: fiber.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, app, http.MethodPost, "/forms", tt.token, fiber.Map{"title": "Survey"}, tt.header)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+
+	// safe requests are not checked
+	resp = doRequest(t, app, http.MethodGet, "/users/login", "", nil, withCookies(""))
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	resp = doRequest(t, app, http.MethodPost, "/users/logout", "", nil, withCookies(login["csrfToken"]))
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	for _, cookie := range resp.Cookies() {
+		assert.Empty(t, cookie.Value)
+		assert.True(t, cookie.Expires.Before(time.Now()))
+	}
+	// the session of the cookie is revoked, not only the cookie cleared
+	resp = doRequest(t, app, http.MethodGet, "/users/login", "", nil, withCookies(""))
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+
+	// cookies are only issued if enabled
+	resp = doRequest(t, newTestApp(t), http.MethodPost, "/users/login", "",
+		fiber.Map{"username": "alice", "password": "password123", "cookie": true}, nil)
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+}
+
+func TestAPIKeyController(t *testing.T) {
+	app := newTestApp(t)
+	aliceToken := registerAndLogin(t, app, "alice")
+	bobToken := registerAndLogin(t, app, "bob")
+
+	createKey := func(t *testing.T, token string, body fiber.Map) *http.Response {
+		return doRequest(t, app, http.MethodPost, "/api-keys", token, body, nil)
+	}
+
+	resp := createKey(t, aliceToken, fiber.Map{"name": "export", "scopes": []string{auth.ScopeFormsRead}})
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	var created struct {
+		Key    string `json:"key"`
+		APIKey struct {
+			ID     uuid.UUID `json:"ID"`
+			Prefix string    `json:"prefix"`
+		} `json:"apiKey"`
+	}
+	decodeResponse(t, resp, &created)
+	assert.True(t, strings.HasPrefix(created.Key, created.APIKey.Prefix+"_"))
+	assert.True(t, strings.HasPrefix(created.Key, auth.APIKeyPrefix))
+
+	t.Run("invalid keys", func(t *testing.T) {
+		tests := []struct {
+			name string
+			body fiber.Map
+		}{
+			{name: "unknown scope", body: fiber.Map{"name": "key", "scopes": []string{"users:write"}}},
+			{name: "no scopes", body: fiber.Map{"name": "key", "scopes": []string{}}},
+			{name: "no name", body: fiber.Map{"scopes": []string{auth.ScopeFormsRead}}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				assert.Equal(t, fiber.StatusUnprocessableEntity, createKey(t, aliceToken, tt.body).StatusCode)
+			})
+		}
+
+		resp := createKey(t, aliceToken, fiber.Map{"name": "key", "scopes": []string{auth.ScopeFormsRead},
+			"expiresAt": time.Now().Add(-time.Hour)})
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("scopes", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			method     string
+			path       string
+			body       interface{}
+			wantStatus int
+		}{
+			{name: "granted scope", method: http.MethodGet, path: "/forms/my-forms", wantStatus: fiber.StatusOK},
+			{name: "missing scope", method: http.MethodPost, path: "/forms", body: fiber.Map{"title": "Survey"},
+				wantStatus: fiber.StatusForbidden},
+			{name: "account", method: http.MethodGet, path: "/users/login", wantStatus: fiber.StatusUnauthorized},
+			{name: "key management", method: http.MethodGet, path: "/api-keys", wantStatus: fiber.StatusUnauthorized},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				resp := doRequest(t, app, tt.method, tt.path, created.Key, tt.body, nil)
+				assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			})
+		}
+
+		resp := doRequest(t, app, http.MethodGet, "/forms/my-forms", created.Key[:len(created.Key)-1], nil, nil)
+		assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+	})
+
+	var keys []map[string]interface{}
+	decodeResponse(t, doRequest(t, app, http.MethodGet, "/api-keys", aliceToken, nil, nil), &keys)
+	require.Len(t, keys, 1)
+	assert.Equal(t, created.APIKey.Prefix, keys[0]["prefix"])
+	assert.NotNil(t, keys[0]["lastUsedAt"])
+	assert.NotContains(t, keys[0], "keyHash")
+
+	// keys are only deleted by their owner and stop working immediately
+	resp = doRequest(t, app, http.MethodDelete, "/api-keys/"+created.APIKey.ID.String(), bobToken, nil, nil)
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	resp = doRequest(t, app, http.MethodDelete, "/api-keys/"+created.APIKey.ID.String(), aliceToken, nil, nil)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	resp = doRequest(t, app, http.MethodGet, "/forms/my-forms", created.Key, nil, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestAPIKeyController_Tenant(t *testing.T) {
+	tests := []struct {
+		name  string
+		store func(t *testing.T) (service.Store, testAppOption)
+	}{
+		{name: "memory", store: func(t *testing.T) (service.Store, testAppOption) {
+			store := memory.NewStore()
+			return store, withStore(store)
+		}},
+		{name: "sqlite", store: func(t *testing.T) (service.Store, testAppOption) {
+			db := newTestDatabase(t)
+			return service.NewDBStore(db), withDatabase(db)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, option := tt.store(t)
+			app := newTestApp(t, option)
+			aliceToken := registerAndLogin(t, app, "alice")
+			bobToken := registerAndLogin(t, app, "bob")
+			carolToken := registerAndLogin(t, app, "carol")
+
+			// tenants are assigned in the database
+			ctx := context.Background()
+			for _, username := range []string{"alice", "bob"} {
+				user, err := store.Repositories().Users.GetUserByUsername(ctx, username)
+				require.NoError(t, err)
+				user.Tenant = "acme"
+				require.NoError(t, store.Repositories().Users.UpdateUser(ctx, user.ID, user, "tenant"))
+			}
+
+			body := fiber.Map{"name": "integration", "scopes": []string{auth.ScopeFormsRead}, "tenant": true}
+			resp := doRequest(t, app, http.MethodPost, "/api-keys", carolToken, body, nil)
+			assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+
+			resp = doRequest(t, app, http.MethodPost, "/api-keys", aliceToken, body, nil)
+			require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+			var created struct {
+				Key    string `json:"key"`
+				APIKey struct {
+					ID     uuid.UUID `json:"ID"`
+					Tenant string    `json:"tenant"`
+				} `json:"apiKey"`
+			}
+			decodeResponse(t, resp, &created)
+			assert.Equal(t, "acme", created.APIKey.Tenant)
+
+			// the key of the tenant is listed for all of its users
+			for _, list := range []struct {
+				token string
+				want  int
+			}{{token: aliceToken, want: 1}, {token: bobToken, want: 1}, {token: carolToken, want: 0}} {
+				var keys []map[string]interface{}
+				decodeResponse(t, doRequest(t, app, http.MethodGet, "/api-keys", list.token, nil, nil), &keys)
+				assert.Len(t, keys, list.want)
+			}
+
+			resp = doRequest(t, app, http.MethodGet, "/forms/my-forms", created.Key, nil, nil)
+			assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+			// any user of the tenant deletes the key, users of other tenants do not
+			resp = doRequest(t, app, http.MethodDelete, "/api-keys/"+created.APIKey.ID.String(), carolToken, nil, nil)
+			assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+			resp = doRequest(t, app, http.MethodDelete, "/api-keys/"+created.APIKey.ID.String(), bobToken, nil, nil)
+			require.Equal(t, fiber.StatusOK, resp.StatusCode)
+			resp = doRequest(t, app, http.MethodGet, "/forms/my-forms", created.Key, nil, nil)
+			assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+		})
+	}
+}
+
+func TestSessionController(t *testing.T) {
+	app := newTestApp(t)
+	user := fiber.Map{"username": "alice", "password": "password123"}
+	laptopToken := registerAndLogin(t, app, "alice")
+	resp := doRequest(t, app, http.MethodPost, "/users/login", "", user, http.Header{
+		fiber.HeaderUserAgent: []string{"phone"},
+	})
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var phoneLogin struct {
+		Token string `json:"token"`
+	}
+	decodeResponse(t, resp, &phoneLogin)
+	bobToken := registerAndLogin(t, app, "bob")
+
+	type session struct {
+		ID         uuid.UUID `json:"ID"`
+		UserAgent  string    `json:"userAgent"`
+		IP         string    `json:"ip"`
+		LastSeenAt time.Time `json:"lastSeenAt"`
+		Current    bool      `json:"current"`
+	}
+	var sessions []session
+	decodeResponse(t, doRequest(t, app, http.MethodGet, "/sessions", laptopToken, nil, nil), &sessions)
+	require.Len(t, sessions, 2)
+	var phone session
+	for _, s := range sessions {
+		assert.NotEmpty(t, s.IP)
+		assert.False(t, s.LastSeenAt.IsZero())
+		if s.UserAgent == "phone" {
+			phone = s
+			assert.False(t, s.Current)
+		} else {
+			assert.True(t, s.Current)
+		}
+	}
+	require.NotEqual(t, uuid.Nil, phone.ID)
+
+	// sessions are only revoked by their owner and their token is rejected immediately
+	tests := []struct {
+		name       string
+		token      string
+		path       string
+		wantStatus int
+	}{
+		{name: "other user", token: bobToken, path: "/sessions/" + phone.ID.String(),
+			wantStatus: fiber.StatusNotFound},
+		{name: "invalid ID", token: laptopToken, path: "/sessions/phone", wantStatus: fiber.StatusBadRequest},
+		{name: "owner", token: laptopToken, path: "/sessions/" + phone.ID.String(), wantStatus: fiber.StatusOK},
+		{name: "revoked", token: laptopToken, path: "/sessions/" + phone.ID.String(),
+			wantStatus: fiber.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, app, http.MethodDelete, tt.path, tt.token, nil, nil)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+
+	resp = doRequest(t, app, http.MethodGet, "/forms/my-forms", phoneLogin.Token, nil, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+	var p problem
+	decodeResponse(t, resp, &p)
+	assert.Equal(t, "session_revoked", p.Code)
+	resp = doRequest(t, app, http.MethodGet, "/forms/my-forms", laptopToken, nil, nil)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
+
+func TestFormController_UpdateForm(t *testing.T) {
+	app := newTestApp(t)
+	owner := registerAndLogin(t, app, "owner")
+	other := registerAndLogin(t, app, "other")
+	form := createForm(t, app, owner, fiber.Map{"title": "survey"})
+	formPath := "/forms/" + form.ID.String()
+
+	resp := doRequest(t, app, http.MethodGet, formPath, "", nil, nil)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get(fiber.HeaderETag)
+	assert.Equal(t, `"1"`, etag)
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		header     http.Header
+		wantStatus int
+	}{
+		{name: "no token", path: formPath, header: ifMatch(etag), wantStatus: fiber.StatusUnauthorized},
+		{name: "not owner", path: formPath, token: other, header: ifMatch(etag), wantStatus: fiber.StatusForbidden},
+		{name: "unknown form", path: "/forms/" + uuid.NewString(), token: owner, header: ifMatch(etag),
+			wantStatus: fiber.StatusNotFound},
+		{name: "missing If-Match", path: formPath, token: owner, wantStatus: fiber.StatusPreconditionRequired},
+		{name: "stale version", path: formPath, token: owner, header: ifMatch(`"2"`),
+			wantStatus: fiber.StatusPreconditionFailed},
+		{name: "owner", path: formPath, token: owner, header: ifMatch(etag), wantStatus: fiber.StatusOK},
+		{name: "version already updated", path: formPath, token: owner, header: ifMatch(etag),
+			wantStatus: fiber.StatusPreconditionFailed},
+		{name: "any version", path: formPath, token: owner, header: ifMatch("*"), wantStatus: fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, app, http.MethodPatch, tt.path, tt.token, fiber.Map{"title": "renamed"}, tt.header)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+
+	resp = doRequest(t, app, http.MethodGet, formPath, "", nil, nil)
+	assert.Equal(t, `"3"`, resp.Header.Get(fiber.HeaderETag))
+	decodeResponse(t, resp, &form)
+	assert.Equal(t, "renamed", form.Title)
+}
+
+func TestFormController_DeleteForm(t *testing.T) {
+	app := newTestApp(t)
+	owner := registerAndLogin(t, app, "owner")
+	other := registerAndLogin(t, app, "other")
+	form := createForm(t, app, owner, fiber.Map{
+		"title":         "survey",
+		"initialSchema": fiber.Map{"title": "v1", "version": "1.0.0", "schema": fiber.Map{"fields": []fiber.Map{}}},
+	})
+	formPath := "/forms/" + form.ID.String()
+
+	var schemas []model.FormSchemaModel
+	decodeResponse(t, doRequest(t, app, http.MethodGet, formPath+"/schemas", "", nil, nil), &schemas)
+	require.Len(t, schemas, 1)
+	assert.Equal(t, "v1", schemas[0].Title)
+
+	resp := doRequest(t, app, http.MethodDelete, formPath, other, nil, ifMatch("*"))
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+	resp = doRequest(t, app, http.MethodDelete, formPath, owner, nil, ifMatch(`"1"`))
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	resp = doRequest(t, app, http.MethodGet, formPath, "", nil, nil)
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+
+	resp = doRequest(t, app, http.MethodGet, formPath+"/"+schemas[0].ID.String(), "", nil, nil)
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+}
+
+func TestSchemaController(t *testing.T) {
+	app := newTestApp(t)
+	owner := registerAndLogin(t, app, "owner")
+	other := registerAndLogin(t, app, "other")
+	form := createForm(t, app, owner, fiber.Map{"title": "survey"})
+	formPath := "/forms/" + form.ID.String()
+	schema := fiber.Map{"title": "v1", "version": "1.0.0", "schema": fiber.Map{"fields": []fiber.Map{}}}
+
+	resp := doRequest(t, app, http.MethodPost, formPath+"/", other, schema, nil)
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+	resp = doRequest(t, app, http.MethodPost, "/forms/"+uuid.NewString()+"/", owner, schema, nil)
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+
+	resp = doRequest(t, app, http.MethodPost, formPath+"/", owner, schema, nil)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	var schemas []model.FormSchemaModel
+	decodeResponse(t, doRequest(t, app, http.MethodGet, formPath+"/schemas", "", nil, nil), &schemas)
+	require.Len(t, schemas, 1)
+	schemaPath := formPath + "/" + schemas[0].ID.String()
+
+	resp = doRequest(t, app, http.MethodPatch, schemaPath, other, fiber.Map{"readOnly": true}, ifMatch("*"))
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+	resp = doRequest(t, app, http.MethodPatch, schemaPath, owner, fiber.Map{"readOnly": true}, ifMatch(`"1"`))
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	resp = doRequest(t, app, http.MethodDelete, schemaPath, owner, nil, ifMatch(`"1"`))
+	assert.Equal(t, fiber.StatusPreconditionFailed, resp.StatusCode)
+
+	resp = doRequest(t, app, http.MethodGet, schemaPath, "", nil, nil)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	decodeResponse(t, resp, &schemas[0])
+	assert.True(t, schemas[0].ReadOnly)
+
+	resp = doRequest(t, app, http.MethodDelete, schemaPath, owner, nil, ifMatch(`"2"`))
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	resp = doRequest(t, app, http.MethodGet, schemaPath, "", nil, nil)
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+}
+
+func TestSubmissionController(t *testing.T) {
+	app := newTestApp(t, withDatabase(newTestDatabase(t)))
+	owner := registerAndLogin(t, app, "owner")
+	other := registerAndLogin(t, app, "other")
+	form := createForm(t, app, owner, fiber.Map{
+		"title":         "survey",
+		"initialSchema": fiber.Map{"title": "v1", "version": "1.0.0", "schema": fiber.Map{"fields": []fiber.Map{}}},
+	})
+	formPath := "/forms/" + form.ID.String()
+
+	var schemas []model.FormSchemaModel
+	decodeResponse(t, doRequest(t, app, http.MethodGet, formPath+"/schemas", "", nil, nil), &schemas)
+	require.Len(t, schemas, 1)
+	submissionsPath := formPath + "/schemas/" + schemas[0].ID.String() + "/submissions/"
+
+	resp := doRequest(t, app, http.MethodPost, submissionsPath, other, fiber.Map{"name": "answer", "data": fiber.Map{}},
+		nil)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	var submissions []model.FormDataModel
+	decodeResponse(t, doRequest(t, app, http.MethodGet, submissionsPath, owner, nil, nil), &submissions)
+	require.Len(t, submissions, 1)
+	submissionPath := submissionsPath + submissions[0].ID.String()
+
+	resp = doRequest(t, app, http.MethodGet, submissionPath, other, nil, nil)
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+	resp = doRequest(t, app, http.MethodGet, submissionsPath+uuid.NewString(), owner, nil, nil)
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+
+	resp = doRequest(t, app, http.MethodGet, submissionPath, owner, nil, nil)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get(fiber.HeaderETag)
+	assert.Equal(t, `"1"`, etag)
+
+	resp = doRequest(t, app, http.MethodDelete, submissionPath, owner, nil, ifMatch(etag))
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	resp = doRequest(t, app, http.MethodGet, submissionPath, owner, nil, nil)
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+}
+
+func TestErrorHandler(t *testing.T) {
+	app := newTestApp(t)
+	owner := registerAndLogin(t, app, "owner")
+	other := registerAndLogin(t, app, "other")
+	form := createForm(t, app, owner, fiber.Map{"title": "survey"})
+	formPath := "/forms/" + form.ID.String()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       interface{}
+		header     http.Header
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "not found", method: http.MethodGet, path: "/forms/" + uuid.NewString(),
+			wantStatus: fiber.StatusNotFound, wantCode: "not_found"},
+		{name: "no permission", method: http.MethodDelete, path: formPath, token: other, header: ifMatch("*"),
+			wantStatus: fiber.StatusForbidden, wantCode: "no_permission"},
+		{name: "unauthorized", method: http.MethodGet, path: "/forms/my-forms",
+			wantStatus: fiber.StatusUnauthorized, wantCode: "unauthorized"},
+		{name: "invalid credentials", method: http.MethodPost, path: "/users/login",
+			body:       fiber.Map{"username": "owner", "password": "wrong-password"},
+			wantStatus: fiber.StatusUnauthorized, wantCode: "invalid_credentials"},
+		{name: "username exists", method: http.MethodPost, path: "/users/register",
+			body:       fiber.Map{"username": "owner", "password": "password123"},
+			wantStatus: fiber.StatusConflict, wantCode: "username_exists"},
+		{name: "validation failed", method: http.MethodPost, path: "/forms/", token: owner, body: fiber.Map{"title": ""},
+			wantStatus: fiber.StatusUnprocessableEntity, wantCode: "validation_failed"},
+		{name: "invalid path", method: http.MethodGet, path: "/forms/not-a-uuid",
+			wantStatus: fiber.StatusBadRequest, wantCode: "invalid_path"},
+		{name: "If-Match required", method: http.MethodDelete, path: formPath, token: owner,
+			wantStatus: fiber.StatusPreconditionRequired, wantCode: "if_match_required"},
+		{name: "version mismatch", method: http.MethodDelete, path: formPath, token: owner, header: ifMatch(`"5"`),
+			wantStatus: fiber.StatusPreconditionFailed, wantCode: "version_mismatch"},
+		{name: "unknown route", method: http.MethodGet, path: "/unknown",
+			wantStatus: fiber.StatusNotFound, wantCode: "not_found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, app, tt.method, tt.path, tt.token, tt.body, tt.header)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, mimeApplicationProblemJSON, resp.Header.Get(fiber.HeaderContentType))
+
+			var p problem
+			decodeResponse(t, resp, &p)
+			assert.Equal(t, tt.wantStatus, p.Status)
+			assert.Equal(t, tt.wantCode, p.Code)
+			assert.NotEmpty(t, p.RequestID)
+			assert.Equal(t, resp.Header.Get(fiber.HeaderXRequestID), p.RequestID)
+		})
+	}
+}
+
+func TestHealthController(t *testing.T) {
+	tests := []struct {
+		name         string
+		checkErr     error
+		shuttingDown bool
+		wantStatus   int
+		wantBody     string
+	}{
+		{name: "ready", wantStatus: fiber.StatusOK, wantBody: "ok"},
+		{name: "check failed", checkErr: errors.New("connection refused"), wantStatus: fiber.StatusServiceUnavailable,
+			wantBody: "unavailable"},
+		{name: "shutting down", shuttingDown: true, wantStatus: fiber.StatusServiceUnavailable,
+			wantBody: "shutting_down"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := health.NewChecker()
+			checker.Add("database", func(context.Context) error { return tt.checkErr })
+			if tt.shuttingDown {
+				checker.SetShuttingDown()
+			}
+
+			app := fiber.New()
+			NewHealthController(app, checker, health.NewBuildInfo("1.0.0", "abc123"))
+
+			resp := doRequest(t, app, http.MethodGet, "/healthz", "", nil, nil)
+			assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+			resp = doRequest(t, app, http.MethodGet, "/readyz", "", nil, nil)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			var readiness responseReadiness
+			decodeResponse(t, resp, &readiness)
+			assert.Equal(t, tt.wantBody, readiness.Status)
+
+			var version responseVersion
+			decodeResponse(t, doRequest(t, app, http.MethodGet, "/version", "", nil, nil), &version)
+			assert.Equal(t, "1.0.0", version.Version)
+			assert.Equal(t, "abc123", version.Commit)
+		})
+	}
+}
+
+func TestUserController_Logout(t *testing.T) {
+	app := newTestApp(t)
+	user := fiber.Map{"username": "alice", "password": "password123"}
+	token := registerAndLogin(t, app, "alice")
+	otherToken := login(t, app, user)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "session", token: token},
+		{name: "revoked session", token: token},
+		{name: "without token", token: ""},
+		{name: "invalid token", token: "invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, app, http.MethodPost, "/users/logout", tt.token, nil, nil)
+			assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		})
+	}
+
+	// only the session of the logout ends
+	resp := doRequest(t, app, http.MethodGet, "/users/login", token, nil, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+	resp = doRequest(t, app, http.MethodGet, "/users/login", otherToken, nil, nil)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
+
+func TestUserController_UpdatePasswordSessions(t *testing.T) {
+	app := newTestApp(t)
+	user := fiber.Map{"username": "alice", "password": "password123"}
+	token := registerAndLogin(t, app, "alice")
+	otherToken := login(t, app, user)
+	bobToken := registerAndLogin(t, app, "bob")
+
+	resp := doRequest(t, app, http.MethodPatch, "/users/", token, fiber.Map{"password": "new password 2026"}, nil)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	// the other sessions of the user are logged out, the session of the change and other users are not
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{name: "session of the change", token: token, wantStatus: fiber.StatusOK},
+		{name: "other session", token: otherToken, wantStatus: fiber.StatusUnauthorized},
+		{name: "other user", token: bobToken, wantStatus: fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, app, http.MethodGet, "/users/login", tt.token, nil, nil)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+}
@@ -1,26 +1,107 @@
 package controller
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/log"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/sean-b-martin/dynamic-webforms-server/middleware"
 	"github.com/sean-b-martin/dynamic-webforms-server/service"
+	"github.com/sean-b-martin/dynamic-webforms-server/validation"
+	"log/slog"
+	"strings"
 )
 
-func handleServiceErr(ctx *fiber.Ctx, err error) error {
-	if err != nil {
-		return nil
+const mimeApplicationProblemJSON = "application/problem+json"
+
+// problem is an RFC 7807 problem details response. Code identifies the error and does not change, unlike the
+// human-readable title and detail.
+type problem struct {
+	Type      string                     `json:"type"`
+	Title     string                     `json:"title"`
+	Status    int                        `json:"status"`
+	Detail    string                     `json:"detail,omitempty"`
+	Instance  string                     `json:"instance"`
+	Code      string                     `json:"code"`
+	RequestID string                     `json:"requestID,omitempty"`
+	Errors    []validation.ErrorResponse `json:"errors,omitempty"`
+}
+
+// requestError is returned by the controllers for requests which are rejected before a service is called.
+type requestError struct {
+	status int
+	code   string
+	detail string
+	errors []validation.ErrorResponse
+}
+
+func (e *requestError) Error() string {
+	return e.detail
+}
+
+var serviceErrorStatus = map[service.ErrorKind]int{
+	service.KindNotFound:           fiber.StatusNotFound,
+	service.KindForbidden:          fiber.StatusForbidden,
+	service.KindUnauthorized:       fiber.StatusUnauthorized,
+	service.KindConflict:           fiber.StatusConflict,
+	service.KindPreconditionFailed: fiber.StatusPreconditionFailed,
+	service.KindValidation:         fiber.StatusBadRequest,
+	service.KindNotSupported:       fiber.StatusNotImplemented,
+	service.KindRateLimited:        fiber.StatusTooManyRequests,
+}
+
+// NewErrorHandler creates the fiber error handler writing all errors returned by handlers as problem details.
+// Internal errors are logged, as their details are not sent to the client.
+func NewErrorHandler(logger *slog.Logger) fiber.ErrorHandler {
+	return func(ctx *fiber.Ctx, err error) error {
+		p := newProblem(err)
+		p.Type = "about:blank"
+		p.Title = utils.StatusMessage(p.Status)
+		p.Instance = ctx.OriginalURL()
+		p.RequestID, _ = ctx.Locals(middleware.RequestIDLocal).(string)
+
+		if p.Status == fiber.StatusInternalServerError {
+			logger.ErrorContext(ctx.UserContext(), "request failed", "error", err)
+		}
+
+		return ctx.Status(p.Status).JSON(p, mimeApplicationProblemJSON)
 	}
+}
 
+func newProblem(err error) problem {
 	if errors.Is(err, sql.ErrNoRows) {
-		return ctx.SendStatus(fiber.StatusNotFound)
+		err = service.ErrNotFound
 	}
 
-	if errors.Is(err, service.ErrNoPermission) {
-		return ctx.SendStatus(fiber.StatusForbidden)
+	var serviceErr *service.Error
+	var reqErr *requestError
+	var fiberErr *fiber.Error
+
+	switch {
+	case errors.As(err, &serviceErr):
+		status, ok := serviceErrorStatus[serviceErr.Kind]
+		if !ok {
+			status = fiber.StatusInternalServerError
+		}
+		return problem{Status: status, Code: serviceErr.Code, Detail: err.Error(), Errors: serviceErr.Fields}
+	case errors.As(err, &reqErr):
+		return problem{Status: reqErr.status, Code: reqErr.code, Detail: reqErr.detail, Errors: reqErr.errors}
+	case errors.As(err, &fiberErr):
+		p := problem{Status: fiberErr.Code, Code: statusCode(fiberErr.Code)}
+		if fiberErr.Message != utils.StatusMessage(fiberErr.Code) {
+			p.Detail = fiberErr.Message
+		}
+		return p
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled):
+		return problem{Status: fiber.StatusServiceUnavailable, Code: "unavailable"}
+	default:
+		// messages of internal errors may contain details of the database
+		return problem{Status: fiber.StatusInternalServerError, Code: "internal_error"}
 	}
+}
 
-	log.Error(err.Error())
-	return ctx.SendStatus(fiber.StatusInternalServerError)
+// statusCode derives the error code of a status, e.g. unsupported_media_type.
+func statusCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(utils.StatusMessage(status)), " ", "_")
 }
@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sean-b-martin/dynamic-webforms-server/service"
+	"strconv"
+	"strings"
+)
+
+func setETag(ctx *fiber.Ctx, rowVersion int64) {
+	ctx.Set(fiber.HeaderETag, `"`+strconv.FormatInt(rowVersion, 10)+`"`)
+}
+
+// parseIfMatch returns the row version required by the If-Match header of a request. Modifying requests must
+// send the header, If-Match: * skips the version check.
+func parseIfMatch(ctx *fiber.Ctx) (int64, error) {
+	header := strings.TrimSpace(ctx.Get(fiber.HeaderIfMatch))
+	if header == "" {
+		return 0, &requestError{status: fiber.StatusPreconditionRequired, code: "if_match_required",
+			detail: "If-Match header is required"}
+	}
+
+	if header == "*" {
+		return service.AnyRowVersion, nil
+	}
+
+	// the ETag is strong, weak or multiple entity tags can never match
+	version, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(header, `"`), `"`), 10, 64)
+	if err != nil || version <= 0 || !strings.HasPrefix(header, `"`) || !strings.HasSuffix(header, `"`) {
+		return 0, service.ErrVersionMismatch
+	}
+
+	return version, nil
+}
@@ -3,7 +3,9 @@ package controller
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/auth"
 	"github.com/sean-b-martin/dynamic-webforms-server/middleware"
+	"github.com/sean-b-martin/dynamic-webforms-server/model"
 	"github.com/sean-b-martin/dynamic-webforms-server/service"
 )
 
@@ -13,20 +15,23 @@ type FormController struct {
 
 func NewFormController(router fiber.Router, authMiddleware *middleware.JWTAuth, service service.FormService) *FormController {
 	controller := FormController{service: service}
-	router.Get("/my-forms", authMiddleware.Handle(), controller.GetMyForms)
+	router.Get("/my-forms", authMiddleware.HandleWithAPIKeys(), middleware.RequireScope(auth.ScopeFormsRead),
+		controller.GetMyForms)
 	router.Get("/:formID", controller.GetForm)
 	router.Get("/", controller.GetForms)
-	router.Post("/", authMiddleware.Handle(), controller.CreateForm)
-	router.Patch("/:formID", authMiddleware.Handle(), controller.UpdateForm)
-	router.Delete("/:formID", authMiddleware.Handle(), controller.DeleteForm)
+	router.Post("/", authMiddleware.HandleWithAPIKeys(), middleware.RequireScope(auth.ScopeFormsWrite),
+		controller.CreateForm)
+	router.Patch("/:formID", authMiddleware.HandleWithAPIKeys(), middleware.RequireScope(auth.ScopeFormsWrite),
+		controller.UpdateForm)
+	router.Delete("/:formID", authMiddleware.HandleWithAPIKeys(), middleware.RequireScope(auth.ScopeFormsWrite),
+		controller.DeleteForm)
 	return &controller
 }
 
 func (c *FormController) GetForms(ctx *fiber.Ctx) error {
-	forms, err := c.service.GetForms()
-
+	forms, err := c.service.GetForms(ctx.UserContext())
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	if forms == nil {
@@ -38,22 +43,23 @@ func (c *FormController) GetForms(ctx *fiber.Ctx) error {
 
 func (c *FormController) GetForm(ctx *fiber.Ctx) error {
 	var formID requestPathFormID
-	if !parseAndValidateRequestData(ctx, &formID, nil) {
-		return nil
+	if err := parseAndValidateRequestData(ctx, &formID, nil); err != nil {
+		return err
 	}
 
-	form, err := c.service.GetForm(formID.FormID)
+	form, err := c.service.GetForm(ctx.UserContext(), formID.FormID)
 	if err != nil {
-		return handleServiceErr(ctx, err)
+		return err
 	}
 
+	setETag(ctx, form.RowVersion)
 	return ctx.Status(fiber.StatusOK).JSON(form)
 }
 
 func (c *FormController) GetMyForms(ctx *fiber.Ctx) error {
-	forms, err := c.service.GetFormsOfUser(ctx.Locals(middleware.UserIDLocal).(uuid.UUID))
+	forms, err := c.service.GetFormsOfUser(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID))
 	if err != nil {
-		return handleServiceErr(ctx, err)
+		return err
 	}
 
 	if forms == nil {
@@ -64,13 +70,24 @@ func (c *FormController) GetMyForms(ctx *fiber.Ctx) error {
 }
 
 func (c *FormController) CreateForm(ctx *fiber.Ctx) error {
-	var form requestDataTitle
-	if !parseAndValidateRequestData(ctx, nil, &form) {
-		return nil
+	var form requestDataCreateForm
+	if err := parseAndValidateRequestData(ctx, nil, &form); err != nil {
+		return err
+	}
+
+	var initialSchema *model.FormSchemaModel
+	if form.InitialSchema != nil {
+		initialSchema = &model.FormSchemaModel{
+			Title:    form.InitialSchema.Title,
+			Version:  form.InitialSchema.Version,
+			Schema:   form.InitialSchema.Schema,
+			ReadOnly: form.InitialSchema.ReadOnly,
+		}
 	}
 
-	if err := c.service.CreateForm(ctx.Locals(middleware.UserIDLocal).(uuid.UUID), form.Title); err != nil {
-		return handleServiceErr(ctx, err)
+	if err := c.service.CreateForm(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID),
+		form.Title, form.SubmissionsPerHour, initialSchema); err != nil {
+		return err
 	}
 
 	return ctx.SendStatus(fiber.StatusCreated)
@@ -78,14 +95,20 @@ func (c *FormController) CreateForm(ctx *fiber.Ctx) error {
 
 func (c *FormController) UpdateForm(ctx *fiber.Ctx) error {
 	var formID requestPathFormID
-	var form requestDataTitle
+	var form requestDataUpdateForm
 
-	if !parseAndValidateRequestData(ctx, &formID, &form) {
-		return nil
+	if err := parseAndValidateRequestData(ctx, &formID, &form); err != nil {
+		return err
 	}
 
-	if err := c.service.UpdateForm(ctx.Locals(middleware.UserIDLocal).(uuid.UUID), formID.FormID, form.Title); err != nil {
-		return handleServiceErr(ctx, err)
+	version, err := parseIfMatch(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := c.service.UpdateForm(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID),
+		formID.FormID, form.Title, form.SubmissionsPerHour, version); err != nil {
+		return err
 	}
 
 	return ctx.SendStatus(fiber.StatusOK)
@@ -93,12 +116,18 @@ func (c *FormController) UpdateForm(ctx *fiber.Ctx) error {
 
 func (c *FormController) DeleteForm(ctx *fiber.Ctx) error {
 	var formID requestPathFormID
-	if !parseAndValidateRequestData(ctx, nil, &formID) {
-		return nil
+	if err := parseAndValidateRequestData(ctx, &formID, nil); err != nil {
+		return err
+	}
+
+	version, err := parseIfMatch(ctx)
+	if err != nil {
+		return err
 	}
 
-	if err := c.service.DeleteForm(ctx.Locals(middleware.UserIDLocal).(uuid.UUID), formID.FormID); err != nil {
-		return handleServiceErr(ctx, err)
+	if err := c.service.DeleteForm(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID),
+		formID.FormID, version); err != nil {
+		return err
 	}
 
 	return ctx.SendStatus(fiber.StatusOK)
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sean-b-martin/dynamic-webforms-server/health"
+	"log/slog"
+	"time"
+)
+
+const readinessTimeout = 5 * time.Second
+
+type HealthController struct {
+	checker   *health.Checker
+	buildInfo health.BuildInfo
+}
+
+// NewHealthController registers the probes of orchestrators. They do not need authentication and should be
+// registered before the middlewares, so probes are neither logged nor traced.
+func NewHealthController(router fiber.Router, checker *health.Checker, buildInfo health.BuildInfo) *HealthController {
+	controller := HealthController{checker: checker, buildInfo: buildInfo}
+	router.Get("/healthz", controller.Healthz)
+	router.Get("/readyz", controller.Readyz)
+	router.Get("/version", controller.Version)
+
+	return &controller
+}
+
+type responseReadiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+type responseVersion struct {
+	Version       string    `json:"version"`
+	Commit        string    `json:"commit"`
+	StartedAt     time.Time `json:"startedAt"`
+	UptimeSeconds int64     `json:"uptimeSeconds"`
+}
+
+// Healthz reports that the process is alive and serving requests.
+func (h *HealthController) Healthz(ctx *fiber.Ctx) error {
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"status": "ok"})
+}
+
+// Readyz reports whether the server can handle requests. It fails during the graceful shutdown and if a check
+// fails, the errors of the checks are only logged as they may contain connection details.
+func (h *HealthController) Readyz(ctx *fiber.Ctx) error {
+	if h.checker.ShuttingDown() {
+		return ctx.Status(fiber.StatusServiceUnavailable).JSON(responseReadiness{Status: "shutting_down",
+			Checks: map[string]string{}})
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx.UserContext(), readinessTimeout)
+	defer cancel()
+
+	response := responseReadiness{Status: "ok", Checks: make(map[string]string)}
+	for name, err := range h.checker.Check(checkCtx) {
+		if err != nil {
+			slog.WarnContext(checkCtx, "readiness check failed", slog.String("check", name),
+				slog.Any("error", err))
+			response.Status = "unavailable"
+			response.Checks[name] = "failed"
+		} else {
+			response.Checks[name] = "ok"
+		}
+	}
+
+	status := fiber.StatusOK
+	if response.Status != "ok" {
+		status = fiber.StatusServiceUnavailable
+	}
+	return ctx.Status(status).JSON(response)
+}
+
+func (h *HealthController) Version(ctx *fiber.Ctx) error {
+	return ctx.Status(fiber.StatusOK).JSON(responseVersion{
+		Version:       h.buildInfo.Version,
+		Commit:        h.buildInfo.Commit,
+		StartedAt:     h.buildInfo.StartedAt,
+		UptimeSeconds: int64(time.Since(h.buildInfo.StartedAt).Seconds()),
+	})
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sean-b-martin/dynamic-webforms-server/auth"
+	"github.com/sean-b-martin/dynamic-webforms-server/middleware"
+	"github.com/sean-b-martin/dynamic-webforms-server/service"
+	"log/slog"
+	"net/url"
+	"path"
+	"time"
+)
+
+// oidcLoginCookie keeps the sealed state of a login between the redirect to the provider and the callback.
+const oidcLoginCookie = "oidc_login"
+
+type OIDCController struct {
+	provider      *auth.OIDCProvider
+	service       service.UserService
+	sessionCookie middleware.SessionCookieConfig
+}
+
+// NewOIDCController registers the login with provider. The callback sets the session cookie if it is enabled, as it
+// is opened by the browser, and redirects to the app.
+func NewOIDCController(router fiber.Router, provider *auth.OIDCProvider, userService service.UserService, rateLimits []fiber.Handler, sessionCookie middleware.SessionCookieConfig) *OIDCController {
+	controller := OIDCController{provider: provider, service: userService, sessionCookie: sessionCookie}
+	router.Get("/login", append(rateLimits, controller.StartLogin)...)
+	router.Get("/callback", append(rateLimits, controller.FinishLogin)...)
+
+	return &controller
+}
+
+// StartLogin redirects to the login page of the provider.
+func (o *OIDCController) StartLogin(ctx *fiber.Ctx) error {
+	authURL, sealedLogin, err := o.provider.StartLogin()
+	if err != nil {
+		return err
+	}
+
+	// the cookie is only sent to the callback next to the login endpoint, Lax is required as the callback is a
+	// cross-site navigation from the provider
+	ctx.Cookie(&fiber.Cookie{Name: oidcLoginCookie, Value: sealedLogin, Path: path.Dir(ctx.Path()),
+		Expires: time.Now().Add(10 * time.Minute), Secure: ctx.Protocol() == "https", HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode})
+	return ctx.Redirect(authURL, fiber.StatusFound)
+}
+
+// FinishLogin handles the redirect of the provider. With session cookies it sets the cookie and redirects to the app,
+// which reads the CSRF token from its cookie. Otherwise it responds like the password login.
+func (o *OIDCController) FinishLogin(ctx *fiber.Ctx) error {
+	sealedLogin := ctx.Cookies(oidcLoginCookie)
+	ctx.Cookie(&fiber.Cookie{Name: oidcLoginCookie, Path: path.Dir(ctx.Path()), Expires: time.Unix(0, 0),
+		HTTPOnly: true, SameSite: fiber.CookieSameSiteLaxMode})
+
+	// the error parameters are set by whoever crafted the callback URL, so they are logged instead of returned
+	if ctx.Query("error") != "" {
+		slog.WarnContext(ctx.UserContext(), "login at the identity provider failed",
+			slog.String("error", ctx.Query("error")), slog.String("description", ctx.Query("error_description")))
+		return &requestError{status: fiber.StatusUnauthorized, code: "oidc_login_failed",
+			detail: "login at the identity provider failed"}
+	}
+
+	identity, err := o.provider.FinishLogin(ctx.UserContext(), sealedLogin, ctx.Query("state"), ctx.Query("code"))
+	if errors.Is(err, auth.ErrOIDCLogin) {
+		return &requestError{status: fiber.StatusUnauthorized, code: "oidc_login_failed", detail: err.Error()}
+	} else if err != nil {
+		return err
+	}
+
+	result, err := o.service.LoginExternal(ctx.UserContext(), identity, clientInfo(ctx))
+	if err != nil {
+		return err
+	}
+
+	if !o.sessionCookie.Enabled {
+		return loginResponse(ctx, result, false, o.sessionCookie)
+	}
+
+	// the challenge token is passed in the fragment, which the browser does not send to any server
+	if result.ChallengeToken != "" {
+		return ctx.Redirect(o.sessionCookie.AppURL+"#"+url.Values{"challengeToken": {result.ChallengeToken}}.Encode(),
+			fiber.StatusFound)
+	}
+
+	if _, err := o.sessionCookie.SetSession(ctx, result.Token); err != nil {
+		return err
+	}
+
+	return ctx.Redirect(o.sessionCookie.AppURL, fiber.StatusFound)
+}
@@ -1,37 +1,52 @@
 package controller
 
 import (
+	"encoding/json"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/sean-b-martin/dynamic-webforms-server/validation"
+	"time"
 )
 
-func parseAndValidateRequestData(ctx *fiber.Ctx, paramsOut interface{}, bodyOut interface{}) bool {
+func parseAndValidateRequestData(ctx *fiber.Ctx, paramsOut interface{}, bodyOut interface{}) error {
 	if paramsOut != nil {
 		if err := ctx.ParamsParser(paramsOut); err != nil {
-			_ = ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
-			return false
+			return &requestError{status: fiber.StatusBadRequest, code: "invalid_path", detail: err.Error()}
 		}
 
-		if validationErrors := validation.Validate(paramsOut); len(validationErrors) > 0 {
-			_ = ctx.Status(fiber.StatusUnprocessableEntity).JSON(validationErrors)
-			return false
+		if err := validate(paramsOut); err != nil {
+			return err
 		}
 	}
 
 	if bodyOut != nil {
 		if err := ctx.BodyParser(bodyOut); err != nil {
-			_ = ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
-			return false
+			return &requestError{status: fiber.StatusBadRequest, code: "invalid_body", detail: err.Error()}
 		}
 
-		if validationErrors := validation.Validate(bodyOut); len(validationErrors) > 0 {
-			_ = ctx.Status(fiber.StatusUnprocessableEntity).JSON(validationErrors)
-			return false
+		if err := validate(bodyOut); err != nil {
+			return err
 		}
 	}
 
-	return true
+	return nil
+}
+
+func parseAndValidateQuery(ctx *fiber.Ctx, queryOut interface{}) error {
+	if err := ctx.QueryParser(queryOut); err != nil {
+		return &requestError{status: fiber.StatusBadRequest, code: "invalid_query", detail: err.Error()}
+	}
+
+	return validate(queryOut)
+}
+
+func validate(data interface{}) error {
+	if validationErrors := validation.Validate(data); len(validationErrors) > 0 {
+		return &requestError{status: fiber.StatusUnprocessableEntity, code: "validation_failed",
+			detail: "request validation failed", errors: validationErrors}
+	}
+
+	return nil
 }
 
 // definitions for path and request data
@@ -40,8 +55,9 @@ type requestDataUsername struct {
 	Username string `json:"username" validate:"required,min=3,max=32"`
 }
 
+// requestDataPassword only bounds the size of a password, new passwords are checked by the password policy.
 type requestDataPassword struct {
-	Password string `json:"password" validate:"required,min=8,max=72"`
+	Password string `json:"password" validate:"required,max=4096"`
 }
 
 type requestDataUser struct {
@@ -49,25 +65,103 @@ type requestDataUser struct {
 	requestDataPassword
 }
 
+// requestDataLogin sets Cookie to receive the token as session cookie.
+type requestDataLogin struct {
+	requestDataUser
+	Cookie bool `json:"cookie"`
+}
+
 type requestDataUpdateUser struct {
 	requestDataPassword
 }
 
+type requestDataEmail struct {
+	Email string `json:"email" validate:"required,email,max=254"`
+}
+
+type requestDataUpdateEmail struct {
+	requestDataEmail
+	requestDataPassword
+}
+
+type requestDataRegister struct {
+	requestDataUser
+	Email string `json:"email,omitempty" validate:"omitempty,email,max=254"`
+}
+
+type requestDataToken struct {
+	Token string `json:"token" validate:"required,max=256"`
+}
+
+// requestDataCode is a TOTP code or a recovery code.
+type requestDataCode struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+type requestDataVerifyTwoFactor struct {
+	ChallengeToken string `json:"challengeToken" validate:"required,max=4096"`
+	requestDataCode
+	Cookie bool `json:"cookie"`
+}
+
+type requestDataResetPassword struct {
+	requestDataToken
+	requestDataPassword
+}
+
+// requestDataCreateAPIKey lists the scopes of auth.Scopes, a key without expiry is valid until it is deleted. Keys
+// with Tenant are owned by the tenant of the user.
+type requestDataCreateAPIKey struct {
+	Name      string     `json:"name" validate:"required,min=1,max=64"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,oneof=forms:read forms:write submissions:read submissions:write"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Tenant    bool       `json:"tenant,omitempty"`
+}
+
 type requestDataTitle struct {
 	Title string `json:"title" validate:"required,min=1,max=256"`
 }
 
 type requestDataCreateSchema struct {
 	requestDataTitle
-	Version  string `json:"version" validate:"required,min=1,max=64"`
-	Schema   []byte `json:"schema"`
-	ReadOnly bool   `json:"readOnly"`
+	Version  string          `json:"version" validate:"required,min=1,max=64"`
+	Schema   json.RawMessage `json:"schema"`
+	ReadOnly bool            `json:"readOnly"`
+}
+
+type requestDataCreateForm struct {
+	requestDataTitle
+	SubmissionsPerHour int                      `json:"submissionsPerHour" validate:"min=0"`
+	InitialSchema      *requestDataCreateSchema `json:"initialSchema,omitempty"`
+}
+
+type requestDataUpdateForm struct {
+	requestDataTitle
+	SubmissionsPerHour *int `json:"submissionsPerHour,omitempty" validate:"omitempty,min=0"`
 }
 
 type requestDataUpdateSchema struct {
-	Title    *string `json:"title,omitempty" validate:"min=1,max=256"`
-	Schema   *[]byte `json:"schema,omitempty"`
-	ReadOnly *bool   `json:"readOnly,omitempty"`
+	Title    *string          `json:"title,omitempty" validate:"omitempty,min=1,max=256"`
+	Schema   *json.RawMessage `json:"schema,omitempty"`
+	ReadOnly *bool            `json:"readOnly,omitempty"`
+}
+
+type requestDataCreateSubmission struct {
+	Name string          `json:"name" validate:"required,min=1,max=64"`
+	Data json.RawMessage `json:"data" validate:"required"`
+}
+
+type requestQuerySubmissionFilter struct {
+	Filter []string `query:"filter" json:"filter" validate:"dive,required"`
+}
+
+type requestQuerySearch struct {
+	Query string `query:"q" json:"q" validate:"required,min=1,max=256"`
+	Limit int    `query:"limit" json:"limit" validate:"omitempty,min=1,max=100"`
+}
+
+type requestQueryStatistics struct {
+	Interval string `query:"interval" json:"interval" validate:"omitempty,oneof=day week month year"`
 }
 
 // path structs
@@ -80,7 +174,24 @@ type requestPathSchemaID struct {
 	SchemaID uuid.UUID `json:"schemaID" validate:"required,uuid"`
 }
 
+type requestPathSubmissionID struct {
+	SubmissionID uuid.UUID `json:"submissionID" validate:"required,uuid"`
+}
+
+type requestPathAPIKeyID struct {
+	APIKeyID uuid.UUID `json:"apiKeyID" validate:"required,uuid"`
+}
+
+type requestPathSessionID struct {
+	SessionID uuid.UUID `json:"sessionID" validate:"required,uuid"`
+}
+
 type requestPathFormAndSchemaID struct {
 	requestPathFormID
 	requestPathSchemaID
 }
+
+type requestPathFormSchemaAndSubmissionID struct {
+	requestPathFormAndSchemaID
+	requestPathSubmissionID
+}
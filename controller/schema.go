@@ -3,6 +3,7 @@ package controller
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/auth"
 	"github.com/sean-b-martin/dynamic-webforms-server/middleware"
 	"github.com/sean-b-martin/dynamic-webforms-server/model"
 	"github.com/sean-b-martin/dynamic-webforms-server/service"
@@ -16,22 +17,25 @@ func NewSchemaController(router fiber.Router, authMiddleware *middleware.JWTAuth
 	controller := SchemaController{service: service}
 	router.Get("/schemas", controller.GetFormSchemas)
 	router.Get("/:schemaID", controller.GetSchema)
-	router.Post("/", authMiddleware.Handle(), controller.CreateSchema)
-	router.Patch("/:schemaID", authMiddleware.Handle(), controller.UpdateSchema)
-	router.Delete("/:schemaID", authMiddleware.Handle(), controller.DeleteSchema)
+	router.Post("/", authMiddleware.HandleWithAPIKeys(), middleware.RequireScope(auth.ScopeFormsWrite),
+		controller.CreateSchema)
+	router.Patch("/:schemaID", authMiddleware.HandleWithAPIKeys(), middleware.RequireScope(auth.ScopeFormsWrite),
+		controller.UpdateSchema)
+	router.Delete("/:schemaID", authMiddleware.HandleWithAPIKeys(), middleware.RequireScope(auth.ScopeFormsWrite),
+		controller.DeleteSchema)
 
 	return &controller
 }
 
 func (s *SchemaController) GetFormSchemas(ctx *fiber.Ctx) error {
 	var formID requestPathFormID
-	if !parseAndValidateRequestData(ctx, &formID, nil) {
-		return nil
+	if err := parseAndValidateRequestData(ctx, &formID, nil); err != nil {
+		return err
 	}
 
-	schemas, err := s.service.GetSchemas(formID.FormID)
+	schemas, err := s.service.GetSchemas(ctx.UserContext(), formID.FormID)
 	if err != nil {
-		return handleServiceErr(ctx, err)
+		return err
 	}
 
 	if len(schemas) == 0 {
@@ -42,25 +46,28 @@ func (s *SchemaController) GetFormSchemas(ctx *fiber.Ctx) error {
 
 func (s *SchemaController) GetSchema(ctx *fiber.Ctx) error {
 	var ids requestPathFormAndSchemaID
-	if !parseAndValidateRequestData(ctx, &ids, nil) {
-		return nil
+	if err := parseAndValidateRequestData(ctx, &ids, nil); err != nil {
+		return err
 	}
 
-	schema, err := s.service.GetSchema(ids.FormID, ids.SchemaID)
+	schema, err := s.service.GetSchema(ctx.UserContext(), ids.FormID, ids.SchemaID)
 	if err != nil {
-		return handleServiceErr(ctx, err)
+		return err
 	}
+
+	setETag(ctx, schema.RowVersion)
 	return ctx.Status(fiber.StatusOK).JSON(schema)
 }
 
 func (s *SchemaController) CreateSchema(ctx *fiber.Ctx) error {
 	var formID requestPathFormID
 	var schemaData requestDataCreateSchema
-	if !parseAndValidateRequestData(ctx, &formID, &schemaData) {
-		return nil
+	if err := parseAndValidateRequestData(ctx, &formID, &schemaData); err != nil {
+		return err
 	}
 
-	err := s.service.CreateSchema(ctx.Locals(middleware.UserIDLocal).(uuid.UUID), formID.FormID, model.FormSchemaModel{
+	userID := ctx.Locals(middleware.UserIDLocal).(uuid.UUID)
+	err := s.service.CreateSchema(ctx.UserContext(), userID, formID.FormID, model.FormSchemaModel{
 		Title:    schemaData.Title,
 		Version:  schemaData.Version,
 		Schema:   schemaData.Schema,
@@ -68,7 +75,7 @@ func (s *SchemaController) CreateSchema(ctx *fiber.Ctx) error {
 	})
 
 	if err != nil {
-		return handleServiceErr(ctx, err)
+		return err
 	}
 
 	return ctx.SendStatus(fiber.StatusCreated)
@@ -77,8 +84,13 @@ func (s *SchemaController) CreateSchema(ctx *fiber.Ctx) error {
 func (s *SchemaController) UpdateSchema(ctx *fiber.Ctx) error {
 	var id requestPathFormAndSchemaID
 	var schema requestDataUpdateSchema
-	if !parseAndValidateRequestData(ctx, &id, &schema) {
-		return nil
+	if err := parseAndValidateRequestData(ctx, &id, &schema); err != nil {
+		return err
+	}
+
+	version, err := parseIfMatch(ctx)
+	if err != nil {
+		return err
 	}
 
 	schemaModel := make(map[string]interface{})
@@ -92,9 +104,9 @@ func (s *SchemaController) UpdateSchema(ctx *fiber.Ctx) error {
 		schemaModel["read_only"] = *schema.ReadOnly
 	}
 
-	err := s.service.UpdateSchema(ctx.Locals(middleware.UserIDLocal).(uuid.UUID), id.FormID, id.SchemaID, schemaModel)
-	if err != nil {
-		return handleServiceErr(ctx, err)
+	if err := s.service.UpdateSchema(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID),
+		id.FormID, id.SchemaID, schemaModel, version); err != nil {
+		return err
 	}
 
 	return ctx.SendStatus(fiber.StatusOK)
@@ -103,12 +115,18 @@ func (s *SchemaController) UpdateSchema(ctx *fiber.Ctx) error {
 func (s *SchemaController) DeleteSchema(ctx *fiber.Ctx) error {
 	var ids requestPathFormAndSchemaID
 
-	if !parseAndValidateRequestData(ctx, &ids, nil) {
-		return nil
+	if err := parseAndValidateRequestData(ctx, &ids, nil); err != nil {
+		return err
+	}
+
+	version, err := parseIfMatch(ctx)
+	if err != nil {
+		return err
 	}
 
-	if err := s.service.DeleteSchema(ctx.Locals(middleware.UserIDLocal).(uuid.UUID), ids.FormID, ids.SchemaID); err != nil {
-		return handleServiceErr(ctx, err)
+	if err := s.service.DeleteSchema(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID),
+		ids.FormID, ids.SchemaID, version); err != nil {
+		return err
 	}
 
 	return ctx.SendStatus(fiber.StatusOK)
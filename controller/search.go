@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/auth"
+	"github.com/sean-b-martin/dynamic-webforms-server/middleware"
+	"github.com/sean-b-martin/dynamic-webforms-server/service"
+)
+
+const defaultSearchLimit = 20
+
+type SearchController struct {
+	service service.SearchService
+}
+
+func NewSearchController(router fiber.Router, authMiddleware *middleware.JWTAuth, service service.SearchService) *SearchController {
+	controller := SearchController{service: service}
+	router.Get("/", authMiddleware.HandleWithAPIKeys(),
+		middleware.RequireScope(auth.ScopeFormsRead, auth.ScopeSubmissionsRead), controller.Search)
+
+	return &controller
+}
+
+// Search runs a full-text search over forms, schemas and submissions. The query parameter q supports the web
+// search syntax of Postgres, e.g. "customer feedback" -draft or "exact phrase".
+func (s *SearchController) Search(ctx *fiber.Ctx) error {
+	var query requestQuerySearch
+	if err := parseAndValidateQuery(ctx, &query); err != nil {
+		return err
+	}
+
+	if query.Limit == 0 {
+		query.Limit = defaultSearchLimit
+	}
+
+	results, err := s.service.Search(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID),
+		query.Query, query.Limit)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(results)
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/middleware"
+	"github.com/sean-b-martin/dynamic-webforms-server/model"
+	"github.com/sean-b-martin/dynamic-webforms-server/service"
+)
+
+type SessionController struct {
+	service service.SessionService
+}
+
+type responseSession struct {
+	model.SessionModel
+	// Current is set for the session of the request
+	Current bool `json:"current"`
+}
+
+// NewSessionController registers the management of the login sessions of the current user.
+func NewSessionController(router fiber.Router, authMiddleware *middleware.JWTAuth, service service.SessionService) *SessionController {
+	controller := SessionController{service: service}
+	router.Use(authMiddleware.Handle())
+	router.Get("/", controller.GetSessions)
+	router.Delete("/:sessionID", controller.RevokeSession)
+
+	return &controller
+}
+
+func (s *SessionController) GetSessions(ctx *fiber.Ctx) error {
+	sessions, err := s.service.GetSessions(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID))
+	if err != nil {
+		return err
+	}
+
+	currentID, _ := ctx.Locals(middleware.SessionIDLocal).(uuid.UUID)
+	response := make([]responseSession, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, responseSession{SessionModel: session, Current: session.ID == currentID})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(response)
+}
+
+// RevokeSession logs out the session, its token is rejected from then on.
+func (s *SessionController) RevokeSession(ctx *fiber.Ctx) error {
+	var id requestPathSessionID
+	if err := parseAndValidateRequestData(ctx, &id, nil); err != nil {
+		return err
+	}
+
+	if err := s.service.RevokeSession(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID),
+		id.SessionID); err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(fiber.StatusOK)
+}
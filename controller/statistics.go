@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/auth"
+	"github.com/sean-b-martin/dynamic-webforms-server/middleware"
+	"github.com/sean-b-martin/dynamic-webforms-server/service"
+)
+
+type StatisticsController struct {
+	service service.StatisticsService
+}
+
+func NewStatisticsController(router fiber.Router, authMiddleware *middleware.JWTAuth, service service.StatisticsService) *StatisticsController {
+	controller := StatisticsController{service: service}
+	router.Get("/", authMiddleware.HandleWithAPIKeys(), middleware.RequireScope(auth.ScopeSubmissionsRead),
+		controller.GetSchemaStatistics)
+
+	return &controller
+}
+
+func (s *StatisticsController) GetSchemaStatistics(ctx *fiber.Ctx) error {
+	var ids requestPathFormAndSchemaID
+	var query requestQueryStatistics
+	if err := parseAndValidateRequestData(ctx, &ids, nil); err != nil {
+		return err
+	}
+	if err := parseAndValidateQuery(ctx, &query); err != nil {
+		return err
+	}
+
+	if query.Interval == "" {
+		query.Interval = "day"
+	}
+
+	statistics, err := s.service.GetSchemaStatistics(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID),
+		ids.FormID, ids.SchemaID, query.Interval)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(statistics)
+}
@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/auth"
+	"github.com/sean-b-martin/dynamic-webforms-server/middleware"
+	"github.com/sean-b-martin/dynamic-webforms-server/model"
+	"github.com/sean-b-martin/dynamic-webforms-server/service"
+	"strings"
+)
+
+type SubmissionController struct {
+	service service.SubmissionService
+}
+
+func NewSubmissionController(router fiber.Router, authMiddleware *middleware.JWTAuth, service service.SubmissionService) *SubmissionController {
+	controller := SubmissionController{service: service}
+	router.Get("/", authMiddleware.HandleWithAPIKeys(), middleware.RequireScope(auth.ScopeSubmissionsRead),
+		controller.GetSubmissions)
+	router.Post("/", authMiddleware.HandleWithAPIKeys(), middleware.RequireScope(auth.ScopeSubmissionsWrite),
+		controller.CreateSubmission)
+	router.Get("/:submissionID", authMiddleware.HandleWithAPIKeys(),
+		middleware.RequireScope(auth.ScopeSubmissionsRead), controller.GetSubmission)
+	router.Delete("/:submissionID", authMiddleware.HandleWithAPIKeys(),
+		middleware.RequireScope(auth.ScopeSubmissionsWrite), controller.DeleteSubmission)
+
+	return &controller
+}
+
+// GetSubmissions lists the submissions of a schema. Submissions can be filtered by their answers with one or
+// more filter query parameters in the format field:operator:value, e.g. ?filter=country:eq:DE&filter=age:gt:30.
+func (s *SubmissionController) GetSubmissions(ctx *fiber.Ctx) error {
+	var ids requestPathFormAndSchemaID
+	var query requestQuerySubmissionFilter
+	if err := parseAndValidateRequestData(ctx, &ids, nil); err != nil {
+		return err
+	}
+	if err := parseAndValidateQuery(ctx, &query); err != nil {
+		return err
+	}
+
+	filters := make([]service.SubmissionFilter, len(query.Filter))
+	for i, filter := range query.Filter {
+		parts := strings.SplitN(filter, ":", 3)
+		if len(parts) != 3 {
+			return fmt.Errorf("%w: filter must be formatted as field:operator:value", service.ErrInvalidFilter)
+		}
+
+		filters[i] = service.SubmissionFilter{Field: parts[0], Operator: parts[1], Value: parts[2]}
+	}
+
+	submissions, err := s.service.GetSubmissions(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID),
+		ids.FormID, ids.SchemaID, filters)
+	if err != nil {
+		return err
+	}
+
+	if len(submissions) == 0 {
+		return ctx.Status(fiber.StatusOK).JSON([]struct{}{})
+	}
+	return ctx.Status(fiber.StatusOK).JSON(submissions)
+}
+
+// GetSubmission returns a submission with its row version as ETag, which DeleteSubmission expects in If-Match.
+func (s *SubmissionController) GetSubmission(ctx *fiber.Ctx) error {
+	var ids requestPathFormSchemaAndSubmissionID
+	if err := parseAndValidateRequestData(ctx, &ids, nil); err != nil {
+		return err
+	}
+
+	submission, err := s.service.GetSubmission(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID),
+		ids.FormID, ids.SchemaID, ids.SubmissionID)
+	if err != nil {
+		return err
+	}
+
+	setETag(ctx, submission.RowVersion)
+	return ctx.Status(fiber.StatusOK).JSON(submission)
+}
+
+func (s *SubmissionController) CreateSubmission(ctx *fiber.Ctx) error {
+	var ids requestPathFormAndSchemaID
+	var submission requestDataCreateSubmission
+	if err := parseAndValidateRequestData(ctx, &ids, &submission); err != nil {
+		return err
+	}
+
+	err := s.service.CreateSubmission(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID),
+		ids.FormID, ids.SchemaID, model.FormDataModel{Name: submission.Name, Data: submission.Data})
+	if err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(fiber.StatusCreated)
+}
+
+func (s *SubmissionController) DeleteSubmission(ctx *fiber.Ctx) error {
+	var ids requestPathFormSchemaAndSubmissionID
+	if err := parseAndValidateRequestData(ctx, &ids, nil); err != nil {
+		return err
+	}
+
+	version, err := parseIfMatch(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := s.service.DeleteSubmission(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID),
+		ids.FormID, ids.SchemaID, ids.SubmissionID, version); err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(fiber.StatusOK)
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/auth"
+	"github.com/sean-b-martin/dynamic-webforms-server/middleware"
+	"github.com/sean-b-martin/dynamic-webforms-server/service"
+)
+
+type TrashController struct {
+	service service.TrashService
+}
+
+func NewTrashController(router fiber.Router, authMiddleware *middleware.JWTAuth, service service.TrashService) *TrashController {
+	controller := TrashController{service: service}
+	router.Use(authMiddleware.HandleWithAPIKeys())
+	router.Get("/", middleware.RequireScope(auth.ScopeFormsRead, auth.ScopeSubmissionsRead), controller.GetTrash)
+	router.Post("/forms/:formID/restore", middleware.RequireScope(auth.ScopeFormsWrite), controller.RestoreForm)
+	router.Post("/forms/:formID/schemas/:schemaID/restore", middleware.RequireScope(auth.ScopeFormsWrite),
+		controller.RestoreSchema)
+	router.Post("/forms/:formID/schemas/:schemaID/submissions/:submissionID/restore",
+		middleware.RequireScope(auth.ScopeSubmissionsWrite), controller.RestoreSubmission)
+
+	return &controller
+}
+
+func (t *TrashController) GetTrash(ctx *fiber.Ctx) error {
+	items, err := t.service.GetTrash(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID))
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(items)
+}
+
+func (t *TrashController) RestoreForm(ctx *fiber.Ctx) error {
+	var formID requestPathFormID
+	if err := parseAndValidateRequestData(ctx, &formID, nil); err != nil {
+		return err
+	}
+
+	if err := t.service.RestoreForm(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID),
+		formID.FormID); err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+func (t *TrashController) RestoreSchema(ctx *fiber.Ctx) error {
+	var ids requestPathFormAndSchemaID
+	if err := parseAndValidateRequestData(ctx, &ids, nil); err != nil {
+		return err
+	}
+
+	if err := t.service.RestoreSchema(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID), ids.FormID,
+		ids.SchemaID); err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+func (t *TrashController) RestoreSubmission(ctx *fiber.Ctx) error {
+	var ids requestPathFormSchemaAndSubmissionID
+	if err := parseAndValidateRequestData(ctx, &ids, nil); err != nil {
+		return err
+	}
+
+	if err := t.service.RestoreSubmission(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID),
+		ids.FormID, ids.SchemaID, ids.SubmissionID); err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(fiber.StatusOK)
+}
@@ -8,61 +8,160 @@ import (
 	"github.com/sean-b-martin/dynamic-webforms-server/middleware"
 	"github.com/sean-b-martin/dynamic-webforms-server/model"
 	"github.com/sean-b-martin/dynamic-webforms-server/service"
+	"slices"
 )
 
 type UserController struct {
-	service service.UserService
+	service       service.UserService
+	sessions      service.SessionService
+	sessionCookie middleware.SessionCookieConfig
 }
 
-func NewUserController(router fiber.Router, authMiddleware *middleware.JWTAuth, userService service.UserService) *UserController {
-	controller := UserController{service: userService}
+// UserRateLimits are the middlewares throttling the endpoints used without authentication and the endpoints sending
+// emails. The Email limits run after the authentication.
+type UserRateLimits struct {
+	Login         []fiber.Handler
+	Register      []fiber.Handler
+	PasswordReset []fiber.Handler
+	Email         []fiber.Handler
+}
+
+func NewUserController(router fiber.Router, authMiddleware *middleware.JWTAuth, userService service.UserService, sessionService service.SessionService, rateLimits UserRateLimits, sessionCookie middleware.SessionCookieConfig) *UserController {
+	controller := UserController{service: userService, sessions: sessionService, sessionCookie: sessionCookie}
 	router.Get("/login", authMiddleware.Handle(), controller.GetCurrentLogin)
 	router.Delete("/", authMiddleware.Handle(), controller.DeleteUser)
+	router.Post("/email/verification", slices.Concat([]fiber.Handler{authMiddleware.Handle()}, rateLimits.Email,
+		[]fiber.Handler{controller.SendEmailVerification})...)
+	router.Post("/2fa", authMiddleware.Handle(), controller.EnrollTwoFactor)
+	router.Post("/logout", authMiddleware.HandleOptional(), controller.Logout)
 
 	router.Use(middleware.AllowedContentTypeWithJSON())
-	router.Post("/register", controller.RegisterUser)
-	router.Post("/login", controller.LoginUser)
+	router.Post("/register", append(rateLimits.Register, controller.RegisterUser)...)
+	router.Post("/login", append(rateLimits.Login, controller.LoginUser)...)
+	router.Post("/login/2fa", append(rateLimits.Login, controller.VerifyTwoFactor)...)
 	router.Patch("/", authMiddleware.Handle(), controller.UpdateUser)
+	router.Put("/email", slices.Concat([]fiber.Handler{authMiddleware.Handle()}, rateLimits.Email,
+		[]fiber.Handler{controller.UpdateEmail})...)
+	router.Post("/email/verify", controller.VerifyEmail)
+	router.Post("/password-reset", append(rateLimits.PasswordReset, controller.RequestPasswordReset)...)
+	router.Post("/password-reset/confirm", controller.ResetPassword)
+	router.Post("/2fa/confirm", authMiddleware.Handle(), controller.ConfirmTwoFactor)
+	router.Post("/2fa/recovery-codes", authMiddleware.Handle(), controller.RegenerateRecoveryCodes)
+	router.Delete("/2fa", authMiddleware.Handle(), controller.DisableTwoFactor)
 
 	return &controller
 }
 
 func (u *UserController) GetCurrentLogin(ctx *fiber.Ctx) error {
-	user, err := u.service.GetUserById(ctx.Locals(middleware.UserIDLocal).(uuid.UUID))
+	user, err := u.service.GetUserById(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID))
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"id": user.ID, "username": user.Username, "email": user.Email,
+		"emailVerified": user.EmailVerifiedAt != nil, "twoFactorEnabled": user.TOTPEnabledAt != nil,
+		"roles": user.Roles, "tenant": user.Tenant})
+}
+
+func (u *UserController) LoginUser(ctx *fiber.Ctx) error {
+	var user requestDataLogin
+	if err := parseAndValidateRequestData(ctx, nil, &user); err != nil {
+		return err
+	}
+
+	if err := checkCookieLogin(user.Cookie, u.sessionCookie); err != nil {
+		return err
+	}
+
+	result, err := u.service.LoginUser(ctx.UserContext(),
+		model.UserModel{Username: user.Username, Password: user.Password}, clientInfo(ctx))
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user was deleted"})
+		return err
+	}
+
+	return loginResponse(ctx, result, user.Cookie, u.sessionCookie)
+}
+
+func checkCookieLogin(cookie bool, sessionCookie middleware.SessionCookieConfig) error {
+	if cookie && !sessionCookie.Enabled {
+		return &requestError{status: fiber.StatusBadRequest, code: "session_cookie_disabled",
+			detail: "session cookies are not enabled"}
+	}
+
+	return nil
+}
+
+// clientInfo describes the client of a login for its session.
+func clientInfo(ctx *fiber.Ctx) service.ClientInfo {
+	return service.ClientInfo{UserAgent: ctx.Get(fiber.HeaderUserAgent), IP: ctx.IP()}
+}
+
+// loginResponse returns the access token of a login or the challenge token of users with two-factor authentication.
+// If cookie is set, the access token is set as session cookie instead and the CSRF token is returned.
+func loginResponse(ctx *fiber.Ctx, result service.LoginResult, cookie bool, sessionCookie middleware.SessionCookieConfig) error {
+	if result.ChallengeToken != "" {
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"twoFactorRequired": true,
+			"challengeToken": result.ChallengeToken})
+	}
+
+	if cookie {
+		csrfToken, err := sessionCookie.SetSession(ctx, result.Token)
+		if err != nil {
+			return err
 		}
 
-		return fiber.NewError(fiber.StatusInternalServerError, "an error has occurred")
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"csrfToken": csrfToken})
 	}
 
-	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"id": user.ID, "username": user.Username})
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"token": result.Token})
 }
 
-func (u *UserController) LoginUser(ctx *fiber.Ctx) error {
-	var user requestDataUser
-	if !parseAndValidateRequestData(ctx, nil, &user) {
-		return nil
+// Logout revokes the session of the request and clears the session cookie. Requests without a valid token are
+// logged out as well, so a client can always clear its cookie.
+func (u *UserController) Logout(ctx *fiber.Ctx) error {
+	if sessionID, ok := ctx.Locals(middleware.SessionIDLocal).(uuid.UUID); ok {
+		// the session is gone already if it was revoked or expired
+		err := u.sessions.RevokeSession(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID), sessionID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
 	}
 
-	token, err := u.service.LoginUser(model.UserModel{Username: user.Username, Password: user.Password})
+	if u.sessionCookie.Enabled {
+		u.sessionCookie.ClearSession(ctx)
+	}
+
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+func (u *UserController) VerifyTwoFactor(ctx *fiber.Ctx) error {
+	var data requestDataVerifyTwoFactor
+	if err := parseAndValidateRequestData(ctx, nil, &data); err != nil {
+		return err
+	}
+
+	if err := checkCookieLogin(data.Cookie, u.sessionCookie); err != nil {
+		return err
+	}
+
+	token, err := u.service.VerifyTwoFactor(ctx.UserContext(), data.ChallengeToken, data.Code, clientInfo(ctx))
 	if err != nil {
-		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid username or password"})
+		return err
 	}
 
-	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"token": token})
+	return loginResponse(ctx, service.LoginResult{Token: token}, data.Cookie, u.sessionCookie)
 }
 
 func (u *UserController) RegisterUser(ctx *fiber.Ctx) error {
-	var user requestDataUser
-	if !parseAndValidateRequestData(ctx, nil, &user) {
-		return nil
+	var user requestDataRegister
+	if err := parseAndValidateRequestData(ctx, nil, &user); err != nil {
+		return err
 	}
 
-	if err := u.service.RegisterUser(model.UserModel{
+	if err := u.service.RegisterUser(ctx.UserContext(), model.UserModel{
 		Username: user.Username,
 		Password: user.Password,
+		Email:    user.Email,
 	}); err != nil {
 		return err
 	}
@@ -72,28 +171,138 @@ func (u *UserController) RegisterUser(ctx *fiber.Ctx) error {
 
 func (u *UserController) UpdateUser(ctx *fiber.Ctx) error {
 	var user requestDataUpdateUser
-	if !parseAndValidateRequestData(ctx, nil, &user) {
-		return nil
+	if err := parseAndValidateRequestData(ctx, nil, &user); err != nil {
+		return err
 	}
 
-	if err := u.service.UpdateUser(ctx.Locals(middleware.UserIDLocal).(uuid.UUID), user.Password); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return fiber.ErrNotFound
-		}
-
-		return fiber.ErrInternalServerError
+	if err := u.service.UpdateUser(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID),
+		ctx.Locals(middleware.SessionIDLocal).(uuid.UUID), user.Password); err != nil {
+		return err
 	}
 
 	return ctx.SendStatus(fiber.StatusOK)
 }
 
 func (u *UserController) DeleteUser(ctx *fiber.Ctx) error {
-	if err := u.service.DeleteUser(ctx.Locals(middleware.UserIDLocal).(uuid.UUID)); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return fiber.ErrNotFound
-		}
+	if err := u.service.DeleteUser(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID)); err != nil {
+		return err
+	}
 
-		return fiber.ErrBadRequest
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+func (u *UserController) UpdateEmail(ctx *fiber.Ctx) error {
+	var data requestDataUpdateEmail
+	if err := parseAndValidateRequestData(ctx, nil, &data); err != nil {
+		return err
+	}
+
+	if err := u.service.UpdateEmail(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID),
+		data.Password, data.Email); err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+func (u *UserController) SendEmailVerification(ctx *fiber.Ctx) error {
+	if err := u.service.SendEmailVerification(ctx.UserContext(),
+		ctx.Locals(middleware.UserIDLocal).(uuid.UUID)); err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(fiber.StatusAccepted)
+}
+
+func (u *UserController) VerifyEmail(ctx *fiber.Ctx) error {
+	var data requestDataToken
+	if err := parseAndValidateRequestData(ctx, nil, &data); err != nil {
+		return err
+	}
+
+	if err := u.service.VerifyEmail(ctx.UserContext(), data.Token); err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+// RequestPasswordReset responds with 202 Accepted for unknown emails as well.
+func (u *UserController) RequestPasswordReset(ctx *fiber.Ctx) error {
+	var data requestDataEmail
+	if err := parseAndValidateRequestData(ctx, nil, &data); err != nil {
+		return err
+	}
+
+	if err := u.service.RequestPasswordReset(ctx.UserContext(), data.Email); err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(fiber.StatusAccepted)
+}
+
+func (u *UserController) ResetPassword(ctx *fiber.Ctx) error {
+	var data requestDataResetPassword
+	if err := parseAndValidateRequestData(ctx, nil, &data); err != nil {
+		return err
+	}
+
+	if err := u.service.ResetPassword(ctx.UserContext(), data.Token, data.Password); err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+func (u *UserController) EnrollTwoFactor(ctx *fiber.Ctx) error {
+	enrollment, err := u.service.EnrollTwoFactor(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID))
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{"secret": enrollment.Secret,
+		"provisioningURI": enrollment.ProvisioningURI})
+}
+
+func (u *UserController) ConfirmTwoFactor(ctx *fiber.Ctx) error {
+	var data requestDataCode
+	if err := parseAndValidateRequestData(ctx, nil, &data); err != nil {
+		return err
+	}
+
+	codes, err := u.service.ConfirmTwoFactor(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID),
+		data.Code)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"recoveryCodes": codes})
+}
+
+func (u *UserController) RegenerateRecoveryCodes(ctx *fiber.Ctx) error {
+	var data requestDataCode
+	if err := parseAndValidateRequestData(ctx, nil, &data); err != nil {
+		return err
+	}
+
+	codes, err := u.service.RegenerateRecoveryCodes(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID),
+		data.Code)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"recoveryCodes": codes})
+}
+
+func (u *UserController) DisableTwoFactor(ctx *fiber.Ctx) error {
+	var data requestDataCode
+	if err := parseAndValidateRequestData(ctx, nil, &data); err != nil {
+		return err
+	}
+
+	if err := u.service.DisableTwoFactor(ctx.UserContext(), ctx.Locals(middleware.UserIDLocal).(uuid.UUID),
+		data.Code); err != nil {
+		return err
 	}
 
 	return ctx.SendStatus(fiber.StatusOK)
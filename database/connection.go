@@ -2,21 +2,41 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
 	"github.com/uptrace/bun/driver/pgdriver"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// ConnectionConfig configures the database connection. Postgres is used unless the driver is sqlite, which
+// only needs the path of the database file.
 type ConnectionConfig struct {
-	Host     string `json:"host" validate:"required"`
+	Driver   string `json:"driver" validate:"omitempty,oneof=postgres sqlite"`
+	Host     string `json:"host" validate:"required_unless=Driver sqlite"`
 	Port     int    `json:"port"`
-	Username string `json:"username" validate:"required"`
-	Password string `json:"password" validate:"required"`
-	SSLMode  string `json:"SSLMode" validate:"required"`
+	Username string `json:"username" validate:"required_unless=Driver sqlite"`
+	Password string `json:"password" validate:"required_unless=Driver sqlite"`
+	SSLMode  string `json:"SSLMode" validate:"required_unless=Driver sqlite"`
+	Path     string `json:"path" validate:"required_if=Driver sqlite"`
 }
 
 func (d *ConnectionConfig) AsDSN() string {
+	if d.Driver == DriverSQLite {
+		// foreign keys are disabled by default in SQLite, writing transactions take the lock when they begin, so
+		// concurrent transactions wait for it instead of failing when upgrading a read lock
+		return fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"+
+			"&_txlock=immediate", d.Path)
+	}
+
 	if d.Port == 0 {
 		d.Port = 5432
 	}
@@ -25,12 +45,38 @@ func (d *ConnectionConfig) AsDSN() string {
 }
 
 func CreateDatabaseConnection(config ConnectionConfig) (*bun.DB, error) {
-	sqlDB := sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(config.AsDSN())))
+	var db *bun.DB
+
+	switch config.Driver {
+	case DriverSQLite:
+		sqlDB, err := sql.Open("sqlite", config.AsDSN())
+		if err != nil {
+			return nil, err
+		}
+
+		db = bun.NewDB(sqlDB, sqlitedialect.New())
+	case DriverPostgres, "":
+		sqlDB := sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(config.AsDSN())))
+		db = bun.NewDB(sqlDB, pgdialect.New())
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", config.Driver)
+	}
 
-	db := bun.NewDB(sqlDB, pgdialect.New())
 	if err := db.Ping(); err != nil {
 		return nil, err
 	}
 
 	return db, nil
 }
+
+// IsIntegrityViolation reports whether err was caused by a violated constraint, e.g. a unique constraint.
+func IsIntegrityViolation(err error) bool {
+	var pgErr pgdriver.Error
+	if errors.As(err, &pgErr) {
+		return pgErr.IntegrityViolation()
+	}
+
+	// the extended result codes of SQLite keep the primary result code in the lowest byte
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code()&0xff == sqlite3.SQLITE_CONSTRAINT
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"github.com/sean-b-martin/dynamic-webforms-server/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateDatabaseConnection(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    ConnectionConfig
+		wantError bool
+	}{
+		{name: "sqlite", config: ConnectionConfig{Driver: DriverSQLite, Path: filepath.Join(t.TempDir(), "forms.db")}},
+		{name: "unknown driver", config: ConnectionConfig{Driver: "oracle"}, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := CreateDatabaseConnection(tt.config)
+			if tt.wantError {
+				assert.Error(t, err)
+				assert.Nil(t, db)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, db)
+			}
+		})
+	}
+}
+
+func TestCreateTables_SQLite(t *testing.T) {
+	db, err := CreateDatabaseConnection(ConnectionConfig{Driver: DriverSQLite,
+		Path: filepath.Join(t.TempDir(), "forms.db")})
+	require.NoError(t, err)
+	assert.Error(t, CheckTables(context.Background(), db))
+	CreateTables(db)
+	assert.NoError(t, CheckTables(context.Background(), db))
+
+	user := model.UserModel{Username: "alice", Password: "hash"}
+	_, err = db.NewInsert().Model(&user).Exec(context.Background())
+	require.NoError(t, err)
+	assert.NotZero(t, user.ID)
+
+	duplicate := model.UserModel{Username: "alice", Password: "hash"}
+	_, err = db.NewInsert().Model(&duplicate).Exec(context.Background())
+	assert.True(t, IsIntegrityViolation(err))
+
+	// foreign keys must be enforced
+	form := model.FormSchemaModel{Title: "schema", Version: "1"}
+	_, err = db.NewInsert().Model(&form).Exec(context.Background())
+	assert.True(t, IsIntegrityViolation(err))
+}
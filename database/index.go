@@ -0,0 +1,32 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// NumberAnswerExpression is the numeric answer of a number field, answers of other JSON types are NULL instead of
+// failing the cast, since submissions are not validated against their schema. ?0 is the name of the field.
+const NumberAnswerExpression = "(CASE WHEN jsonb_typeof(data->?0) = 'number' THEN (data->>?0)::numeric END)"
+
+// SubmissionIndexName returns the name of the expression index of a field of a schema.
+func SubmissionIndexName(schemaID uuid.UUID, field string) string {
+	hash := sha256.Sum256([]byte(schemaID.String() + "/" + field))
+	return "form_data_" + hex.EncodeToString(hash[:16])
+}
+
+// CreateSubmissionIndex creates a partial expression index on the answers to a field of a schema. Number fields
+// are indexed with NumberAnswerExpression, all other fields by their text.
+func CreateSubmissionIndex(ctx context.Context, db bun.IDB, name string, schemaID uuid.UUID, field string, number bool) error {
+	expression := "(data->>?0)"
+	if number {
+		expression = NumberAnswerExpression
+	}
+
+	_, err := db.NewRaw("CREATE INDEX IF NOT EXISTS ?1 ON form_data ("+expression+") WHERE form_schema_id = ?2",
+		field, bun.Ident(name), schemaID).Exec(ctx)
+	return err
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/uptrace/bun"
+	"log/slog"
+	"time"
+)
+
+// QueryLogger is a query hook logging failed queries. Records are logged with the context of the query, so they
+// carry the ID of the request which ran it. Queries not finding a row are expected and not logged.
+type QueryLogger struct {
+	logger *slog.Logger
+}
+
+var _ bun.QueryHook = (*QueryLogger)(nil)
+
+func NewQueryLogger(logger *slog.Logger) *QueryLogger {
+	return &QueryLogger{logger: logger}
+}
+
+func (q *QueryLogger) BeforeQuery(ctx context.Context, _ *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+func (q *QueryLogger) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	if event.Err == nil || errors.Is(event.Err, sql.ErrNoRows) {
+		return
+	}
+
+	level := slog.LevelError
+	if errors.Is(event.Err, context.Canceled) || errors.Is(event.Err, context.DeadlineExceeded) {
+		level = slog.LevelWarn
+	}
+
+	q.logger.LogAttrs(ctx, level, "query failed", slog.String("operation", event.Operation()),
+		slog.String("query", event.Query), slog.Duration("duration", time.Since(event.StartTime)),
+		slog.String("error", event.Err.Error()))
+}
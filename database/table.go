@@ -2,19 +2,17 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/sean-b-martin/dynamic-webforms-server/model"
 	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
 	"log"
+	"regexp"
 )
 
 func CreateTables(db *bun.DB) {
-	// activate uuid extension to use uuid_generate_v4 db function
-	if _, err := db.NewRaw(`CREATE EXTENSION IF NOT EXISTS "uuid-ossp";`).
-		Exec(context.Background()); err != nil {
-		log.Fatal(err)
-	}
-
 	if _, err := db.NewCreateTable().IfNotExists().Model((*model.UserModel)(nil)).Exec(context.Background()); err != nil {
 		log.Fatal(fmt.Errorf("failed creating table for UserModel: %w", err))
 	}
@@ -32,7 +30,7 @@ func CreateTables(db *bun.DB) {
 	}
 
 	if _, err := db.NewCreateTable().IfNotExists().Model((*model.FormDataModel)(nil)).
-		ForeignKey(`("user_id") REFERENCES "users" ("id") ON DELETE CASCADE`).
+		ForeignKey(`("user_id") REFERENCES "users" ("id") ON DELETE SET NULL`).
 		ForeignKey(`("form_schema_id") REFERENCES "form_schemas" ("id") ON DELETE CASCADE`).
 		Exec(context.Background()); err != nil {
 		log.Fatal(fmt.Errorf("failed creating table for FormDataModel: %w", err))
@@ -43,4 +41,273 @@ func CreateTables(db *bun.DB) {
 		Exec(context.Background()); err != nil {
 		log.Fatal(fmt.Errorf("failed creating table for FileMetadataModel: %w", err))
 	}
+
+	if _, err := db.NewCreateTable().IfNotExists().Model((*model.UserTokenModel)(nil)).
+		ForeignKey(`("user_id") REFERENCES "users" ("id") ON DELETE CASCADE`).
+		Exec(context.Background()); err != nil {
+		log.Fatal(fmt.Errorf("failed creating table for UserTokenModel: %w", err))
+	}
+
+	if _, err := db.NewCreateTable().IfNotExists().Model((*model.UserIdentityModel)(nil)).
+		ForeignKey(`("user_id") REFERENCES "users" ("id") ON DELETE CASCADE`).
+		Exec(context.Background()); err != nil {
+		log.Fatal(fmt.Errorf("failed creating table for UserIdentityModel: %w", err))
+	}
+
+	if _, err := db.NewCreateTable().IfNotExists().Model((*model.SessionModel)(nil)).
+		ForeignKey(`("user_id") REFERENCES "users" ("id") ON DELETE CASCADE`).
+		Exec(context.Background()); err != nil {
+		log.Fatal(fmt.Errorf("failed creating table for SessionModel: %w", err))
+	}
+
+	if _, err := db.NewCreateTable().IfNotExists().Model((*model.APIKeyModel)(nil)).
+		ForeignKey(`("user_id") REFERENCES "users" ("id") ON DELETE CASCADE`).
+		Exec(context.Background()); err != nil {
+		log.Fatal(fmt.Errorf("failed creating table for APIKeyModel: %w", err))
+	}
+
+	if _, err := db.NewCreateTable().IfNotExists().Model((*model.RecoveryCodeModel)(nil)).
+		ForeignKey(`("user_id") REFERENCES "users" ("id") ON DELETE CASCADE`).
+		Exec(context.Background()); err != nil {
+		log.Fatal(fmt.Errorf("failed creating table for RecoveryCodeModel: %w", err))
+	}
+
+	if _, err := db.NewCreateTable().IfNotExists().Model((*model.RateLimitModel)(nil)).
+		Exec(context.Background()); err != nil {
+		log.Fatal(fmt.Errorf("failed creating table for RateLimitModel: %w", err))
+	}
+
+	// SQLite databases are always created with all columns, the other indexes and search columns rely on features
+	// only available in Postgres
+	if db.Dialect().Name() != dialect.PG {
+		createVerifiedEmailIndex(db)
+		return
+	}
+
+	// GIN index used by containment queries when filtering submissions by their answers
+	if _, err := db.NewCreateIndex().IfNotExists().Model((*model.FormDataModel)(nil)).Index("form_data_data_idx").
+		Using("GIN").ColumnExpr("data jsonb_path_ops").Exec(context.Background()); err != nil {
+		log.Fatal(fmt.Errorf("failed creating index for FormDataModel: %w", err))
+	}
+
+	addMissingColumns(db)
+	alterColumnTypes(db)
+	keepSubmissionsOfDeletedUsers(db)
+	replaceUncheckedSubmissionIndexes(db)
+	createVerifiedEmailIndex(db)
+	createSearchColumns(db)
+}
+
+// addMissingColumns adds columns to tables created before the columns were introduced, CreateTable only
+// creates tables which do not exist yet.
+func addMissingColumns(db *bun.DB) {
+	auditColumns := []string{
+		"created_at timestamptz NOT NULL DEFAULT current_timestamp",
+		"updated_at timestamptz NOT NULL DEFAULT current_timestamp",
+		"created_by uuid",
+		"updated_by uuid",
+	}
+	softDeleteColumns := []string{"deleted_at timestamptz"}
+	rowVersionColumns := []string{"row_version bigint NOT NULL DEFAULT 1"}
+	lockoutColumns := []string{"failed_logins integer NOT NULL DEFAULT 0", "locked_until timestamptz"}
+	submissionLimitColumns := []string{"submissions_per_hour integer NOT NULL DEFAULT 0"}
+	emailColumns := []string{"email varchar(254)", "email_verified_at timestamptz"}
+	totpColumns := []string{"totp_secret varchar(64)", "totp_enabled_at timestamptz",
+		"totp_last_step bigint NOT NULL DEFAULT 0"}
+	grantColumns := []string{"roles jsonb", "tenant varchar(64)"}
+	apiKeyTenantColumns := []string{"tenant varchar(64)"}
+
+	tables := []struct {
+		table   string
+		columns [][]string
+	}{
+		{table: "users", columns: [][]string{auditColumns, lockoutColumns, emailColumns, totpColumns,
+			grantColumns}},
+		{table: "forms", columns: [][]string{auditColumns, softDeleteColumns, rowVersionColumns, submissionLimitColumns}},
+		{table: "form_schemas", columns: [][]string{auditColumns, softDeleteColumns, rowVersionColumns}},
+		{table: "form_data", columns: [][]string{auditColumns, softDeleteColumns, rowVersionColumns}},
+		{table: "file_metadata", columns: [][]string{auditColumns}},
+		{table: "api_keys", columns: [][]string{apiKeyTenantColumns}},
+	}
+
+	for _, table := range tables {
+		for _, columns := range table.columns {
+			for _, column := range columns {
+				if _, err := db.NewRaw("ALTER TABLE ? ADD COLUMN IF NOT EXISTS "+column, bun.Ident(table.table)).
+					Exec(context.Background()); err != nil {
+					log.Fatal(fmt.Errorf("failed adding column to %s: %w", table.table, err))
+				}
+			}
+		}
+	}
+}
+
+// alterColumnTypes changes the type of columns created with a type which became too small. Columns are only
+// altered while they have their previous length, altering them rewrites the table.
+func alterColumnTypes(db *bun.DB) {
+	columns := []struct {
+		table          string
+		column         string
+		previousLength int
+		typ            string
+	}{
+		// PHC strings of Argon2id hashes are longer than bcrypt hashes
+		{table: "users", column: "password", previousLength: 60, typ: "varchar(255)"},
+	}
+
+	for _, column := range columns {
+		var length sql.NullInt64
+		if err := db.NewRaw(`SELECT character_maximum_length FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?`, column.table, column.column).
+			Scan(context.Background(), &length); err != nil {
+			log.Fatal(fmt.Errorf("failed reading column %s of %s: %w", column.column, column.table, err))
+		}
+
+		if !length.Valid || length.Int64 != int64(column.previousLength) {
+			continue
+		}
+
+		if _, err := db.NewRaw("ALTER TABLE ? ALTER COLUMN ? TYPE "+column.typ, bun.Ident(column.table),
+			bun.Ident(column.column)).Exec(context.Background()); err != nil {
+			log.Fatal(fmt.Errorf("failed altering column %s of %s: %w", column.column, column.table, err))
+		}
+	}
+}
+
+// keepSubmissionsOfDeletedUsers changes the foreign key of the user of submissions from ON DELETE CASCADE to
+// ON DELETE SET NULL, deleting a user deleted the submissions to forms of other users.
+func keepSubmissionsOfDeletedUsers(db *bun.DB) {
+	var cascading int
+	if err := db.NewRaw(`SELECT count(*) FROM pg_constraint WHERE conrelid = 'form_data'::regclass
+		AND conname = 'form_data_user_id_fkey' AND confdeltype = 'c'`).
+		Scan(context.Background(), &cascading); err != nil {
+		log.Fatal(fmt.Errorf("failed reading foreign key of form_data: %w", err))
+	}
+
+	if cascading == 0 {
+		return
+	}
+
+	if _, err := db.NewRaw(`ALTER TABLE form_data ALTER COLUMN user_id DROP NOT NULL,
+		DROP CONSTRAINT form_data_user_id_fkey,
+		ADD CONSTRAINT form_data_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL`).
+		Exec(context.Background()); err != nil {
+		log.Fatal(fmt.Errorf("failed changing foreign key of form_data: %w", err))
+	}
+}
+
+// uncheckedSubmissionIndexRegex matches the field and the schema in the definition of an unchecked index.
+var uncheckedSubmissionIndexRegex = regexp.MustCompile(`data ->> '([A-Za-z][A-Za-z0-9_]*)'::text.*form_schema_id = '([0-9a-f-]{36})'::uuid`)
+
+// replaceUncheckedSubmissionIndexes replaces the indexes of number fields which cast answers without checking their
+// JSON type, so any submission with another type of answer failed, by indexes with NumberAnswerExpression.
+func replaceUncheckedSubmissionIndexes(db *bun.DB) {
+	var indexes []struct {
+		Name       string `bun:"indexname"`
+		Definition string `bun:"indexdef"`
+	}
+	if err := db.NewRaw(`SELECT indexname, indexdef FROM pg_indexes WHERE tablename = 'form_data'
+		AND indexname LIKE 'form_data\_%' AND indexdef LIKE '%::numeric%' AND indexdef NOT LIKE '%jsonb_typeof%'`).
+		Scan(context.Background(), &indexes); err != nil {
+		log.Fatal(fmt.Errorf("failed listing submission indexes: %w", err))
+	}
+
+	for _, index := range indexes {
+		err := db.RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
+			if _, err := tx.NewRaw("DROP INDEX IF EXISTS ?", bun.Ident(index.Name)).Exec(ctx); err != nil {
+				return err
+			}
+
+			match := uncheckedSubmissionIndexRegex.FindStringSubmatch(index.Definition)
+			if match == nil {
+				return fmt.Errorf("unexpected definition %q", index.Definition)
+			}
+
+			schemaID, err := uuid.Parse(match[2])
+			if err != nil {
+				return err
+			}
+
+			return CreateSubmissionIndex(ctx, tx, index.Name, schemaID, match[1], true)
+		})
+		if err != nil {
+			log.Fatal(fmt.Errorf("failed replacing submission index %s: %w", index.Name, err))
+		}
+	}
+}
+
+// createVerifiedEmailIndex makes verified emails unique. Unverified emails are not unique, so registering or
+// changing to an email does not reveal whether another user uses it, and nobody can claim the email of someone
+// else without verifying it. Databases created before drop the unique constraint of all emails.
+func createVerifiedEmailIndex(db *bun.DB) {
+	if db.Dialect().Name() == dialect.PG {
+		if _, err := db.NewRaw(`ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key`).
+			Exec(context.Background()); err != nil {
+			log.Fatal(fmt.Errorf("failed dropping unique constraint of users email: %w", err))
+		}
+
+		if _, err := db.NewRaw(`DROP INDEX IF EXISTS users_email_key`).Exec(context.Background()); err != nil {
+			log.Fatal(fmt.Errorf("failed dropping unique index of users email: %w", err))
+		}
+	}
+
+	if _, err := db.NewRaw(`CREATE UNIQUE INDEX IF NOT EXISTS users_verified_email_key ON users (email)
+		WHERE email_verified_at IS NOT NULL`).Exec(context.Background()); err != nil {
+		log.Fatal(fmt.Errorf("failed creating unique index of verified users emails: %w", err))
+	}
+}
+
+// createSearchColumns adds generated tsvector columns used for full-text search. The columns are not part of
+// the models, so they are kept up to date by Postgres and never returned in responses.
+func createSearchColumns(db *bun.DB) {
+	searchColumns := []struct {
+		table      string
+		expression string
+	}{
+		{table: "forms", expression: `to_tsvector('simple', title)`},
+		{table: "form_schemas", expression: `to_tsvector('simple', title) || jsonb_to_tsvector('simple', ` +
+			`coalesce(jsonb_path_query_array(schema, '$.fields[*].label'), '[]'), '["string"]')`},
+		{table: "form_data", expression: `to_tsvector('simple', name) || ` +
+			`jsonb_to_tsvector('simple', coalesce(data, '{}'), '["string"]')`},
+	}
+
+	for _, column := range searchColumns {
+		if _, err := db.NewRaw(`ALTER TABLE ? ADD COLUMN IF NOT EXISTS search_vector tsvector `+
+			`GENERATED ALWAYS AS (`+column.expression+`) STORED`, bun.Ident(column.table)).
+			Exec(context.Background()); err != nil {
+			log.Fatal(fmt.Errorf("failed creating search column for %s: %w", column.table, err))
+		}
+
+		if _, err := db.NewRaw(`CREATE INDEX IF NOT EXISTS ? ON ? USING GIN (search_vector)`,
+			bun.Ident(column.table+"_search_vector_idx"), bun.Ident(column.table)).
+			Exec(context.Background()); err != nil {
+			log.Fatal(fmt.Errorf("failed creating search index for %s: %w", column.table, err))
+		}
+	}
+}
+
+// CheckTables returns an error if a table of the models or one of its columns is missing, e.g. because the
+// tables have not been created or updated yet.
+func CheckTables(ctx context.Context, db bun.IDB) error {
+	models := []interface{}{
+		(*model.UserModel)(nil),
+		(*model.FormModel)(nil),
+		(*model.FormSchemaModel)(nil),
+		(*model.FormDataModel)(nil),
+		(*model.FileMetadataModel)(nil),
+		(*model.UserTokenModel)(nil),
+		(*model.UserIdentityModel)(nil),
+		(*model.SessionModel)(nil),
+		(*model.APIKeyModel)(nil),
+		(*model.RecoveryCodeModel)(nil),
+		(*model.RateLimitModel)(nil),
+	}
+
+	for _, m := range models {
+		if _, err := db.NewSelect().Model(m).Limit(0).Exec(ctx); err != nil {
+			return fmt.Errorf("failed checking table of %T: %w", m, err)
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,17 @@
+package database
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUncheckedSubmissionIndexRegex(t *testing.T) {
+	definition := `CREATE INDEX form_data_0f4b0a3f8b1e4f7d9c2a6e5b3d1c0a9f ON public.form_data USING btree ` +
+		`((((data ->> 'age'::text))::numeric)) WHERE (form_schema_id = '2b1e4c3d-5f6a-4b7c-8d9e-0f1a2b3c4d5e'::uuid)`
+
+	match := uncheckedSubmissionIndexRegex.FindStringSubmatch(definition)
+	if assert.Len(t, match, 3) {
+		assert.Equal(t, "age", match[1])
+		assert.Equal(t, "2b1e4c3d-5f6a-4b7c-8d9e-0f1a2b3c4d5e", match[2])
+	}
+}
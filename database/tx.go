@@ -1,14 +1,70 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"github.com/gofiber/fiber/v2/log"
 	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/driver/pgdriver"
+	"log/slog"
+	"math/rand/v2"
+	"time"
 )
 
+const maxTxAttempts = 3
+
 func TXLogErrRollback(tx *bun.Tx) {
 	if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
-		log.Error(err)
+		slog.Error("failed rolling back transaction", "error", err)
+	}
+}
+
+// RunInTx runs fn as a unit of work in a transaction, which is committed if fn returns nil and rolled back
+// otherwise. Transactions aborted by a serialization failure or deadlock are retried, so fn must not have side
+// effects outside the transaction.
+func RunInTx(ctx context.Context, db *bun.DB, fn func(ctx context.Context, tx bun.Tx) error) error {
+	return RunInTxWithOptions(ctx, db, nil, fn)
+}
+
+func RunInTxWithOptions(ctx context.Context, db *bun.DB, opts *sql.TxOptions, fn func(ctx context.Context, tx bun.Tx) error) error {
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		if err = runInTx(ctx, db, opts, fn); err == nil || !isRetryableTxErr(err) {
+			return err
+		}
+
+		// back off with jitter, so concurrent transactions do not collide again
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt*10+rand.IntN(10)) * time.Millisecond):
+		}
+	}
+
+	return err
+}
+
+func runInTx(ctx context.Context, db *bun.DB, opts *sql.TxOptions, fn func(ctx context.Context, tx bun.Tx) error) error {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
 	}
+	defer TXLogErrRollback(&tx)
+
+	if err := fn(ctx, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func isRetryableTxErr(err error) bool {
+	var pgErr pgdriver.Error
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	// serialization_failure and deadlock_detected
+	code := pgErr.Field('C')
+	return code == "40001" || code == "40P01"
 }
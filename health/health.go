@@ -0,0 +1,86 @@
+// Package health reports the liveness and readiness of the server to orchestrators.
+package health
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check returns an error if a dependency of the server is not usable.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs the readiness checks of the server. Once the server shuts down it is never ready again, so load
+// balancers stop routing requests to it before the listener closes.
+type Checker struct {
+	checks       []namedCheck
+	shuttingDown atomic.Bool
+}
+
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// Add registers a check. Checks must be added before the checker is used.
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+func (c *Checker) ShuttingDown() bool {
+	return c.shuttingDown.Load()
+}
+
+// Check runs all checks concurrently and returns the error of each check by name, nil for passed checks.
+func (c *Checker) Check(ctx context.Context) map[string]error {
+	results := make(map[string]error, len(c.checks))
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := check.check(ctx)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			results[check.name] = err
+		}()
+	}
+
+	wg.Wait()
+	return results
+}
+
+type BuildInfo struct {
+	Version   string
+	Commit    string
+	StartedAt time.Time
+}
+
+// NewBuildInfo returns the build info of the running binary. The version and commit are set at build time with
+// -ldflags, without a commit the VCS revision embedded by the go tool is used.
+func NewBuildInfo(version string, commit string) BuildInfo {
+	if commit == "" {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			for _, setting := range info.Settings {
+				if setting.Key == "vcs.revision" {
+					commit = setting.Value
+				}
+			}
+		}
+	}
+
+	return BuildInfo{Version: version, Commit: commit, StartedAt: time.Now()}
+}
@@ -0,0 +1,71 @@
+// Package logging provides the structured logger of the server. Records logged with a context carry the request
+// and user ID stored in it, so all records of a request can be correlated.
+package logging
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"io"
+	"log/slog"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	userIDKey
+)
+
+// NewLogger creates a logger writing JSON records to w.
+func NewLogger(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(&contextHandler{Handler: slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})})
+}
+
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+func WithUserID(ctx context.Context, userID uuid.UUID) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// contextHandler adds the request and user ID of the context to records.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID := RequestID(ctx); requestID != "" {
+		record.AddAttrs(slog.String("requestID", requestID))
+	}
+
+	if userID, ok := ctx.Value(userIDKey).(uuid.UUID); ok {
+		record.AddAttrs(slog.String("userID", userID.String()))
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// ParseLevel parses the name of a level, e.g. info. The empty string is parsed as info.
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if name == "" {
+		return slog.LevelInfo, nil
+	}
+
+	err := level.UnmarshalText([]byte(name))
+	return level, err
+}
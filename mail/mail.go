@@ -0,0 +1,84 @@
+// Package mail sends the emails of the server, e.g. password reset links.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers messages, Send returns once the message was accepted for delivery.
+type Sender interface {
+	Send(ctx context.Context, message Message) error
+}
+
+var errHeaderInjection = errors.New("mail: line break in header")
+
+// format writes the message with its headers as sent in the SMTP DATA command. The body is quoted-printable
+// encoded, so it may contain any UTF-8 text and long lines.
+func format(from string, message Message, date time.Time) ([]byte, error) {
+	if strings.ContainsAny(message.To, "\r\n") || strings.ContainsAny(message.Subject, "\r\n") {
+		return nil, errHeaderInjection
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", message.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	writer := quotedprintable.NewWriter(&buf)
+	body := strings.ReplaceAll(strings.ReplaceAll(message.Body, "\r\n", "\n"), "\n", "\r\n")
+	if _, err := writer.Write([]byte(body)); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// parseAddress returns the address part of an address which may contain a display name, e.g.
+// "Webforms <noreply@example.com>".
+func parseAddress(address string) (string, error) {
+	parsed, err := netmail.ParseAddress(address)
+	if err != nil {
+		return "", fmt.Errorf("mail: invalid address %q: %w", address, err)
+	}
+
+	return parsed.Address, nil
+}
+
+// LogSender logs messages instead of sending them. It is meant for development without a mail server, as the
+// logged messages contain the tokens sent to users.
+type LogSender struct {
+	logger *slog.Logger
+}
+
+func NewLogSender(logger *slog.Logger) *LogSender {
+	return &LogSender{logger: logger}
+}
+
+func (s *LogSender) Send(ctx context.Context, message Message) error {
+	s.logger.InfoContext(ctx, "mail not sent, no SMTP server configured", slog.String("to", message.To),
+		slog.String("subject", message.Subject), slog.String("body", message.Body))
+	return nil
+}
@@ -0,0 +1,139 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPConfig configures the SMTP server messages are sent through. STARTTLS is used whenever the server offers it,
+// RequireTLS refuses to send messages over servers not offering it. Without a username no authentication is used.
+type SMTPConfig struct {
+	Host           string `json:"host"`
+	Port           int    `json:"port" validate:"omitempty,min=1,max=65535"`
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+	From           string `json:"from" validate:"required_with=Host"`
+	RequireTLS     bool   `json:"requireTLS"`
+	TimeoutSeconds int    `json:"timeoutSeconds" validate:"min=0"`
+}
+
+const defaultSMTPTimeout = 30 * time.Second
+
+var ErrTLSNotOffered = errors.New("mail: SMTP server does not offer STARTTLS")
+
+// SMTPSender opens a connection for each message, so it does not hold connections between the rare emails of
+// the server.
+type SMTPSender struct {
+	config      SMTPConfig
+	fromAddress string
+	timeout     time.Duration
+	tlsConfig   *tls.Config
+}
+
+var _ Sender = (*SMTPSender)(nil)
+
+func NewSMTPSender(config SMTPConfig) (*SMTPSender, error) {
+	fromAddress, err := parseAddress(config.From)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Port == 0 {
+		config.Port = 587
+	}
+
+	timeout := time.Duration(config.TimeoutSeconds) * time.Second
+	if timeout == 0 {
+		timeout = defaultSMTPTimeout
+	}
+
+	return &SMTPSender{
+		config:      config,
+		fromAddress: fromAddress,
+		timeout:     timeout,
+		tlsConfig:   &tls.Config{ServerName: config.Host, MinVersion: tls.VersionTLS12},
+	}, nil
+}
+
+func (s *SMTPSender) Send(ctx context.Context, message Message) error {
+	to, err := parseAddress(message.To)
+	if err != nil {
+		return err
+	}
+
+	data, err := format(s.config.From, message, time.Now())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port)))
+	if err != nil {
+		return fmt.Errorf("mail: error connecting to SMTP server: %w", err)
+	}
+
+	// the deadline of the context applies to the whole conversation with the server
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("mail: error connecting to SMTP server: %w", err)
+	}
+	defer client.Close()
+
+	if err := s.send(client, to, data); err != nil {
+		return fmt.Errorf("mail: error sending message: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SMTPSender) send(client *smtp.Client, to string, data []byte) error {
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(s.tlsConfig); err != nil {
+			return err
+		}
+	} else if s.config.RequireTLS {
+		return ErrTLSNotOffered
+	}
+
+	if s.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(s.fromAddress); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
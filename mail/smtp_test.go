@@ -0,0 +1,158 @@
+package mail
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// smtpSink is a minimal SMTP server accepting all messages, like the mail sinks used during development.
+// rejectRcpt makes it reject all recipients.
+type smtpSink struct {
+	listener   net.Listener
+	rejectRcpt bool
+
+	mu       sync.Mutex
+	from     string
+	to       []string
+	data     string
+	received chan struct{}
+}
+
+func newSMTPSink(t *testing.T, rejectRcpt bool) *smtpSink {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	sink := &smtpSink{listener: listener, rejectRcpt: rejectRcpt, received: make(chan struct{}, 1)}
+	go sink.serve()
+	return sink
+}
+
+func (s *smtpSink) config() SMTPConfig {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return SMTPConfig{Host: host, Port: portNumber, From: "Webforms <noreply@example.com>"}
+}
+
+func (s *smtpSink) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpSink) handle(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	reply := func(line string) { _ = text.PrintfLine("%s", line) }
+
+	reply("220 sink ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO", "HELO":
+			reply("250 sink")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = line
+			s.mu.Unlock()
+			reply("250 OK")
+		case "RCPT":
+			if s.rejectRcpt {
+				reply("550 mailbox unavailable")
+				continue
+			}
+			s.mu.Lock()
+			s.to = append(s.to, line)
+			s.mu.Unlock()
+			reply("250 OK")
+		case "DATA":
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.data = string(data)
+			s.mu.Unlock()
+			reply("250 OK")
+			s.received <- struct{}{}
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+func TestSMTPSender_Send(t *testing.T) {
+	sink := newSMTPSink(t, false)
+	sender, err := NewSMTPSender(sink.config())
+	require.NoError(t, err)
+
+	body := "Reset your password: https://example.com/reset?token=" + strings.Repeat("a", 100) + "\nBye"
+	require.NoError(t, sender.Send(context.Background(),
+		Message{To: "alice@example.com", Subject: "Passwort zurücksetzen", Body: body}))
+	<-sink.received
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	assert.Equal(t, "MAIL FROM:<noreply@example.com>", strings.SplitN(sink.from, " BODY", 2)[0])
+	assert.Equal(t, []string{"RCPT TO:<alice@example.com>"}, sink.to)
+
+	// the dot reader of the sink converts the line endings to \n
+	header, content, ok := strings.Cut(sink.data, "\n\n")
+	require.True(t, ok)
+	assert.Contains(t, header, "From: Webforms <noreply@example.com>")
+	assert.Contains(t, header, "To: alice@example.com")
+	assert.Contains(t, header, "Subject: =?utf-8?q?Passwort_zur=C3=BCcksetzen?=")
+
+	decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(content)))
+	require.NoError(t, err)
+	// the data of SMTP messages always ends with a line break
+	assert.Equal(t, body+"\n", string(decoded))
+}
+
+func TestSMTPSender_SendErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		message    Message
+		rejectRcpt bool
+		requireTLS bool
+	}{
+		{name: "invalid recipient", message: Message{To: "not an address", Subject: "Hi"}},
+		{name: "line break in subject", message: Message{To: "alice@example.com", Subject: "Hi\r\nBcc: eve@example.com"}},
+		{name: "recipient rejected", message: Message{To: "alice@example.com", Subject: "Hi"}, rejectRcpt: true},
+		{name: "TLS required", message: Message{To: "alice@example.com", Subject: "Hi"}, requireTLS: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := newSMTPSink(t, tt.rejectRcpt)
+			config := sink.config()
+			config.RequireTLS = tt.requireTLS
+			sender, err := NewSMTPSender(config)
+			require.NoError(t, err)
+
+			assert.Error(t, sender.Send(context.Background(), tt.message))
+		})
+	}
+}
@@ -2,78 +2,226 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/sean-b-martin/dynamic-webforms-server/auth"
 	"github.com/sean-b-martin/dynamic-webforms-server/controller"
 	"github.com/sean-b-martin/dynamic-webforms-server/database"
+	"github.com/sean-b-martin/dynamic-webforms-server/health"
+	"github.com/sean-b-martin/dynamic-webforms-server/logging"
+	"github.com/sean-b-martin/dynamic-webforms-server/mail"
+	"github.com/sean-b-martin/dynamic-webforms-server/metrics"
 	"github.com/sean-b-martin/dynamic-webforms-server/middleware"
+	"github.com/sean-b-martin/dynamic-webforms-server/ratelimit"
 	"github.com/sean-b-martin/dynamic-webforms-server/service"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/sean-b-martin/dynamic-webforms-server/tracing"
+	"github.com/uptrace/bun/extra/bunotel"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 )
 
+// version and commit are set at build time, e.g. -ldflags "-X main.version=1.2.0 -X main.commit=abc123"
+var (
+	version = "dev"
+	commit  = ""
+)
+
 func main() {
-	// setup database
-	data, err := os.ReadFile("config.json")
+	buildInfo := health.NewBuildInfo(version, commit)
+
+	config, err := loadConfig("config.json")
 	if err != nil {
-		log.Fatal(fmt.Errorf("error reading config.json: %w", err))
+		log.Fatal(err)
 	}
 
-	var dbConfig database.ConnectionConfig
-	if err = json.Unmarshal(data, &dbConfig); err != nil {
-		log.Fatal(fmt.Errorf("error parsing config.json: %w", err))
+	logLevel, err := logging.ParseLevel(config.LogLevel)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	if err = validator.New(validator.WithRequiredStructEnabled()).Struct(dbConfig); err != nil {
-		log.Fatal(fmt.Errorf("error parsing config.json: %w", err))
+	// the standard logger writes through the structured logger as well
+	logger := logging.NewLogger(os.Stdout, logLevel)
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), config.Tracing)
+	if err != nil {
+		log.Fatal(err)
 	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error("error flushing spans", slog.Any("error", err))
+		}
+	}()
 
-	db, err := database.CreateDatabaseConnection(dbConfig)
+	// setup database
+	db, err := database.CreateDatabaseConnection(config.ConnectionConfig)
 	if err != nil {
 		log.Fatal(fmt.Errorf("error connecting to database: %w", err))
 	}
 
+	db.AddQueryHook(database.NewQueryLogger(logger))
+	db.AddQueryHook(metrics.NewQueryHook())
+	db.AddQueryHook(bunotel.NewQueryHook())
+	if err := metrics.RegisterDBStats(db, "main"); err != nil {
+		log.Fatal(fmt.Errorf("error registering database metrics: %w", err))
+	}
 	database.CreateTables(db)
 
 	// setup webserver
 	app := fiber.New(fiber.Config{
+		ErrorHandler: controller.NewErrorHandler(logger),
+		// without trusted proxies, the proxy header is ignored and the IP of the connection is used
+		ProxyHeader:             config.ProxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          config.TrustedProxies,
+		EnableIPValidation:      true,
 		JSONDecoder: func(data []byte, v interface{}) error {
 			decoder := json.NewDecoder(bytes.NewReader(data))
 			decoder.DisallowUnknownFields()
 			return decoder.Decode(v)
 		},
 	})
+	checker := health.NewChecker()
+	checker.Add("database", func(ctx context.Context) error { return db.PingContext(ctx) })
+	checker.Add("tables", func(ctx context.Context) error { return database.CheckTables(ctx, db) })
+	controller.NewHealthController(app, checker, buildInfo)
+
+	app.Use(middleware.RequestID())
+	app.Use(middleware.Tracing())
+	app.Use(middleware.Metrics())
+	app.Use(middleware.AccessLog(logger))
 	app.Use(recover.New())
 
-	jwtService, err := auth.NewJWTService()
+	// requests are cancelled once the graceful shutdown timed out
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	app.Use(middleware.RequestContext(requestCtx, time.Duration(config.DatabaseTimeoutSeconds)*time.Second))
+	if config.SessionCookie.Enabled {
+		app.Use(middleware.CSRF(config.SessionCookie))
+	}
+
+	app.Get("/metrics", metrics.Handler())
+
+	signingKey, err := base64.StdEncoding.DecodeString(config.JWTSigningKey)
+	if err != nil {
+		log.Fatal(fmt.Errorf("error decoding JWT signing key: %w", err))
+	}
+	jwtService, err := auth.NewJWTService(auth.WithSigningKey(signingKey), auth.WithAudience(config.JWTAudience))
 	if err != nil {
 		log.Fatal(fmt.Errorf("error creating JWT service: %w", err))
 	}
 
-	passwordService, err := auth.NewPasswordService(bcrypt.DefaultCost)
+	passwordService, err := newPasswordService(config.PasswordHashing)
 	if err != nil {
 		log.Fatal(fmt.Errorf("error creating password service: %w", err))
 	}
 
-	authMiddleware := middleware.NewJWTAuth(jwtService)
-	controller.NewUserController(app.Group("/users"), authMiddleware,
-		service.NewUserService(db, passwordService, jwtService))
-	controller.NewFormController(app.Group("/forms"), authMiddleware, service.NewFormService(db))
-	controller.NewSchemaController(app.Group("/forms/:formID/"), authMiddleware, service.NewSchemaService(db))
+	passwordPolicy, err := auth.NewPasswordPolicy(config.PasswordPolicy)
+	if err != nil {
+		log.Fatal(fmt.Errorf("error creating password policy: %w", err))
+	}
+
+	var mailer mail.Sender = mail.NewLogSender(logger)
+	if config.Mail.SMTP.Host != "" {
+		if mailer, err = mail.NewSMTPSender(config.Mail.SMTP); err != nil {
+			log.Fatal(fmt.Errorf("error creating mail sender: %w", err))
+		}
+	} else {
+		logger.Warn("no SMTP server configured, emails are logged instead of sent")
+	}
+
+	store := service.NewDBStore(db)
+	apiKeyService := service.NewAPIKeyService(store)
+	sessionService := service.NewSessionService(store)
+	authMiddleware := middleware.NewJWTAuth(jwtService, apiKeyService, sessionService,
+		middleware.WithSessionCookie(config.SessionCookie))
+	var rateLimitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if config.RateLimits.Store == ratelimit.StoreDatabase {
+		rateLimitStore = ratelimit.NewDBStore(db)
+	}
+	userService := service.NewUserService(store, passwordService, passwordPolicy, jwtService, mailer,
+		service.UserServiceConfig{
+			Lockout:              config.Lockout,
+			PasswordResetURL:     config.Mail.PasswordResetURL,
+			EmailVerificationURL: config.Mail.EmailVerificationURL,
+			TOTPIssuer:           config.TOTPIssuer,
+		})
+	loginRateLimit := middleware.RateLimit(rateLimitStore, "login-ip", config.RateLimits.LoginPerIP,
+		middleware.KeyByIP)
+	// registered before the user routes, which require a JSON content type from here on
+	if config.OIDC.IssuerURL != "" {
+		oidcProvider, err := auth.NewOIDCProvider(context.Background(), config.OIDC)
+		if err != nil {
+			log.Fatal(fmt.Errorf("error creating OIDC provider: %w", err))
+		}
+		controller.NewOIDCController(app.Group("/users/oidc"), oidcProvider, userService,
+			[]fiber.Handler{loginRateLimit}, config.SessionCookie)
+	}
+	controller.NewUserController(app.Group("/users"), authMiddleware, userService, sessionService,
+		controller.UserRateLimits{
+			Login: []fiber.Handler{
+				loginRateLimit,
+				middleware.RateLimit(rateLimitStore, "login-username", config.RateLimits.LoginPerUsername,
+					middleware.KeyByUsername),
+			},
+			Register: []fiber.Handler{
+				middleware.RateLimit(rateLimitStore, "register-ip", config.RateLimits.RegisterPerIP,
+					middleware.KeyByIP),
+			},
+			PasswordReset: []fiber.Handler{
+				middleware.RateLimit(rateLimitStore, "password-reset-ip", config.RateLimits.PasswordResetPerIP,
+					middleware.KeyByIP),
+				middleware.RateLimit(rateLimitStore, "password-reset-email", config.RateLimits.PasswordResetPerEmail,
+					middleware.KeyByEmail),
+			},
+			Email: []fiber.Handler{
+				middleware.RateLimit(rateLimitStore, "email-user", config.RateLimits.EmailPerUser,
+					middleware.KeyByUser),
+				middleware.RateLimit(rateLimitStore, "email-address", config.RateLimits.EmailPerAddress,
+					middleware.KeyByEmail),
+			},
+		}, config.SessionCookie)
+	controller.NewAPIKeyController(app.Group("/api-keys"), authMiddleware, apiKeyService)
+	controller.NewSessionController(app.Group("/sessions"), authMiddleware, sessionService)
+	controller.NewFormController(app.Group("/forms"), authMiddleware, service.NewFormService(store))
+	controller.NewSchemaController(app.Group("/forms/:formID/"), authMiddleware, service.NewSchemaService(store))
+	controller.NewSubmissionController(app.Group("/forms/:formID/schemas/:schemaID/submissions"), authMiddleware,
+		service.NewSubmissionService(db))
+	controller.NewStatisticsController(app.Group("/forms/:formID/schemas/:schemaID/stats"), authMiddleware,
+		service.NewStatisticsService(db))
+	controller.NewSearchController(app.Group("/search"), authMiddleware, service.NewSearchService(db))
+
+	trashRetention := time.Duration(config.TrashRetentionDays) * 24 * time.Hour
+	trashService := service.NewTrashService(db, trashRetention)
+	controller.NewTrashController(app.Group("/trash"), authMiddleware, trashService)
+
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go service.PurgeTrashPeriodically(jobCtx, logger, trashService, trashRetention, time.Hour)
+	go ratelimit.DeleteExpiredPeriodically(jobCtx, logger, rateLimitStore, 10*time.Minute)
+	go service.DeleteExpiredSessionsPeriodically(jobCtx, logger, sessionService, time.Hour)
 
 	// shutdown server gracefully
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-c
-		if err := app.ShutdownWithTimeout(1 * time.Minute); err != nil {
+		// fail the readiness probe and keep serving until the orchestrator stopped routing requests to us
+		checker.SetShuttingDown()
+		time.Sleep(time.Duration(config.ShutdownDelaySeconds) * time.Second)
+
+		stopJobs()
+		err := app.ShutdownWithTimeout(1 * time.Minute)
+		cancelRequests()
+		if err != nil {
 			log.Fatal(fmt.Errorf("error shutting down server: %w", err))
 		}
 	}()
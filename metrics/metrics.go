@@ -0,0 +1,105 @@
+// Package metrics provides the Prometheus metrics of the server. All metrics are registered with the default
+// registry which is exposed by Handler.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/uptrace/bun"
+	"strconv"
+	"time"
+)
+
+const namespace = "webforms"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of handled HTTP requests.",
+	}, []string{"method", "route", "status"})
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of handled HTTP requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Duration of database queries.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"operation", "result"})
+)
+
+var (
+	Logins = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Number of successful logins.",
+	})
+	FailedLogins = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "failed_logins_total",
+		Help:      "Number of logins rejected because of invalid credentials.",
+	})
+	SubmissionsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "submissions_created_total",
+		Help:      "Number of created form submissions.",
+	})
+	// FilesUploaded is incremented once files are uploaded to submissions, the server only has the file metadata
+	// table so far and no upload endpoint.
+	FilesUploaded = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "files_uploaded_total",
+		Help:      "Number of files uploaded to submissions.",
+	})
+)
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.Handler())
+}
+
+// ObserveRequest records a handled HTTP request. route is the registered route pattern, not the requested path,
+// to keep the number of label values bounded.
+func ObserveRequest(method string, route string, status int, duration time.Duration) {
+	statusLabel := strconv.Itoa(status)
+	httpRequests.WithLabelValues(method, route, statusLabel).Inc()
+	httpRequestDuration.WithLabelValues(method, route, statusLabel).Observe(duration.Seconds())
+}
+
+// RegisterDBStats exports the connection pool statistics of db.
+func RegisterDBStats(db *bun.DB, name string) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db.DB, name))
+}
+
+// QueryHook records the duration of all queries of a database.
+type QueryHook struct{}
+
+var _ bun.QueryHook = (*QueryHook)(nil)
+
+func NewQueryHook() *QueryHook {
+	return &QueryHook{}
+}
+
+func (h *QueryHook) BeforeQuery(ctx context.Context, _ *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+func (h *QueryHook) AfterQuery(_ context.Context, event *bun.QueryEvent) {
+	result := "success"
+	if event.Err != nil && !errors.Is(event.Err, sql.ErrNoRows) {
+		result = "error"
+	}
+
+	dbQueryDuration.WithLabelValues(event.Operation(), result).Observe(time.Since(event.StartTime).Seconds())
+}
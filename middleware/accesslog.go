@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"log/slog"
+	"time"
+)
+
+// AccessLog logs a record for each request after it has been handled. Errors returned by later handlers are
+// passed to the error handler of the app first, so the record contains the status sent to the client.
+func AccessLog(logger *slog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		handleError(c, c.Next())
+
+		status := c.Response().StatusCode()
+		attrs := []slog.Attr{
+			slog.String("method", c.Method()),
+			slog.String("route", c.Route().Path),
+			slog.String("path", c.Path()),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+		}
+		if requestID, ok := c.Locals(RequestIDLocal).(string); ok {
+			attrs = append(attrs, slog.String("requestID", requestID))
+		}
+		if userID, ok := c.Locals(UserIDLocal).(uuid.UUID); ok {
+			attrs = append(attrs, slog.String("userID", userID.String()))
+		}
+
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		logger.LogAttrs(c.Context(), level, "request", attrs...)
+		return nil
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sean-b-martin/dynamic-webforms-server/logging"
+	"time"
+)
+
+// RequestContext derives the user context of each request from the context set by the preceding middlewares, e.g.
+// the span of the request, and passes it to the services, where it cancels their database queries. The context is
+// cancelled once the request is done, after timeout, or when parent is cancelled, e.g. once a graceful shutdown
+// timed out. A timeout of zero disables the per-request timeout. The request ID is added to the context, so the
+// records logged by the services belong to the request. fasthttp does not notice clients closing the connection
+// while a handler runs, so those requests only stop at the timeout.
+func RequestContext(parent context.Context, timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var ctx context.Context
+		var cancel context.CancelFunc
+
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(c.UserContext(), timeout)
+		} else {
+			ctx, cancel = context.WithCancel(c.UserContext())
+		}
+		defer cancel()
+		stop := context.AfterFunc(parent, cancel)
+		defer stop()
+		// AfterFunc cancels asynchronously, requests arriving after parent was cancelled must not start at all
+		if parent.Err() != nil {
+			cancel()
+		}
+
+		if requestID, ok := c.Locals(RequestIDLocal).(string); ok {
+			ctx = logging.WithRequestID(ctx, requestID)
+		}
+
+		c.SetUserContext(ctx)
+		return c.Next()
+	}
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type testContextKey struct{}
+
+func TestRequestContext(t *testing.T) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	cancelParent()
+
+	tests := []struct {
+		name         string
+		parent       context.Context
+		timeout      time.Duration
+		wantDeadline bool
+		wantErr      error
+	}{
+		{name: "no timeout", parent: context.Background()},
+		{name: "timeout", parent: context.Background(), timeout: time.Minute, wantDeadline: true},
+		{name: "parent cancelled", parent: parent, timeout: time.Minute, wantDeadline: true, wantErr: context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requestCtx context.Context
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				c.SetUserContext(context.WithValue(c.UserContext(), testContextKey{}, "value"))
+				return c.Next()
+			})
+			app.Use(RequestContext(tt.parent, tt.timeout))
+			app.Get("/", func(c *fiber.Ctx) error {
+				requestCtx = c.UserContext()
+				assert.ErrorIs(t, requestCtx.Err(), tt.wantErr)
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+			require.NoError(t, err)
+			assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+			// the context of the request keeps the values of the preceding middlewares and ends with the request
+			assert.Equal(t, "value", requestCtx.Value(testContextKey{}))
+			_, hasDeadline := requestCtx.Deadline()
+			assert.Equal(t, tt.wantDeadline, hasDeadline)
+			assert.ErrorIs(t, requestCtx.Err(), context.Canceled)
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package middleware
+
+import "github.com/gofiber/fiber/v2"
+
+// handleError passes err to the error handler of the app, so the tracing, metrics and access log middlewares see
+// the status sent to the client. The error is handled by the innermost of them, the others receive nil.
+func handleError(c *fiber.Ctx, err error) {
+	if err == nil {
+		return
+	}
+
+	if err := c.App().ErrorHandler(c, err); err != nil {
+		_ = c.SendStatus(fiber.StatusInternalServerError)
+	}
+}
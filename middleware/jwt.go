@@ -1,46 +1,184 @@
 package middleware
 
 import (
+	"context"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/sean-b-martin/dynamic-webforms-server/auth"
+	"github.com/sean-b-martin/dynamic-webforms-server/logging"
+	"github.com/sean-b-martin/dynamic-webforms-server/model"
+	"slices"
 	"strings"
 )
 
 var UserIDLocal = "userID"
 
+// SessionIDLocal holds the ID of the session of the JWT a request is authenticated with, it is not set for API keys.
+var SessionIDLocal = "sessionID"
+
+// ScopesLocal, RolesLocal and TenantLocal hold the grants of the token or API key a request is authenticated with.
+// API keys have no roles, only the keys of a tenant have a tenant.
+var (
+	ScopesLocal = "scopes"
+	RolesLocal  = "roles"
+	TenantLocal = "tenant"
+)
+
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (model.APIKeyModel, error)
+}
+
+// SessionValidator rejects JWTs whose session was revoked.
+type SessionValidator interface {
+	ValidateSession(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID) error
+}
+
 type JWTAuth struct {
-	jwtService *auth.JWTService
+	jwtService    *auth.JWTService
+	apiKeys       APIKeyAuthenticator
+	sessions      SessionValidator
+	sessionCookie string
 }
 
-func NewJWTAuth(jwtService *auth.JWTService) *JWTAuth {
-	return &JWTAuth{jwtService}
+type JWTAuthOption func(*JWTAuth)
+
+// WithSessionCookie accepts the JWT in the session cookie of config if it is enabled and the request has no
+// Authorization header. Requests authenticated with the cookie have to be protected by CSRF.
+func WithSessionCookie(config SessionCookieConfig) JWTAuthOption {
+	return func(j *JWTAuth) {
+		if config.Enabled {
+			j.sessionCookie = config.Name
+		}
+	}
+}
+
+// NewJWTAuth creates the authentication with JWTs and, unless apiKeys is nil, API keys. The sessions of JWTs are
+// not checked if sessions is nil.
+func NewJWTAuth(jwtService *auth.JWTService, apiKeys APIKeyAuthenticator, sessions SessionValidator, options ...JWTAuthOption) *JWTAuth {
+	j := &JWTAuth{jwtService: jwtService, apiKeys: apiKeys, sessions: sessions}
+	for _, option := range options {
+		option(j)
+	}
+
+	return j
 }
 
+// Handle only accepts JWTs, e.g. for managing the account, which API keys must not be able to do.
 func (j *JWTAuth) Handle() fiber.Handler {
+	return j.handle(false)
+}
+
+// HandleWithAPIKeys accepts JWTs and API keys, the scopes of the keys are checked by RequireScope.
+func (j *JWTAuth) HandleWithAPIKeys() fiber.Handler {
+	return j.handle(j.apiKeys != nil)
+}
+
+// HandleOptional sets the user and the session of requests with a valid JWT and passes all other requests on without
+// a user, e.g. to log out with an expired token. The session is not validated, so the handler has to check it if
+// it does more than ending the session.
+func (j *JWTAuth) HandleOptional() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		header, ok := c.GetReqHeaders()[fiber.HeaderAuthorization]
-		if !ok || len(header) == 0 {
-			return fiber.ErrUnauthorized
+		_ = j.authenticate(c, false, false)
+		return c.Next()
+	}
+}
+
+func (j *JWTAuth) handle(allowAPIKeys bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := j.authenticate(c, allowAPIKeys, true); err != nil {
+			return err
 		}
 
-		var token string
+		return c.Next()
+	}
+}
+
+// authenticate sets the user and the grants of the token or API key of a request, the locals are only set if it
+// is valid.
+func (j *JWTAuth) authenticate(c *fiber.Ctx, allowAPIKeys bool, validateSession bool) error {
+	var token string
+	fromCookie := false
+	if header, ok := c.GetReqHeaders()[fiber.HeaderAuthorization]; ok && len(header) > 0 {
 		if token, ok = strings.CutPrefix(header[0], "Bearer "); !ok {
 			return fiber.ErrUnauthorized
 		}
+	} else if j.sessionCookie != "" && c.Cookies(j.sessionCookie) != "" {
+		token, fromCookie = c.Cookies(j.sessionCookie), true
+	} else {
+		return fiber.ErrUnauthorized
+	}
 
+	var userID uuid.UUID
+	if strings.HasPrefix(token, auth.APIKeyPrefix) {
+		// API keys are not issued as cookies
+		if !allowAPIKeys || fromCookie {
+			return fiber.ErrUnauthorized
+		}
+
+		// the error of an invalid key is returned as is, the error handler responds with its status
+		apiKey, err := j.apiKeys.AuthenticateAPIKey(c.UserContext(), token)
+		if err != nil {
+			return err
+		}
+
+		userID = apiKey.UserID
+		c.Locals(ScopesLocal, apiKey.Scopes)
+		c.Locals(TenantLocal, apiKey.Tenant)
+	} else {
+		_, span := tracer.Start(c.UserContext(), "JWTAuth.ValidateToken")
 		claims, err := j.jwtService.ValidateToken(token)
+		span.End()
 		if err != nil {
 			return fiber.ErrUnauthorized
 		}
 
-		userID, err := uuid.Parse(claims.Subject)
+		if userID, err = uuid.Parse(claims.Subject); err != nil {
+			return fiber.ErrUnauthorized
+		}
+
+		sessionID, err := uuid.Parse(claims.ID)
 		if err != nil {
 			return fiber.ErrUnauthorized
 		}
+		if j.sessions != nil && validateSession {
+			if err := j.sessions.ValidateSession(c.UserContext(), userID, sessionID); err != nil {
+				return err
+			}
+		}
 
-		c.Locals(UserIDLocal, userID)
+		c.Locals(SessionIDLocal, sessionID)
+		c.Locals(ScopesLocal, claims.Scopes)
+		c.Locals(RolesLocal, claims.Roles)
+		c.Locals(TenantLocal, claims.Tenant)
+	}
+
+	c.Locals(UserIDLocal, userID)
+	c.SetUserContext(logging.WithUserID(c.UserContext(), userID))
+	return nil
+}
+
+// RequireScope rejects requests whose token or API key lacks one of the scopes. It follows JWTAuth.Handle or
+// JWTAuth.HandleWithAPIKeys.
+func RequireScope(scopes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if granted, _ := c.Locals(ScopesLocal).([]string); !auth.HasScopes(granted, scopes...) {
+			return fiber.NewError(fiber.StatusForbidden, "missing scope "+strings.Join(scopes, " "))
+		}
 
 		return c.Next()
 	}
 }
+
+// RequireRole rejects requests whose token has none of the roles. It follows JWTAuth.Handle.
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		granted, _ := c.Locals(RolesLocal).([]string)
+		for _, role := range roles {
+			if slices.Contains(granted, role) {
+				return c.Next()
+			}
+		}
+
+		return fiber.NewError(fiber.StatusForbidden, "missing role "+strings.Join(roles, " or "))
+	}
+}
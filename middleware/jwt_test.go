@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJWTAuth_Grants(t *testing.T) {
+	jwtService, err := auth.NewJWTService()
+	require.NoError(t, err)
+	otherAudience, err := auth.NewJWTService(auth.WithAudience("other"))
+	require.NoError(t, err)
+
+	authMiddleware := NewJWTAuth(jwtService, nil, nil)
+	app := fiber.New()
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	app.Get("/forms", authMiddleware.Handle(), RequireScope(auth.ScopeFormsRead), ok)
+	app.Post("/forms", authMiddleware.Handle(), RequireScope(auth.ScopeFormsRead, auth.ScopeFormsWrite), ok)
+	app.Get("/admin", authMiddleware.Handle(), RequireRole("admin", "owner"), ok)
+
+	newToken := func(service *auth.JWTService, grants auth.TokenGrants) string {
+		token, err := service.NewToken(uuid.New(), uuid.New(), grants)
+		require.NoError(t, err)
+		return token
+	}
+	reader := newToken(jwtService, auth.TokenGrants{Scopes: []string{auth.ScopeFormsRead}})
+	admin := newToken(jwtService, auth.TokenGrants{Roles: []string{"admin"}})
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{name: "granted scope", method: fiber.MethodGet, path: "/forms", token: reader, wantStatus: fiber.StatusOK},
+		{name: "missing scope", method: fiber.MethodPost, path: "/forms", token: reader,
+			wantStatus: fiber.StatusForbidden},
+		{name: "no scopes", method: fiber.MethodGet, path: "/forms", token: admin, wantStatus: fiber.StatusForbidden},
+		{name: "granted role", method: fiber.MethodGet, path: "/admin", token: admin, wantStatus: fiber.StatusOK},
+		{name: "missing role", method: fiber.MethodGet, path: "/admin", token: reader,
+			wantStatus: fiber.StatusForbidden},
+		{name: "other audience", method: fiber.MethodGet, path: "/forms",
+			token:      newToken(otherAudience, auth.TokenGrants{Scopes: auth.Scopes}),
+			wantStatus: fiber.StatusUnauthorized},
+		{name: "API keys not accepted", method: fiber.MethodGet, path: "/forms", token: auth.APIKeyPrefix + "key",
+			wantStatus: fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set(fiber.HeaderAuthorization, "Bearer "+tt.token)
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sean-b-martin/dynamic-webforms-server/metrics"
+	"time"
+)
+
+// Metrics records the count and latency of requests per route and status.
+func Metrics() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		handleError(c, c.Next())
+		metrics.ObserveRequest(c.Method(), c.Route().Path, c.Response().StatusCode(), time.Since(start))
+		return nil
+	}
+}
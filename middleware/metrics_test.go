@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sean-b-martin/dynamic-webforms-server/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	app := fiber.New()
+	app.Use(Metrics())
+	app.Get("/metrics", metrics.Handler())
+	app.Get("/forms/:formID", func(c *fiber.Ctx) error {
+		if c.Params("formID") == "missing" {
+			return fiber.ErrNotFound
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	for _, path := range []string{"/forms/1", "/forms/2", "/forms/missing"} {
+		_, err := app.Test(httptest.NewRequest(fiber.MethodGet, path, nil))
+		require.NoError(t, err)
+	}
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/metrics", nil))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	// requests are counted per route, errors with the status sent by the error handler
+	assert.Contains(t, string(body), `webforms_http_requests_total{method="GET",route="/forms/:formID",status="200"} 2`)
+	assert.Contains(t, string(body), `webforms_http_requests_total{method="GET",route="/forms/:formID",status="404"} 1`)
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/ratelimit"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimit rejects requests with 429 Too Many Requests once the limit of their key is exhausted. name separates
+// the counters of different limits, requests for which key returns an empty key are not limited. Keys are hashed,
+// they are taken from requests and can be of any length.
+func RateLimit(store ratelimit.Store, name string, limit ratelimit.Limit, key func(c *fiber.Ctx) string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !limit.Enabled() {
+			return c.Next()
+		}
+
+		requestKey := key(c)
+		if requestKey == "" {
+			return c.Next()
+		}
+
+		hash := sha256.Sum256([]byte(requestKey))
+		allowed, resetAt, err := ratelimit.Allow(c.UserContext(), store, limit, name+":"+hex.EncodeToString(hash[:]))
+		if err != nil {
+			return err
+		}
+
+		if !allowed {
+			retryAfter := int(math.Ceil(time.Until(resetAt).Seconds()))
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(max(retryAfter, 1)))
+			return fiber.ErrTooManyRequests
+		}
+
+		return c.Next()
+	}
+}
+
+// KeyByIP limits requests per client IP. Behind a trusted proxy, the rightmost address of the proxy header is the
+// client IP, as the proxy appends it to the addresses sent by the client. c.IP would return the leftmost address,
+// which clients can set to any value.
+func KeyByIP(c *fiber.Ctx) string {
+	header := c.App().Config().ProxyHeader
+	if header == "" || !c.IsProxyTrusted() {
+		return c.Context().RemoteIP().String()
+	}
+
+	addresses := strings.Split(c.Get(header), ",")
+	ip := net.ParseIP(strings.TrimSpace(addresses[len(addresses)-1]))
+	if ip == nil {
+		return c.Context().RemoteIP().String()
+	}
+
+	return ip.String()
+}
+
+// KeyByUser limits requests per authenticated user, it has to run after the authentication.
+func KeyByUser(c *fiber.Ctx) string {
+	userID, ok := c.Locals(UserIDLocal).(uuid.UUID)
+	if !ok {
+		return ""
+	}
+
+	return userID.String()
+}
+
+// KeyByUsername limits requests per username sent in the JSON body, regardless of the client sending them.
+func KeyByUsername(c *fiber.Ctx) string {
+	var body struct {
+		Username string `json:"username"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return ""
+	}
+
+	return strings.ToLower(body.Username)
+}
+
+// KeyByEmail limits requests per email sent in the JSON body, e.g. so a mailbox cannot be flooded with emails.
+func KeyByEmail(c *fiber.Ctx) string {
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimSpace(body.Email))
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	app := fiber.New()
+	app.Post("/login", RateLimit(ratelimit.NewMemoryStore(), "login", ratelimit.Limit{Requests: 2, WindowSeconds: 60},
+		KeyByUsername), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "first request", body: `{"username": "alice"}`, wantStatus: fiber.StatusOK},
+		{name: "second request", body: `{"username": "Alice"}`, wantStatus: fiber.StatusOK},
+		{name: "limit exceeded", body: `{"username": "alice"}`, wantStatus: fiber.StatusTooManyRequests},
+		{name: "other username", body: `{"username": "bob"}`, wantStatus: fiber.StatusOK},
+		{name: "no username", body: `not json`, wantStatus: fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodPost, "/login", strings.NewReader(tt.body))
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			if tt.wantStatus == fiber.StatusTooManyRequests {
+				assert.NotEmpty(t, resp.Header.Get(fiber.HeaderRetryAfter))
+			}
+		})
+	}
+}
+
+func TestKeyByUser(t *testing.T) {
+	userID := uuid.New()
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		if c.Query("user") != "" {
+			c.Locals(UserIDLocal, userID)
+		}
+		return c.SendString(KeyByUser(c))
+	})
+
+	tests := []struct {
+		name    string
+		path    string
+		wantKey string
+	}{
+		{name: "authenticated", path: "/?user=1", wantKey: userID.String()},
+		{name: "unauthenticated", path: "/", wantKey: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, tt.path, nil))
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantKey, string(body))
+		})
+	}
+}
+
+func TestKeyByIP(t *testing.T) {
+	newApp := func(trustedProxies ...string) *fiber.App {
+		app := fiber.New(fiber.Config{ProxyHeader: fiber.HeaderXForwardedFor, EnableTrustedProxyCheck: true,
+			TrustedProxies: trustedProxies, EnableIPValidation: true})
+		app.Get("/", func(c *fiber.Ctx) error {
+			return c.SendString(KeyByIP(c))
+		})
+		return app
+	}
+
+	// requests of app.Test come from 0.0.0.0
+	tests := []struct {
+		name         string
+		app          *fiber.App
+		forwardedFor string
+		wantKey      string
+	}{
+		{name: "no proxy", app: newApp(), forwardedFor: "203.0.113.7", wantKey: "0.0.0.0"},
+		{name: "trusted proxy", app: newApp("0.0.0.0"), forwardedFor: "203.0.113.7", wantKey: "203.0.113.7"},
+		{name: "spoofed address", app: newApp("0.0.0.0"), forwardedFor: "198.51.100.1, 203.0.113.7",
+			wantKey: "203.0.113.7"},
+		{name: "invalid address", app: newApp("0.0.0.0"), forwardedFor: "203.0.113.7, unknown", wantKey: "0.0.0.0"},
+		{name: "no header", app: newApp("0.0.0.0"), wantKey: "0.0.0.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			if tt.forwardedFor != "" {
+				req.Header.Set(fiber.HeaderXForwardedFor, tt.forwardedFor)
+			}
+			resp, err := tt.app.Test(req)
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantKey, string(body))
+		})
+	}
+}
+
+// keyRecordingStore records the keys of the limited requests.
+type keyRecordingStore struct {
+	ratelimit.Store
+	keys []string
+}
+
+func (s *keyRecordingStore) Increment(ctx context.Context, key string, window time.Duration) (int, time.Time, error) {
+	s.keys = append(s.keys, key)
+	return s.Store.Increment(ctx, key, window)
+}
+
+func TestRateLimit_LongKey(t *testing.T) {
+	store := &keyRecordingStore{Store: ratelimit.NewMemoryStore()}
+	app := fiber.New()
+	app.Post("/login", RateLimit(store, "login", ratelimit.Limit{Requests: 1, WindowSeconds: 60}, KeyByUsername),
+		func(c *fiber.Ctx) error {
+			return c.SendStatus(fiber.StatusOK)
+		})
+
+	// the keys are stored in a varchar(256) column by the database store
+	body := `{"username": "` + strings.Repeat("a", 1000) + `"}`
+	for _, wantStatus := range []int{fiber.StatusOK, fiber.StatusTooManyRequests} {
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodPost, "/login", strings.NewReader(body)))
+		require.NoError(t, err)
+		assert.Equal(t, wantStatus, resp.StatusCode)
+	}
+
+	require.Len(t, store.keys, 2)
+	assert.LessOrEqual(t, len(store.keys[0]), 256)
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"regexp"
+)
+
+var RequestIDLocal = "requestID"
+
+// requestIDPattern restricts the request IDs accepted from clients, so they can not forge log records.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// RequestID assigns an ID to each request, which is returned in the X-Request-ID header. A valid ID sent by a
+// client or a proxy in the header is kept, so requests can be correlated across services.
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requestID := c.Get(fiber.HeaderXRequestID)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = utils.UUIDv4()
+		}
+
+		c.Set(fiber.HeaderXRequestID, requestID)
+		c.Locals(RequestIDLocal, requestID)
+		return c.Next()
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	app := fiber.New()
+	app.Use(RequestID())
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(c.Locals(RequestIDLocal).(string))
+	})
+
+	tests := []struct {
+		name      string
+		requestID string
+		wantKept  bool
+	}{
+		{name: "no request ID", requestID: "", wantKept: false},
+		{name: "valid request ID", requestID: "0dedc7be-8e1c-431a", wantKept: true},
+		{name: "invalid characters", requestID: `id"} {"level":"ERROR"`, wantKept: false},
+		{name: "too long", requestID: strings.Repeat("a", 129), wantKept: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			req.Header.Set(fiber.HeaderXRequestID, tt.requestID)
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+
+			requestID := resp.Header.Get(fiber.HeaderXRequestID)
+			assert.NotEmpty(t, requestID)
+			if tt.wantKept {
+				assert.Equal(t, tt.requestID, requestID)
+			} else {
+				assert.NotEqual(t, tt.requestID, requestID)
+			}
+		})
+	}
+}
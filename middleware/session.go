@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"github.com/gofiber/fiber/v2"
+	"time"
+)
+
+const (
+	// CSRFCookieName is readable by the browser app, which sends its value in CSRFHeader.
+	CSRFCookieName = "csrf_token"
+	CSRFHeader     = "X-CSRF-Token"
+)
+
+// SessionCookieConfig configures issuing the JWT of a login as an HttpOnly cookie, so browser apps do not keep the
+// token where scripts can read it. The cookie expires with the browser session, the token itself expires earlier.
+type SessionCookieConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Name     string `json:"name" validate:"required"`
+	Domain   string `json:"domain"`
+	Secure   bool   `json:"secure"`
+	SameSite string `json:"sameSite" validate:"oneof=strict lax"`
+	// AppURL is the page of the browser app logins opened by the browser, e.g. the OIDC callback, redirect to.
+	AppURL string `json:"appURL" validate:"required_if=Enabled true,omitempty,url"`
+}
+
+// SetSession sets the session cookie with token and a new CSRF cookie, it returns the CSRF token.
+func (s SessionCookieConfig) SetSession(c *fiber.Ctx, token string) (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	csrfToken := base64.RawURLEncoding.EncodeToString(data)
+
+	c.Cookie(s.cookie(s.Name, token, true))
+	c.Cookie(s.cookie(CSRFCookieName, csrfToken, false))
+	return csrfToken, nil
+}
+
+// ClearSession expires the session and CSRF cookies.
+func (s SessionCookieConfig) ClearSession(c *fiber.Ctx) {
+	for _, cookie := range []*fiber.Cookie{s.cookie(s.Name, "", true), s.cookie(CSRFCookieName, "", false)} {
+		cookie.Expires = time.Unix(0, 0)
+		c.Cookie(cookie)
+	}
+}
+
+func (s SessionCookieConfig) cookie(name string, value string, httpOnly bool) *fiber.Cookie {
+	return &fiber.Cookie{Name: name, Value: value, Path: "/", Domain: s.Domain, Secure: s.Secure, HTTPOnly: httpOnly,
+		SameSite: s.SameSite}
+}
+
+// CSRF implements the double-submit protection of requests authenticated with the session cookie, which the
+// browser also sends with requests forged by other sites. State-changing requests have to send the value of the CSRF
+// cookie in CSRFHeader, which other sites cannot read. Requests with an Authorization header are authenticated by it
+// and not checked.
+func CSRF(config SessionCookieConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions, fiber.MethodTrace:
+			return c.Next()
+		}
+
+		if c.Cookies(config.Name) == "" || c.Get(fiber.HeaderAuthorization) != "" {
+			return c.Next()
+		}
+
+		cookie := c.Cookies(CSRFCookieName)
+		if cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(c.Get(CSRFHeader))) != 1 {
+			return fiber.NewError(fiber.StatusForbidden, "missing or invalid CSRF token")
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/sean-b-martin/dynamic-webforms-server/middleware")
+
+// Tracing starts a server span for each request, continuing the trace of the client if the request carries a W3C
+// trace context. The span is stored in the user context, so the spans of the services and queries become its
+// children.
+func Tracing() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), requestHeaderCarrier{c})
+		ctx, span := tracer.Start(ctx, c.Method(), trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Method()),
+				semconv.URLPath(c.Path()),
+			))
+		defer span.End()
+
+		c.SetUserContext(ctx)
+		handleError(c, c.Next())
+
+		// the route is known once the request has been routed
+		route := c.Route().Path
+		status := c.Response().StatusCode()
+		span.SetName(c.Method() + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route), semconv.HTTPResponseStatusCode(status))
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, "")
+		}
+
+		return nil
+	}
+}
+
+// requestHeaderCarrier reads the trace context from the headers of a request.
+type requestHeaderCarrier struct {
+	c *fiber.Ctx
+}
+
+var _ propagation.TextMapCarrier = requestHeaderCarrier{}
+
+func (r requestHeaderCarrier) Get(key string) string {
+	return r.c.Get(key)
+}
+
+func (r requestHeaderCarrier) Set(key string, value string) {
+	r.c.Request().Header.Set(key, value)
+}
+
+func (r requestHeaderCarrier) Keys() []string {
+	keys := make([]string, 0)
+	r.c.Request().Header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+type SchemaFieldType string
+
+const (
+	SchemaFieldTypeText    SchemaFieldType = "text"
+	SchemaFieldTypeNumber  SchemaFieldType = "number"
+	SchemaFieldTypeDate    SchemaFieldType = "date"
+	SchemaFieldTypeChoice  SchemaFieldType = "choice"
+	SchemaFieldTypeBoolean SchemaFieldType = "boolean"
+	SchemaFieldTypeFile    SchemaFieldType = "file"
+)
+
+var schemaFieldNameRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,62}$`)
+
+// SchemaField describes a single field of a form schema. Only the properties the server needs to
+// interpret submissions are parsed, all other properties are left to the client.
+type SchemaField struct {
+	Name    string          `json:"name"`
+	Label   string          `json:"label"`
+	Type    SchemaFieldType `json:"type"`
+	Options []string        `json:"options,omitempty"`
+	// Indexed marks fields that are queried frequently, an expression index is created for them.
+	Indexed bool `json:"indexed,omitempty"`
+}
+
+type SchemaDefinition struct {
+	Fields []SchemaField `json:"fields"`
+}
+
+func ParseSchemaDefinition(data []byte) (SchemaDefinition, error) {
+	var definition SchemaDefinition
+	if len(data) == 0 {
+		return definition, nil
+	}
+
+	if err := json.Unmarshal(data, &definition); err != nil {
+		return definition, fmt.Errorf("invalid schema definition: %w", err)
+	}
+
+	for _, field := range definition.Fields {
+		if !schemaFieldNameRegex.MatchString(field.Name) {
+			return definition, fmt.Errorf("invalid schema field name %q", field.Name)
+		}
+	}
+
+	return definition, nil
+}
+
+func (d SchemaDefinition) Field(name string) (SchemaField, bool) {
+	for _, field := range d.Fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+
+	return SchemaField{}, false
+}
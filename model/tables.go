@@ -1,52 +1,221 @@
 package model
 
 import (
+	"context"
+	"encoding/json"
 	"github.com/google/uuid"
 	"github.com/uptrace/bun"
+	"time"
 )
 
 type TableID struct {
-	ID uuid.UUID `bun:"id,type:uuid,pk,default:uuid_generate_v4()"`
+	ID uuid.UUID `bun:"id,type:uuid,pk"`
+}
+
+// BeforeAppendModel generates the ID of inserted rows, so it does not depend on a database function.
+func (t *TableID) BeforeAppendModel(_ context.Context, query bun.Query) error {
+	if _, ok := query.(*bun.InsertQuery); ok && t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+
+	return nil
+}
+
+// TableAudit records when and by whom a row was created and last updated. The created and updated by columns
+// are null for rows created or updated without an authenticated user, e.g. a user registering.
+type TableAudit struct {
+	CreatedAt time.Time     `bun:"created_at,nullzero,notnull,default:current_timestamp" json:"createdAt"`
+	UpdatedAt time.Time     `bun:"updated_at,nullzero,notnull,default:current_timestamp" json:"updatedAt"`
+	CreatedBy uuid.NullUUID `bun:"created_by,type:uuid" json:"createdBy"`
+	UpdatedBy uuid.NullUUID `bun:"updated_by,type:uuid" json:"updatedBy"`
+}
+
+var (
+	AuditColumnsCreate = []string{"created_at", "updated_at", "created_by", "updated_by"}
+	AuditColumnsUpdate = []string{"updated_at", "updated_by"}
+)
+
+type Audited interface {
+	SetCreated(userID uuid.UUID)
+	SetUpdated(userID uuid.UUID)
+}
+
+func (a *TableAudit) SetCreated(userID uuid.UUID) {
+	a.CreatedAt = time.Now().UTC()
+	a.CreatedBy = uuid.NullUUID{UUID: userID, Valid: userID != uuid.Nil}
+	a.UpdatedAt = a.CreatedAt
+	a.UpdatedBy = a.CreatedBy
+}
+
+func (a *TableAudit) SetUpdated(userID uuid.UUID) {
+	a.UpdatedAt = time.Now().UTC()
+	a.UpdatedBy = uuid.NullUUID{UUID: userID, Valid: userID != uuid.Nil}
+}
+
+// TableSoftDelete marks a row as deleted instead of removing it, bun excludes soft deleted rows from all queries
+// built on the model unless WhereDeleted or WhereAllWithDeleted is used.
+type TableSoftDelete struct {
+	DeletedAt *time.Time `bun:"deleted_at,soft_delete,nullzero" json:"deletedAt,omitempty"`
+}
+
+// TableRowVersion is incremented on every update of a row and used for optimistic concurrency control.
+type TableRowVersion struct {
+	RowVersion int64 `bun:"row_version,notnull,default:1" json:"rowVersion"`
+}
+
+type Versioned interface {
+	GetRowVersion() int64
+}
+
+func (v *TableRowVersion) GetRowVersion() int64 {
+	return v.RowVersion
 }
 
 type UserModel struct {
 	bun.BaseModel `bun:"table:users"`
 	TableID
-	Username string `bun:"username,type:varchar(128),notnull,unique" json:"username"`
-	Password string `bun:"password,type:varchar(60),notnull" json:"-"`
+	TableAudit
+	Username     string     `bun:"username,type:varchar(128),notnull,unique" json:"username"`
+	Password     string     `bun:"password,type:varchar(255),notnull" json:"-"`
+	FailedLogins int        `bun:"failed_logins,notnull,default:0" json:"-"`
+	LockedUntil  *time.Time `bun:"locked_until" json:"-"`
+	// Email is optional and stored in lower case, EmailVerifiedAt is reset whenever the email changes. Only verified
+	// emails are unique.
+	Email           string     `bun:"email,type:varchar(254),nullzero" json:"email,omitempty"`
+	EmailVerifiedAt *time.Time `bun:"email_verified_at" json:"-"`
+	// TOTPSecret is set once the user started the enrollment of two-factor authentication, which is only required
+	// on login after the enrollment was confirmed with a code at TOTPEnabledAt. TOTPLastStep is the time step of
+	// the last accepted code, codes of the same or earlier steps are rejected.
+	TOTPSecret    string     `bun:"totp_secret,type:varchar(64),nullzero" json:"-"`
+	TOTPEnabledAt *time.Time `bun:"totp_enabled_at" json:"-"`
+	TOTPLastStep  int64      `bun:"totp_last_step,notnull,default:0" json:"-"`
+	// Roles and Tenant are assigned by an administrator in the database and added to the tokens issued on login.
+	Roles  []string `bun:"roles" json:"roles,omitempty"`
+	Tenant string   `bun:"tenant,type:varchar(64),nullzero" json:"tenant,omitempty"`
+}
+
+// UserIdentityModel links a user to the subject of an external identity provider, Issuer identifies the provider.
+type UserIdentityModel struct {
+	bun.BaseModel `bun:"table:user_identities"`
+	TableID
+	UserID    uuid.UUID `bun:"user_id,type:uuid,notnull"`
+	Issuer    string    `bun:"issuer,type:varchar(256),notnull,unique:user_identities_issuer_subject"`
+	Subject   string    `bun:"subject,type:varchar(256),notnull,unique:user_identities_issuer_subject"`
+	CreatedAt time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp"`
+}
+
+// SessionModel is a login of a user, its ID is the ID (jti) of the access token issued on login. Tokens are only
+// accepted while their session exists, deleting it revokes the token.
+type SessionModel struct {
+	bun.BaseModel `bun:"table:sessions"`
+	TableID
+	UserID     uuid.UUID `bun:"user_id,type:uuid,notnull" json:"-"`
+	UserAgent  string    `bun:"user_agent,type:varchar(512),notnull" json:"userAgent"`
+	IP         string    `bun:"ip,type:varchar(64),notnull" json:"ip"`
+	CreatedAt  time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp" json:"createdAt"`
+	LastSeenAt time.Time `bun:"last_seen_at,notnull" json:"lastSeenAt"`
+	ExpiresAt  time.Time `bun:"expires_at,notnull" json:"expiresAt"`
+}
+
+// APIKeyModel is a long-lived key of a user for machine-to-machine access, restricted to Scopes. Only the SHA-256
+// hash of the key is stored, Prefix is the start of the key which identifies it in listings.
+//
+// Keys with a Tenant are owned by the tenant and managed by all of its users. As forms are owned by users, a key
+// always acts as the user who created it, UserID, and is deleted with that user.
+type APIKeyModel struct {
+	bun.BaseModel `bun:"table:api_keys"`
+	TableID
+	UserID     uuid.UUID  `bun:"user_id,type:uuid,notnull" json:"-"`
+	Tenant     string     `bun:"tenant,type:varchar(64),nullzero" json:"tenant,omitempty"`
+	Name       string     `bun:"name,type:varchar(64),notnull" json:"name"`
+	Prefix     string     `bun:"prefix,type:varchar(16),notnull,unique" json:"prefix"`
+	KeyHash    string     `bun:"key_hash,type:varchar(64),notnull,unique" json:"-"`
+	Scopes     []string   `bun:"scopes,notnull" json:"scopes"`
+	ExpiresAt  *time.Time `bun:"expires_at" json:"expiresAt"`
+	LastUsedAt *time.Time `bun:"last_used_at" json:"lastUsedAt"`
+	CreatedAt  time.Time  `bun:"created_at,nullzero,notnull,default:current_timestamp" json:"createdAt"`
+}
+
+// RecoveryCodeModel is a single-use code replacing the TOTP code on login, e.g. when the device with the
+// authenticator app was lost. Only the SHA-256 hash of the code is stored.
+type RecoveryCodeModel struct {
+	bun.BaseModel `bun:"table:recovery_codes"`
+	TableID
+	UserID    uuid.UUID `bun:"user_id,type:uuid,notnull"`
+	CodeHash  string    `bun:"code_hash,type:varchar(64),notnull,unique"`
+	CreatedAt time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp"`
+}
+
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+)
+
+// UserTokenModel is a single-use token sent to a user by email. Only the SHA-256 hash of the token is stored, so
+// the tokens cannot be used by someone reading the table. Email is the address the token was sent to.
+type UserTokenModel struct {
+	bun.BaseModel `bun:"table:user_tokens"`
+	TableID
+	UserID    uuid.UUID `bun:"user_id,type:uuid,notnull"`
+	Purpose   string    `bun:"purpose,type:varchar(32),notnull"`
+	TokenHash string    `bun:"token_hash,type:varchar(64),notnull,unique"`
+	Email     string    `bun:"email,type:varchar(254),notnull"`
+	ExpiresAt time.Time `bun:"expires_at,notnull"`
+	CreatedAt time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp"`
 }
 
 type FormModel struct {
 	bun.BaseModel `bun:"table:forms"`
 	TableID
+	TableAudit
+	TableSoftDelete
+	TableRowVersion
 	UserID string `bun:"user_id,type:uuid" json:"userID"`
 	Title  string `bun:"title,type:varchar(256),notnull" json:"title"`
+	// SubmissionsPerHour limits the submissions of each user to the form, zero allows unlimited submissions.
+	SubmissionsPerHour int `bun:"submissions_per_hour,notnull,default:0" json:"submissionsPerHour"`
 }
 
 type FormSchemaModel struct {
 	bun.BaseModel `bun:"table:form_schemas"`
 	TableID
-	FormID   uuid.UUID `bun:"form_id,type:uuid,notnull" json:"formID"`
-	Title    string    `bun:"title,type:varchar(256),notnull" json:"title"`
-	Version  string    `bun:"version,type:varchar(64),notnull" json:"version"`
-	Schema   []byte    `bun:"schema,type:jsonb" json:"schema"`
-	ReadOnly bool      `bun:"read_only,notnull,default:false" json:"readOnly"`
+	TableAudit
+	TableSoftDelete
+	TableRowVersion
+	FormID   uuid.UUID       `bun:"form_id,type:uuid,notnull" json:"formID"`
+	Title    string          `bun:"title,type:varchar(256),notnull" json:"title"`
+	Version  string          `bun:"version,type:varchar(64),notnull" json:"version"`
+	Schema   json.RawMessage `bun:"schema" json:"schema"`
+	ReadOnly bool            `bun:"read_only,notnull,default:false" json:"readOnly"`
 }
 
 type FormDataModel struct {
 	bun.BaseModel `bun:"table:form_data"`
 	TableID
-	UserID       uuid.UUID `bun:"user_id,type:uuid,notnull" json:"userID"`
-	FormSchemaID uuid.UUID `bun:"form_schema_id,type:uuid,notnull" json:"formSchemaID"`
-	Name         string    `bun:"name,type:varchar(64),notnull" json:"name"`
-	Data         []byte    `bun:"data,type:jsonb" json:"data"`
+	TableAudit
+	TableSoftDelete
+	TableRowVersion
+	// UserID is null for submissions of deleted users, which are kept for the owner of the form
+	UserID       uuid.NullUUID   `bun:"user_id,type:uuid" json:"userID"`
+	FormSchemaID uuid.UUID       `bun:"form_schema_id,type:uuid,notnull" json:"formSchemaID"`
+	Name         string          `bun:"name,type:varchar(64),notnull" json:"name"`
+	Data         json.RawMessage `bun:"data" json:"data"`
 }
 
 type FileMetadataModel struct {
 	bun.BaseModel `bun:"table:file_metadata"`
 	TableID
+	TableAudit
 	FormDataID         uuid.UUID `bun:"form_data_id,type:uuid,notnull" json:"formDataID"`
 	OriginalFilename   string    `bun:"original_filename,type:varchar(256),notnull" json:"originalFilename"`
 	Path               string    `bun:"path,type:varchar(512),notnull" json:"path"`
 	MappingSchemaField int64     `bun:"mapping_schema_field,type:bigint,notnull" json:"mappingSchemaField"`
 }
+
+// RateLimitModel counts the requests of a rate limit key in the current window.
+type RateLimitModel struct {
+	bun.BaseModel `bun:"table:rate_limits"`
+	Key           string    `bun:"key,type:varchar(256),pk"`
+	Hits          int       `bun:"hits,notnull"`
+	ResetAt       time.Time `bun:"reset_at,notnull"`
+}
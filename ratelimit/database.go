@@ -0,0 +1,44 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/sean-b-martin/dynamic-webforms-server/model"
+	"github.com/uptrace/bun"
+	"time"
+)
+
+// DBStore keeps the counters in the rate_limits table, so the limits apply to all replicas sharing the database.
+type DBStore struct {
+	db bun.IDB
+}
+
+var _ Store = (*DBStore)(nil)
+
+func NewDBStore(db bun.IDB) *DBStore {
+	return &DBStore{db: db}
+}
+
+func (d *DBStore) Increment(ctx context.Context, key string, window time.Duration) (int, time.Time, error) {
+	now := time.Now().UTC()
+	row := model.RateLimitModel{Key: key, Hits: 1, ResetAt: now.Add(window)}
+
+	// the counter is reset and incremented by a single statement, so concurrent requests are never lost
+	err := d.db.NewInsert().Model(&row).
+		On("CONFLICT (key) DO UPDATE").
+		Set("hits = CASE WHEN ?TableAlias.reset_at <= ? THEN 1 ELSE ?TableAlias.hits + 1 END", now).
+		Set("reset_at = CASE WHEN ?TableAlias.reset_at <= ? THEN EXCLUDED.reset_at ELSE ?TableAlias.reset_at END",
+			now).
+		Returning("hits, reset_at").
+		Scan(ctx, &row.Hits, &row.ResetAt)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	return row.Hits, row.ResetAt, nil
+}
+
+func (d *DBStore) DeleteExpired(ctx context.Context) error {
+	_, err := d.db.NewDelete().Model((*model.RateLimitModel)(nil)).Where("reset_at <= ?", time.Now().UTC()).
+		Exec(ctx)
+	return err
+}
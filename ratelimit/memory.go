@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryWindow struct {
+	hits    int
+	resetAt time.Time
+}
+
+// MemoryStore keeps the counters in memory, each replica of the server limits requests on its own.
+type MemoryStore struct {
+	mutex   sync.Mutex
+	windows map[string]memoryWindow
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{windows: make(map[string]memoryWindow)}
+}
+
+func (m *MemoryStore) Increment(_ context.Context, key string, window time.Duration) (int, time.Time, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	current, ok := m.windows[key]
+	if !ok || !now.Before(current.resetAt) {
+		current = memoryWindow{resetAt: now.Add(window)}
+	}
+
+	current.hits++
+	m.windows[key] = current
+	return current.hits, current.resetAt, nil
+}
+
+func (m *MemoryStore) DeleteExpired(_ context.Context) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	for key, window := range m.windows {
+		if !now.Before(window.resetAt) {
+			delete(m.windows, key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+// Package ratelimit counts requests in fixed windows. The counters are kept in a Store, the memory store is local
+// to a process while the database store is shared by all replicas of the server.
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	StoreMemory   = "memory"
+	StoreDatabase = "database"
+)
+
+// Limit allows Requests requests per window, a limit without requests is disabled.
+type Limit struct {
+	Requests      int `json:"requests" validate:"min=0"`
+	WindowSeconds int `json:"windowSeconds" validate:"min=0"`
+}
+
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.WindowSeconds > 0
+}
+
+func (l Limit) Window() time.Duration {
+	return time.Duration(l.WindowSeconds) * time.Second
+}
+
+type Store interface {
+	// Increment counts a request of key and returns the number of requests in the current window of key, a new
+	// window of the given length starts once the current one has ended.
+	Increment(ctx context.Context, key string, window time.Duration) (int, time.Time, error)
+	// DeleteExpired removes the counters of ended windows.
+	DeleteExpired(ctx context.Context) error
+}
+
+// Allow counts a request of key and reports whether it is within the limit. If not, the returned time is the end of
+// the window.
+func Allow(ctx context.Context, store Store, limit Limit, key string) (bool, time.Time, error) {
+	hits, resetAt, err := store.Increment(ctx, key, limit.Window())
+	if err != nil {
+		return false, time.Time{}, err
+	}
+
+	return hits <= limit.Requests, resetAt, nil
+}
+
+// DeleteExpiredPeriodically removes the counters of ended windows every interval until the context is done.
+func DeleteExpiredPeriodically(ctx context.Context, logger *slog.Logger, store Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := store.DeleteExpired(ctx); err != nil {
+			logger.ErrorContext(ctx, "failed deleting expired rate limits", "error", err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/sean-b-martin/dynamic-webforms-server/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStores(t *testing.T) {
+	db, err := database.CreateDatabaseConnection(database.ConnectionConfig{Driver: database.DriverSQLite,
+		Path: filepath.Join(t.TempDir(), "forms.db")})
+	require.NoError(t, err)
+	database.CreateTables(db)
+
+	stores := []struct {
+		name  string
+		store Store
+	}{
+		{name: "memory", store: NewMemoryStore()},
+		{name: "database", store: NewDBStore(db)},
+	}
+	for _, tt := range stores {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			limit := Limit{Requests: 2, WindowSeconds: 60}
+
+			for i, want := range []bool{true, true, false} {
+				allowed, resetAt, err := Allow(ctx, tt.store, limit, "login:alice")
+				require.NoError(t, err)
+				assert.Equal(t, want, allowed, "request %d", i+1)
+				assert.WithinDuration(t, time.Now().Add(time.Minute), resetAt, 5*time.Second)
+			}
+
+			// keys are counted separately
+			allowed, _, err := Allow(ctx, tt.store, limit, "login:bob")
+			require.NoError(t, err)
+			assert.True(t, allowed)
+
+			// a new window starts once the current one ended
+			hits, _, err := tt.store.Increment(ctx, "short", time.Millisecond)
+			require.NoError(t, err)
+			assert.Equal(t, 1, hits)
+			time.Sleep(5 * time.Millisecond)
+			hits, _, err = tt.store.Increment(ctx, "short", time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, 1, hits)
+
+			require.NoError(t, tt.store.DeleteExpired(ctx))
+			hits, _, err = tt.store.Increment(ctx, "login:alice", time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, 4, hits)
+		})
+	}
+}
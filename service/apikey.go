@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/auth"
+	"github.com/sean-b-martin/dynamic-webforms-server/model"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+type APIKeyService interface {
+	// GetAPIKeys returns the keys created by the user and the keys of the tenant of the user.
+	GetAPIKeys(ctx context.Context, userID uuid.UUID) ([]model.APIKeyModel, error)
+	// CreateAPIKey returns the new key, which is not stored and cannot be shown again. Keys without expiry are valid
+	// until they are deleted. With forTenant the key is owned by the tenant of the user, it returns ErrNoTenant if the
+	// user has none.
+	CreateAPIKey(ctx context.Context, userID uuid.UUID, name string, scopes []string, expiresAt *time.Time, forTenant bool) (string, model.APIKeyModel, error)
+	// DeleteAPIKey deletes a key created by the user or a key of the tenant of the user.
+	DeleteAPIKey(ctx context.Context, userID uuid.UUID, id uuid.UUID) error
+	// AuthenticateAPIKey returns the valid key matching key and records its use. It returns ErrInvalidAPIKey for
+	// unknown and expired keys.
+	AuthenticateAPIKey(ctx context.Context, key string) (model.APIKeyModel, error)
+}
+
+const (
+	// apiKeyPrefixIDSize is the number of random bytes of the hex-encoded ID following auth.APIKeyPrefix, which identifies
+	// a key in listings without revealing its secret.
+	apiKeyPrefixIDSize = 4
+	apiKeySecretSize   = 32
+	// lastUsedResolution limits the updates of the last use of a key to one per interval
+	lastUsedResolution = time.Minute
+)
+
+type apiKeyServiceImpl struct {
+	store Store
+}
+
+func NewAPIKeyService(store Store) APIKeyService {
+	return tracedAPIKeyService{next: &apiKeyServiceImpl{store: store}}
+}
+
+func (s *apiKeyServiceImpl) GetAPIKeys(ctx context.Context, userID uuid.UUID) ([]model.APIKeyModel, error) {
+	// the tenant is read from the database, as it may have changed since the token was issued
+	user, err := s.store.Repositories().Users.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.store.Repositories().APIKeys.GetAPIKeysOfUser(ctx, userID, user.Tenant)
+}
+
+func (s *apiKeyServiceImpl) CreateAPIKey(ctx context.Context, userID uuid.UUID, name string, scopes []string, expiresAt *time.Time, forTenant bool) (string, model.APIKeyModel, error) {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", model.APIKeyModel{}, ErrInvalidExpiry
+	}
+
+	var tenant string
+	if forTenant {
+		user, err := s.store.Repositories().Users.GetUserByID(ctx, userID)
+		if err != nil {
+			return "", model.APIKeyModel{}, err
+		} else if user.Tenant == "" {
+			return "", model.APIKeyModel{}, ErrNoTenant
+		}
+		tenant = user.Tenant
+	}
+
+	prefixID := make([]byte, apiKeyPrefixIDSize)
+	secret := make([]byte, apiKeySecretSize)
+	if _, err := rand.Read(prefixID); err != nil {
+		return "", model.APIKeyModel{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", model.APIKeyModel{}, err
+	}
+
+	prefix := auth.APIKeyPrefix + hex.EncodeToString(prefixID)
+	key := prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	apiKey, err := s.store.Repositories().APIKeys.InsertAPIKey(ctx, model.APIKeyModel{UserID: userID, Tenant: tenant,
+		Name: name, Prefix: prefix, KeyHash: hashToken(key), Scopes: scopes, ExpiresAt: expiresAt})
+	if err != nil {
+		return "", model.APIKeyModel{}, err
+	}
+
+	return key, apiKey, nil
+}
+
+func (s *apiKeyServiceImpl) DeleteAPIKey(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	user, err := s.store.Repositories().Users.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return s.store.Repositories().APIKeys.DeleteAPIKey(ctx, userID, user.Tenant, id)
+}
+
+func (s *apiKeyServiceImpl) AuthenticateAPIKey(ctx context.Context, key string) (model.APIKeyModel, error) {
+	if !strings.HasPrefix(key, auth.APIKeyPrefix) {
+		return model.APIKeyModel{}, ErrInvalidAPIKey
+	}
+
+	apiKey, err := s.store.Repositories().APIKeys.GetAPIKeyByHash(ctx, hashToken(key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.APIKeyModel{}, ErrInvalidAPIKey
+	} else if err != nil {
+		return model.APIKeyModel{}, err
+	}
+
+	now := time.Now().UTC()
+	if apiKey.ExpiresAt != nil && !now.Before(*apiKey.ExpiresAt) {
+		return model.APIKeyModel{}, ErrInvalidAPIKey
+	}
+
+	// the last use is informational, so failing to record it does not fail the request
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= lastUsedResolution {
+		if err := s.store.Repositories().APIKeys.UpdateAPIKeyLastUsed(ctx, apiKey.ID, now); err != nil {
+			slog.WarnContext(ctx, "failed recording last use of API key", slog.Any("error", err))
+		}
+		apiKey.LastUsedAt = &now
+	}
+
+	return apiKey, nil
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/model"
+	"github.com/uptrace/bun"
+	"time"
+)
+
+// auditCreated sets the audit fields of models embedding model.TableAudit. If columns are restricted, the audit
+// columns are added to them, otherwise all columns are written anyway.
+func auditCreated(value interface{}, actorID uuid.UUID, columns []string) []string {
+	audited, ok := value.(model.Audited)
+	if !ok {
+		return columns
+	}
+
+	audited.SetCreated(actorID)
+	if len(columns) == 0 {
+		return columns
+	}
+
+	return append(columns, model.AuditColumnsCreate...)
+}
+
+func auditUpdated(value interface{}, actorID uuid.UUID, columns []string) []string {
+	audited, ok := value.(model.Audited)
+	if !ok {
+		return columns
+	}
+
+	audited.SetUpdated(actorID)
+	if len(columns) == 0 {
+		return columns
+	}
+
+	return append(columns, model.AuditColumnsUpdate...)
+}
+
+// auditUpdateQuery sets the update audit columns for updates built with Set or SetColumn instead of a model.
+func auditUpdateQuery(query *bun.UpdateQuery, actorID uuid.UUID) *bun.UpdateQuery {
+	return query.Set("updated_at = ?", time.Now().UTC()).
+		Set("updated_by = ?", uuid.NullUUID{UUID: actorID, Valid: actorID != uuid.Nil})
+}
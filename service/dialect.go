@@ -0,0 +1,12 @@
+package service
+
+import (
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+// isPostgres reports whether db uses Postgres. Full-text search, statistics, submission filters and the indexes
+// backing them rely on Postgres features and are not supported by SQLite.
+func isPostgres(db bun.IDB) bool {
+	return db.Dialect().Name() == dialect.PG
+}
@@ -1,7 +1,57 @@
 package service
 
-import "errors"
+import "github.com/sean-b-martin/dynamic-webforms-server/validation"
+
+// ErrorKind classifies the errors returned by the services, the controllers map each kind to an HTTP status.
+type ErrorKind int
+
+const (
+	KindNotFound ErrorKind = iota + 1
+	KindForbidden
+	KindUnauthorized
+	KindConflict
+	KindPreconditionFailed
+	KindValidation
+	KindNotSupported
+	KindRateLimited
+)
+
+// Error is an expected error of a service. Code is a stable identifier of the error which is returned to clients,
+// errors wrapping an Error with fmt.Errorf add details to it. Fields lists the invalid fields of validation errors.
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	Fields  []validation.ErrorResponse
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
 
 var (
-	ErrNoPermission = errors.New("no permission")
+	ErrNotFound             = &Error{Kind: KindNotFound, Code: "not_found", Message: "resource not found"}
+	ErrNoPermission         = &Error{Kind: KindForbidden, Code: "no_permission", Message: "no permission"}
+	ErrInvalidCredentials   = &Error{Kind: KindUnauthorized, Code: "invalid_credentials", Message: "invalid username or password"}
+	ErrWrongPassword        = &Error{Kind: KindForbidden, Code: "wrong_password", Message: "wrong current password"}
+	ErrUsernameExists       = &Error{Kind: KindConflict, Code: "username_exists", Message: "username already exists"}
+	ErrEmailExists          = &Error{Kind: KindConflict, Code: "email_exists", Message: "email already verified by another user"}
+	ErrIdentityNotLinked    = &Error{Kind: KindConflict, Code: "identity_not_linked", Message: "email used by a user who has not verified it, log in and verify the email to link the identity"}
+	ErrEmailVerified        = &Error{Kind: KindConflict, Code: "email_already_verified", Message: "email already verified"}
+	ErrNoEmail              = &Error{Kind: KindValidation, Code: "no_email", Message: "user has no email"}
+	ErrInvalidToken         = &Error{Kind: KindValidation, Code: "invalid_token", Message: "invalid or expired token"}
+	ErrInvalidChallenge     = &Error{Kind: KindUnauthorized, Code: "invalid_challenge", Message: "invalid or expired login challenge"}
+	ErrInvalidTwoFactorCode = &Error{Kind: KindUnauthorized, Code: "invalid_two_factor_code", Message: "invalid two-factor code"}
+	ErrTwoFactorEnabled     = &Error{Kind: KindConflict, Code: "two_factor_enabled", Message: "two-factor authentication already enabled"}
+	ErrTwoFactorNotEnabled  = &Error{Kind: KindConflict, Code: "two_factor_not_enabled", Message: "two-factor authentication not enabled"}
+	ErrInvalidAPIKey        = &Error{Kind: KindUnauthorized, Code: "invalid_api_key", Message: "invalid or expired API key"}
+	ErrNoTenant             = &Error{Kind: KindValidation, Code: "no_tenant", Message: "user belongs to no tenant"}
+	ErrInvalidExpiry        = &Error{Kind: KindValidation, Code: "invalid_expiry", Message: "expiry must be in the future"}
+	ErrSessionRevoked       = &Error{Kind: KindUnauthorized, Code: "session_revoked", Message: "session revoked or expired"}
+	ErrVersionMismatch      = &Error{Kind: KindPreconditionFailed, Code: "version_mismatch", Message: "row version mismatch"}
+	ErrInvalidFilter        = &Error{Kind: KindValidation, Code: "invalid_filter", Message: "invalid filter"}
+	ErrTooManyIndexes       = &Error{Kind: KindValidation, Code: "too_many_indexed_fields", Message: "too many indexed fields"}
+	ErrNotSupported         = &Error{Kind: KindNotSupported, Code: "not_supported", Message: "not supported by the database"}
+	ErrAccountLocked        = &Error{Kind: KindRateLimited, Code: "account_locked", Message: "account temporarily locked after failed logins"}
+	ErrSubmissionLimit      = &Error{Kind: KindRateLimited, Code: "submission_limit_exceeded", Message: "submission limit of the form exceeded"}
 )
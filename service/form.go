@@ -2,106 +2,101 @@ package service
 
 import (
 	"context"
-	"database/sql"
 	"github.com/google/uuid"
-	"github.com/sean-b-martin/dynamic-webforms-server/database"
 	"github.com/sean-b-martin/dynamic-webforms-server/model"
-	"github.com/uptrace/bun"
 )
 
 type FormService interface {
-	GetFormsOfUser(userID uuid.UUID) ([]model.FormModel, error)
-	GetForm(formID uuid.UUID) (model.FormModel, error)
-	GetForms() ([]model.FormModel, error)
-	CreateForm(userID uuid.UUID, title string) error
-	UpdateForm(userID uuid.UUID, id uuid.UUID, title string) error
-	DeleteForm(userID uuid.UUID, id uuid.UUID) error
+	GetFormsOfUser(ctx context.Context, userID uuid.UUID) ([]model.FormModel, error)
+	GetForm(ctx context.Context, formID uuid.UUID) (model.FormModel, error)
+	GetForms(ctx context.Context) ([]model.FormModel, error)
+	CreateForm(ctx context.Context, userID uuid.UUID, title string, submissionsPerHour int, initialSchema *model.FormSchemaModel) error
+	// UpdateForm sets the title and, if submissionsPerHour is not nil, the submission limit of a form.
+	UpdateForm(ctx context.Context, userID uuid.UUID, id uuid.UUID, title string, submissionsPerHour *int, version int64) error
+	DeleteForm(ctx context.Context, userID uuid.UUID, id uuid.UUID, version int64) error
 }
 
 type formServiceImpl struct {
-	db        *bun.DB
-	dbService GenericDBService[model.FormModel]
+	store Store
 }
 
-func NewFormService(db *bun.DB) FormService {
-	return &formServiceImpl{db: db, dbService: NewGenericDBService[model.FormModel](db)}
+func NewFormService(store Store) FormService {
+	return tracedFormService{next: &formServiceImpl{store: store}}
 }
 
-func (f *formServiceImpl) GetFormsOfUser(userID uuid.UUID) ([]model.FormModel, error) {
-	var forms []model.FormModel
-
-	err := f.db.NewSelect().Model((*model.FormModel)(nil)).Where("user_id = ?", userID).
-		Scan(context.Background(), &forms)
-	if err != nil {
-		return nil, err
-	}
-
-	return forms, nil
+func (f *formServiceImpl) GetFormsOfUser(ctx context.Context, userID uuid.UUID) ([]model.FormModel, error) {
+	return f.store.Repositories().Forms.GetFormsOfUser(ctx, userID)
 }
 
-func (f *formServiceImpl) GetForms() ([]model.FormModel, error) {
-	return f.dbService.GetModels("")
+func (f *formServiceImpl) GetForms(ctx context.Context) ([]model.FormModel, error) {
+	return f.store.Repositories().Forms.GetForms(ctx)
 }
 
-func (f *formServiceImpl) GetForm(formID uuid.UUID) (model.FormModel, error) {
-	return f.dbService.GetModelByID(formID)
+func (f *formServiceImpl) GetForm(ctx context.Context, formID uuid.UUID) (model.FormModel, error) {
+	return f.store.Repositories().Forms.GetForm(ctx, formID)
 }
 
-func (f *formServiceImpl) CreateForm(userID uuid.UUID, title string) error {
-	form := model.FormModel{Title: title, UserID: userID.String()}
-	return f.dbService.InsertModel(form, "user_id", "title")
-}
-
-func (f *formServiceImpl) UpdateForm(userID uuid.UUID, id uuid.UUID, title string) error {
-	var form model.FormModel
-
-	tx, err := f.db.BeginTx(context.Background(), nil)
-	if err != nil {
+// CreateForm creates a form and, if initialSchema is not nil, its first schema in the same transaction.
+func (f *formServiceImpl) CreateForm(ctx context.Context, userID uuid.UUID, title string, submissionsPerHour int, initialSchema *model.FormSchemaModel) error {
+	return f.store.RunInTx(ctx, func(ctx context.Context, repos Repositories) error {
+		form, err := repos.Forms.InsertForm(ctx, userID, model.FormModel{Title: title, UserID: userID.String(),
+			SubmissionsPerHour: submissionsPerHour})
+		if err != nil {
+			return err
+		}
+
+		if initialSchema == nil {
+			return nil
+		}
+
+		schema := *initialSchema
+		schema.FormID = form.ID
+		_, err = repos.Schemas.InsertSchema(ctx, userID, schema)
 		return err
-	}
-
-	defer database.TXLogErrRollback(&tx)
-
-	err = tx.NewSelect().Model(&form).Where("id = ?", id).Scan(context.Background())
-	if err != nil {
-		return err
-	}
-
-	if form.UserID != userID.String() {
-		return ErrNoPermission
-	}
-
-	form.Title = title
-	_, err = tx.NewUpdate().Model(&form).Column("title").Where("id = ?", id).Exec(context.Background())
-
-	if err != nil {
-		return err
-	}
-
-	return tx.Commit()
+	})
 }
 
-func (f *formServiceImpl) DeleteForm(userID uuid.UUID, id uuid.UUID) error {
-	var form model.FormModel
-	tx, err := f.db.BeginTx(context.Background(), nil)
-	if err != nil {
-		return err
-	}
-	defer database.TXLogErrRollback(&tx)
+func (f *formServiceImpl) UpdateForm(ctx context.Context, userID uuid.UUID, id uuid.UUID, title string, submissionsPerHour *int, version int64) error {
+	return f.store.RunInTx(ctx, func(ctx context.Context, repos Repositories) error {
+		form, err := repos.Forms.GetForm(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if form.UserID != userID.String() {
+			return ErrNoPermission
+		}
+
+		if err := checkRowVersion(form.RowVersion, version); err != nil {
+			return err
+		}
+
+		form.Title = title
+		columns := []string{"title"}
+		if submissionsPerHour != nil {
+			form.SubmissionsPerHour = *submissionsPerHour
+			columns = append(columns, "submissions_per_hour")
+		}
+
+		return repos.Forms.UpdateForm(ctx, userID, form, columns...)
+	})
+}
 
-	if err := tx.NewSelect().Model(&form).Where("id = ?", id).Scan(context.Background()); err != nil {
-		return err
-	}
+func (f *formServiceImpl) DeleteForm(ctx context.Context, userID uuid.UUID, id uuid.UUID, version int64) error {
+	return f.store.RunInTx(ctx, func(ctx context.Context, repos Repositories) error {
+		form, err := repos.Forms.GetForm(ctx, id)
+		if err != nil {
+			return err
+		}
 
-	if form.UserID != userID.String() {
-		return ErrNoPermission
-	}
+		if form.UserID != userID.String() {
+			return ErrNoPermission
+		}
 
-	if res, err := tx.NewDelete().Model((*model.FormModel)(nil)).Where("id = ?", id).Exec(context.Background()); err != nil {
-		return err
-	} else if rows, _ := res.RowsAffected(); rows == 0 {
-		return sql.ErrNoRows
-	}
+		if err := checkRowVersion(form.RowVersion, version); err != nil {
+			return err
+		}
 
-	return tx.Commit()
+		return repos.Forms.DeleteForm(ctx, userID, form, softDeleteTime())
+	})
 }
@@ -8,23 +8,30 @@ import (
 )
 
 type GenericDBService[T any] interface {
-	GetModelByID(id uuid.UUID) (T, error)
-	GetModel(whereQuery string, args ...interface{}) (T, error)
-	GetModels(whereQuery string, args ...interface{}) ([]T, error)
-	InsertModel(model T, columns ...string) error
-	UpdateModel(model T, id uuid.UUID, columns ...string) error
-	DeleteModelByID(id uuid.UUID) error
+	GetModelByID(ctx context.Context, id uuid.UUID) (T, error)
+	GetModel(ctx context.Context, whereQuery string, args ...interface{}) (T, error)
+	GetModels(ctx context.Context, whereQuery string, args ...interface{}) ([]T, error)
+	InsertModel(ctx context.Context, actorID uuid.UUID, model T, columns ...string) (T, error)
+	UpdateModel(ctx context.Context, actorID uuid.UUID, model T, id uuid.UUID, columns ...string) error
+	DeleteModelByID(ctx context.Context, id uuid.UUID) error
+	// WithTx returns a GenericDBService running its queries in the given transaction.
+	WithTx(tx bun.Tx) GenericDBService[T]
 }
 
 type genericDBServiceImpl[T any] struct {
-	db *bun.DB
+	db bun.IDB
 }
 
-func NewGenericDBService[T any](db *bun.DB) GenericDBService[T] {
+// NewGenericDBService creates a GenericDBService running its queries on db, which is either a *bun.DB or a bun.Tx.
+func NewGenericDBService[T any](db bun.IDB) GenericDBService[T] {
 	return &genericDBServiceImpl[T]{db: db}
 }
 
-func (g *genericDBServiceImpl[T]) GetModels(whereQuery string, args ...interface{}) ([]T, error) {
+func (g *genericDBServiceImpl[T]) WithTx(tx bun.Tx) GenericDBService[T] {
+	return &genericDBServiceImpl[T]{db: tx}
+}
+
+func (g *genericDBServiceImpl[T]) GetModels(ctx context.Context, whereQuery string, args ...interface{}) ([]T, error) {
 	var models []T
 
 	query := g.db.NewSelect().Model((*T)(nil))
@@ -32,41 +39,60 @@ func (g *genericDBServiceImpl[T]) GetModels(whereQuery string, args ...interface
 		query.Where(whereQuery, args...)
 	}
 
-	err := query.Scan(context.Background(), &models)
+	err := query.Scan(ctx, &models)
 	return models, err
 }
 
-func (g *genericDBServiceImpl[T]) GetModelByID(id uuid.UUID) (T, error) {
+func (g *genericDBServiceImpl[T]) GetModelByID(ctx context.Context, id uuid.UUID) (T, error) {
 	var model T
-	err := g.db.NewSelect().Model(&model).Where("id = ?", id).Scan(context.Background())
+	err := g.db.NewSelect().Model(&model).Where("id = ?", id).Scan(ctx)
 	return model, err
 }
 
-func (g *genericDBServiceImpl[T]) GetModel(whereQuery string, args ...interface{}) (T, error) {
+func (g *genericDBServiceImpl[T]) GetModel(ctx context.Context, whereQuery string, args ...interface{}) (T, error) {
 	var model T
-	err := g.db.NewSelect().Model(&model).Where(whereQuery, args...).Scan(context.Background())
+	err := g.db.NewSelect().Model(&model).Where(whereQuery, args...).Scan(ctx)
 	return model, err
 }
 
-func (g *genericDBServiceImpl[T]) InsertModel(model T, columns ...string) error {
-	_, err := g.db.NewInsert().Model(&model).Column(columns...).Exec(context.Background())
-	return err
+// InsertModel inserts the model and returns it with all columns set by the database, e.g. the generated ID.
+func (g *genericDBServiceImpl[T]) InsertModel(ctx context.Context, actorID uuid.UUID, model T, columns ...string) (T, error) {
+	columns = auditCreated(&model, actorID, columns)
+	if len(columns) > 0 {
+		// the ID is generated by model.TableID, which all models embed
+		columns = append(columns, "id")
+	}
+	_, err := g.db.NewInsert().Model(&model).Column(columns...).Returning("*").Exec(ctx)
+	return model, err
 }
 
-func (g *genericDBServiceImpl[T]) UpdateModel(model T, id uuid.UUID, columns ...string) error {
-	if res, err := g.db.NewUpdate().Model(&model).Column(columns...).Where("id = ?", id).
-		Exec(context.Background()); err != nil {
+func (g *genericDBServiceImpl[T]) UpdateModel(ctx context.Context, actorID uuid.UUID, model T, id uuid.UUID, columns ...string) error {
+	columns = auditUpdated(&model, actorID, columns)
+	query := g.db.NewUpdate().Model(&model).Where("id = ?", id)
+	columns, versioned := applyRowVersion(query, &model, columns)
+
+	if res, err := query.Column(columns...).Exec(ctx); err != nil {
 		return err
 	} else if rows, _ := res.RowsAffected(); rows == 0 {
+		if versioned {
+			// distinguish a missing row from a row updated concurrently
+			if exists, err := g.db.NewSelect().Model((*T)(nil)).Where("id = ?", id).
+				Exists(ctx); err != nil {
+				return err
+			} else if exists {
+				return ErrVersionMismatch
+			}
+		}
+
 		return sql.ErrNoRows
 	}
 
 	return nil
 }
 
-func (g *genericDBServiceImpl[T]) DeleteModelByID(id uuid.UUID) error {
+func (g *genericDBServiceImpl[T]) DeleteModelByID(ctx context.Context, id uuid.UUID) error {
 	var model T
-	if res, err := g.db.NewDelete().Model(&model).Where("id = ?", id).Exec(context.Background()); err != nil {
+	if res, err := g.db.NewDelete().Model(&model).Where("id = ?", id).Exec(ctx); err != nil {
 		return err
 	} else if rows, _ := res.RowsAffected(); rows == 0 {
 		return sql.ErrNoRows
@@ -0,0 +1,773 @@
+// Package memory implements the repositories of the services in memory, so services and controllers can be
+// tested without a database.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/model"
+	"github.com/sean-b-martin/dynamic-webforms-server/service"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store keeps all rows in maps. Transactions are serialized and roll back by restoring a copy of the maps taken
+// when the transaction started.
+type Store struct {
+	mu   sync.Mutex
+	data data
+}
+
+type data struct {
+	forms      map[uuid.UUID]model.FormModel
+	schemas    map[uuid.UUID]model.FormSchemaModel
+	users      map[uuid.UUID]model.UserModel
+	tokens     map[uuid.UUID]model.UserTokenModel
+	codes      map[uuid.UUID]model.RecoveryCodeModel
+	identities map[uuid.UUID]model.UserIdentityModel
+	apiKeys    map[uuid.UUID]model.APIKeyModel
+	sessions   map[uuid.UUID]model.SessionModel
+}
+
+var _ service.Store = (*Store)(nil)
+
+func NewStore() *Store {
+	return &Store{data: data{
+		forms:      make(map[uuid.UUID]model.FormModel),
+		schemas:    make(map[uuid.UUID]model.FormSchemaModel),
+		users:      make(map[uuid.UUID]model.UserModel),
+		tokens:     make(map[uuid.UUID]model.UserTokenModel),
+		codes:      make(map[uuid.UUID]model.RecoveryCodeModel),
+		identities: make(map[uuid.UUID]model.UserIdentityModel),
+		apiKeys:    make(map[uuid.UUID]model.APIKeyModel),
+		sessions:   make(map[uuid.UUID]model.SessionModel),
+	}}
+}
+
+func (s *Store) Repositories() service.Repositories {
+	return s.repositories(false)
+}
+
+func (s *Store) RunInTx(ctx context.Context, fn func(ctx context.Context, repos service.Repositories) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.data.clone()
+	if err := fn(ctx, s.repositories(true)); err != nil {
+		s.data = snapshot
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) repositories(inTx bool) service.Repositories {
+	a := access{store: s, inTx: inTx}
+	return service.Repositories{
+		Forms:         &formRepository{a},
+		Schemas:       &schemaRepository{a},
+		Users:         &userRepository{a},
+		Tokens:        &tokenRepository{a},
+		RecoveryCodes: &recoveryCodeRepository{a},
+		Identities:    &identityRepository{a},
+		APIKeys:       &apiKeyRepository{a},
+		Sessions:      &sessionRepository{a},
+	}
+}
+
+func (d data) clone() data {
+	return data{forms: cloneMap(d.forms), schemas: cloneMap(d.schemas), users: cloneMap(d.users),
+		tokens: cloneMap(d.tokens), codes: cloneMap(d.codes), identities: cloneMap(d.identities),
+		apiKeys: cloneMap(d.apiKeys), sessions: cloneMap(d.sessions)}
+}
+
+func cloneMap[T any](m map[uuid.UUID]T) map[uuid.UUID]T {
+	c := make(map[uuid.UUID]T, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+
+	return c
+}
+
+// access locks the store for a single operation, unless the repositories are used in a transaction, which
+// already holds the lock.
+type access struct {
+	store *Store
+	inTx  bool
+}
+
+func (a access) lock() func() {
+	if a.inTx {
+		return func() {}
+	}
+
+	a.store.mu.Lock()
+	return a.store.mu.Unlock
+}
+
+func checkRowVersion(current int64, expected int64) error {
+	if expected != service.AnyRowVersion && current != expected {
+		return service.ErrVersionMismatch
+	}
+
+	return nil
+}
+
+func unsupportedColumn(column string) error {
+	return fmt.Errorf("memory: update of column %q is not supported", column)
+}
+
+type formRepository struct {
+	access
+}
+
+func (r *formRepository) GetForm(_ context.Context, id uuid.UUID) (model.FormModel, error) {
+	defer r.lock()()
+
+	form, ok := r.store.data.forms[id]
+	if !ok || form.DeletedAt != nil {
+		return model.FormModel{}, sql.ErrNoRows
+	}
+
+	return form, nil
+}
+
+func (r *formRepository) GetForms(_ context.Context) ([]model.FormModel, error) {
+	defer r.lock()()
+
+	return r.filterForms(func(model.FormModel) bool { return true }), nil
+}
+
+func (r *formRepository) GetFormsOfUser(_ context.Context, userID uuid.UUID) ([]model.FormModel, error) {
+	defer r.lock()()
+
+	return r.filterForms(func(form model.FormModel) bool { return form.UserID == userID.String() }), nil
+}
+
+func (r *formRepository) filterForms(keep func(model.FormModel) bool) []model.FormModel {
+	var forms []model.FormModel
+	for _, form := range r.store.data.forms {
+		if form.DeletedAt == nil && keep(form) {
+			forms = append(forms, form)
+		}
+	}
+
+	sort.Slice(forms, func(i, j int) bool { return forms[i].CreatedAt.After(forms[j].CreatedAt) })
+	return forms
+}
+
+func (r *formRepository) InsertForm(_ context.Context, actorID uuid.UUID, form model.FormModel) (model.FormModel, error) {
+	defer r.lock()()
+
+	form.ID = uuid.New()
+	form.RowVersion = 1
+	form.SetCreated(actorID)
+	r.store.data.forms[form.ID] = form
+	return form, nil
+}
+
+func (r *formRepository) UpdateForm(_ context.Context, actorID uuid.UUID, form model.FormModel, columns ...string) error {
+	defer r.lock()()
+
+	current, ok := r.store.data.forms[form.ID]
+	if !ok || current.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+
+	if err := checkRowVersion(current.RowVersion, form.RowVersion); err != nil {
+		return err
+	}
+
+	for _, column := range columns {
+		switch column {
+		case "title":
+			current.Title = form.Title
+		case "user_id":
+			current.UserID = form.UserID
+		case "submissions_per_hour":
+			current.SubmissionsPerHour = form.SubmissionsPerHour
+		default:
+			return unsupportedColumn(column)
+		}
+	}
+
+	current.RowVersion++
+	current.SetUpdated(actorID)
+	r.store.data.forms[form.ID] = current
+	return nil
+}
+
+func (r *formRepository) DeleteForm(_ context.Context, actorID uuid.UUID, form model.FormModel, deletedAt time.Time) error {
+	defer r.lock()()
+
+	current, ok := r.store.data.forms[form.ID]
+	if !ok || current.DeletedAt != nil || current.RowVersion != form.RowVersion {
+		return service.ErrVersionMismatch
+	}
+
+	current.DeletedAt = &deletedAt
+	current.RowVersion++
+	current.SetUpdated(actorID)
+	r.store.data.forms[form.ID] = current
+
+	for id, schema := range r.store.data.schemas {
+		if schema.FormID == form.ID && schema.DeletedAt == nil {
+			schema.DeletedAt = &deletedAt
+			schema.RowVersion++
+			schema.SetUpdated(actorID)
+			r.store.data.schemas[id] = schema
+		}
+	}
+
+	return nil
+}
+
+type schemaRepository struct {
+	access
+}
+
+func (r *schemaRepository) GetSchemas(_ context.Context, formID uuid.UUID) ([]model.FormSchemaModel, error) {
+	defer r.lock()()
+
+	var schemas []model.FormSchemaModel
+	for _, schema := range r.store.data.schemas {
+		if schema.FormID == formID && schema.DeletedAt == nil {
+			schemas = append(schemas, schema)
+		}
+	}
+
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].CreatedAt.Before(schemas[j].CreatedAt) })
+	return schemas, nil
+}
+
+func (r *schemaRepository) GetSchema(_ context.Context, formID uuid.UUID, schemaID uuid.UUID) (model.FormSchemaModel, error) {
+	defer r.lock()()
+
+	schema, ok := r.store.data.schemas[schemaID]
+	if !ok || schema.FormID != formID || schema.DeletedAt != nil {
+		return model.FormSchemaModel{}, sql.ErrNoRows
+	}
+
+	return schema, nil
+}
+
+func (r *schemaRepository) InsertSchema(_ context.Context, actorID uuid.UUID, schema model.FormSchemaModel) (model.FormSchemaModel, error) {
+	defer r.lock()()
+
+	// emulates the foreign key of form_id
+	if _, ok := r.store.data.forms[schema.FormID]; !ok {
+		return schema, fmt.Errorf("memory: form %s does not exist", schema.FormID)
+	}
+
+	schema.ID = uuid.New()
+	schema.RowVersion = 1
+	schema.SetCreated(actorID)
+	r.store.data.schemas[schema.ID] = schema
+	return schema, nil
+}
+
+func (r *schemaRepository) UpdateSchema(_ context.Context, actorID uuid.UUID, schema model.FormSchemaModel, schemaData map[string]interface{}) error {
+	defer r.lock()()
+
+	current, ok := r.store.data.schemas[schema.ID]
+	if !ok || current.FormID != schema.FormID || current.DeletedAt != nil ||
+		current.RowVersion != schema.RowVersion {
+		return service.ErrVersionMismatch
+	}
+
+	for column, value := range schemaData {
+		var ok bool
+		switch column {
+		case "title":
+			current.Title, ok = value.(string)
+		case "schema":
+			current.Schema, ok = value.(json.RawMessage)
+		case "read_only":
+			current.ReadOnly, ok = value.(bool)
+		default:
+			return unsupportedColumn(column)
+		}
+
+		if !ok {
+			return fmt.Errorf("memory: invalid value %v for column %q", value, column)
+		}
+	}
+
+	current.RowVersion++
+	current.SetUpdated(actorID)
+	r.store.data.schemas[schema.ID] = current
+	return nil
+}
+
+func (r *schemaRepository) DeleteSchema(_ context.Context, actorID uuid.UUID, schema model.FormSchemaModel, deletedAt time.Time) error {
+	defer r.lock()()
+
+	current, ok := r.store.data.schemas[schema.ID]
+	if !ok || current.DeletedAt != nil || current.RowVersion != schema.RowVersion {
+		return service.ErrVersionMismatch
+	}
+
+	current.DeletedAt = &deletedAt
+	current.RowVersion++
+	current.SetUpdated(actorID)
+	r.store.data.schemas[schema.ID] = current
+	return nil
+}
+
+type userRepository struct {
+	access
+}
+
+func (r *userRepository) GetUserByID(_ context.Context, id uuid.UUID) (model.UserModel, error) {
+	defer r.lock()()
+
+	user, ok := r.store.data.users[id]
+	if !ok {
+		return model.UserModel{}, sql.ErrNoRows
+	}
+
+	return user, nil
+}
+
+func (r *userRepository) GetUserByUsername(_ context.Context, username string) (model.UserModel, error) {
+	defer r.lock()()
+
+	for _, user := range r.store.data.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+
+	return model.UserModel{}, sql.ErrNoRows
+}
+
+func (r *userRepository) GetUserByEmail(_ context.Context, email string) (model.UserModel, error) {
+	defer r.lock()()
+
+	found, err := model.UserModel{}, sql.ErrNoRows
+	for _, user := range r.store.data.users {
+		if user.Email != "" && user.Email == email {
+			if user.EmailVerifiedAt != nil {
+				return user, nil
+			}
+			found, err = user, nil
+		}
+	}
+
+	return found, err
+}
+
+// emailTaken emulates the unique index of verified emails.
+func (r *userRepository) emailTaken(email string, userID uuid.UUID) bool {
+	for _, existing := range r.store.data.users {
+		if email != "" && existing.Email == email && existing.EmailVerifiedAt != nil && existing.ID != userID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *userRepository) InsertUser(_ context.Context, user model.UserModel) (model.UserModel, error) {
+	defer r.lock()()
+
+	for _, existing := range r.store.data.users {
+		if existing.Username == user.Username {
+			return user, service.ErrUsernameExists
+		}
+	}
+
+	user.ID = uuid.New()
+	user.SetCreated(uuid.Nil)
+	r.store.data.users[user.ID] = user
+	return user, nil
+}
+
+func (r *userRepository) UpdateUser(_ context.Context, actorID uuid.UUID, user model.UserModel, columns ...string) error {
+	defer r.lock()()
+
+	current, ok := r.store.data.users[user.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	for _, column := range columns {
+		switch column {
+		case "password":
+			current.Password = user.Password
+		case "failed_logins":
+			current.FailedLogins = user.FailedLogins
+		case "locked_until":
+			current.LockedUntil = user.LockedUntil
+		case "email":
+			current.Email = user.Email
+		case "email_verified_at":
+			current.EmailVerifiedAt = user.EmailVerifiedAt
+		case "totp_secret":
+			current.TOTPSecret = user.TOTPSecret
+		case "totp_enabled_at":
+			current.TOTPEnabledAt = user.TOTPEnabledAt
+		case "totp_last_step":
+			current.TOTPLastStep = user.TOTPLastStep
+		case "roles":
+			current.Roles = user.Roles
+		case "tenant":
+			current.Tenant = user.Tenant
+		default:
+			return unsupportedColumn(column)
+		}
+	}
+
+	if current.EmailVerifiedAt != nil && r.emailTaken(current.Email, current.ID) {
+		return service.ErrEmailExists
+	}
+
+	current.SetUpdated(actorID)
+	r.store.data.users[user.ID] = current
+	return nil
+}
+
+func (r *userRepository) IncrementFailedLogins(_ context.Context, id uuid.UUID) (int, error) {
+	defer r.lock()()
+
+	user, ok := r.store.data.users[id]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+
+	user.FailedLogins++
+	r.store.data.users[id] = user
+	return user.FailedLogins, nil
+}
+
+func (r *userRepository) LockUser(_ context.Context, id uuid.UUID, failedLogins int, until time.Time) error {
+	defer r.lock()()
+
+	if user, ok := r.store.data.users[id]; ok && user.FailedLogins == failedLogins {
+		user.LockedUntil = &until
+		r.store.data.users[id] = user
+	}
+
+	return nil
+}
+
+func (r *userRepository) DeleteUser(_ context.Context, id uuid.UUID) error {
+	defer r.lock()()
+
+	if _, ok := r.store.data.users[id]; !ok {
+		return sql.ErrNoRows
+	}
+
+	delete(r.store.data.users, id)
+	// emulates the foreign keys of user_id
+	for tokenID, token := range r.store.data.tokens {
+		if token.UserID == id {
+			delete(r.store.data.tokens, tokenID)
+		}
+	}
+	for codeID, code := range r.store.data.codes {
+		if code.UserID == id {
+			delete(r.store.data.codes, codeID)
+		}
+	}
+	for identityID, identity := range r.store.data.identities {
+		if identity.UserID == id {
+			delete(r.store.data.identities, identityID)
+		}
+	}
+	for keyID, key := range r.store.data.apiKeys {
+		if key.UserID == id {
+			delete(r.store.data.apiKeys, keyID)
+		}
+	}
+	for sessionID, session := range r.store.data.sessions {
+		if session.UserID == id {
+			delete(r.store.data.sessions, sessionID)
+		}
+	}
+
+	return nil
+}
+
+type tokenRepository struct {
+	access
+}
+
+func (r *tokenRepository) InsertToken(_ context.Context, token model.UserTokenModel) (model.UserTokenModel, error) {
+	defer r.lock()()
+
+	if _, ok := r.store.data.users[token.UserID]; !ok {
+		return token, fmt.Errorf("memory: user %s does not exist", token.UserID)
+	}
+
+	token.ID = uuid.New()
+	token.CreatedAt = time.Now().UTC()
+	r.store.data.tokens[token.ID] = token
+	return token, nil
+}
+
+func (r *tokenRepository) ConsumeToken(_ context.Context, purpose string, tokenHash string, now time.Time) (model.UserTokenModel, error) {
+	defer r.lock()()
+
+	for id, token := range r.store.data.tokens {
+		if token.Purpose == purpose && token.TokenHash == tokenHash && token.ExpiresAt.After(now) {
+			delete(r.store.data.tokens, id)
+			return token, nil
+		}
+	}
+
+	return model.UserTokenModel{}, sql.ErrNoRows
+}
+
+func (r *tokenRepository) DeleteTokensOfUser(_ context.Context, userID uuid.UUID, purpose string) error {
+	defer r.lock()()
+
+	for id, token := range r.store.data.tokens {
+		if token.UserID == userID && token.Purpose == purpose {
+			delete(r.store.data.tokens, id)
+		}
+	}
+
+	return nil
+}
+
+type identityRepository struct {
+	access
+}
+
+func (r *identityRepository) GetIdentity(_ context.Context, issuer string, subject string) (model.UserIdentityModel, error) {
+	defer r.lock()()
+
+	for _, identity := range r.store.data.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+
+	return model.UserIdentityModel{}, sql.ErrNoRows
+}
+
+func (r *identityRepository) InsertIdentity(_ context.Context, identity model.UserIdentityModel) (model.UserIdentityModel, error) {
+	defer r.lock()()
+
+	if _, ok := r.store.data.users[identity.UserID]; !ok {
+		return identity, fmt.Errorf("memory: user %s does not exist", identity.UserID)
+	}
+
+	// emulates the unique constraint of issuer and subject
+	for _, existing := range r.store.data.identities {
+		if existing.Issuer == identity.Issuer && existing.Subject == identity.Subject {
+			return identity, fmt.Errorf("memory: identity %s of %s exists already", identity.Subject, identity.Issuer)
+		}
+	}
+
+	identity.ID = uuid.New()
+	identity.CreatedAt = time.Now().UTC()
+	r.store.data.identities[identity.ID] = identity
+	return identity, nil
+}
+
+type apiKeyRepository struct {
+	access
+}
+
+// ownsAPIKey reports whether a user created key or key belongs to the tenant.
+func ownsAPIKey(key model.APIKeyModel, userID uuid.UUID, tenant string) bool {
+	return key.UserID == userID || (tenant != "" && key.Tenant == tenant)
+}
+
+func (r *apiKeyRepository) GetAPIKeysOfUser(_ context.Context, userID uuid.UUID, tenant string) ([]model.APIKeyModel, error) {
+	defer r.lock()()
+
+	keys := make([]model.APIKeyModel, 0)
+	for _, key := range r.store.data.apiKeys {
+		if ownsAPIKey(key, userID, tenant) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (r *apiKeyRepository) GetAPIKeyByHash(_ context.Context, keyHash string) (model.APIKeyModel, error) {
+	defer r.lock()()
+
+	for _, key := range r.store.data.apiKeys {
+		if key.KeyHash == keyHash {
+			return key, nil
+		}
+	}
+
+	return model.APIKeyModel{}, sql.ErrNoRows
+}
+
+func (r *apiKeyRepository) InsertAPIKey(_ context.Context, key model.APIKeyModel) (model.APIKeyModel, error) {
+	defer r.lock()()
+
+	if _, ok := r.store.data.users[key.UserID]; !ok {
+		return key, fmt.Errorf("memory: user %s does not exist", key.UserID)
+	}
+
+	key.ID = uuid.New()
+	key.CreatedAt = time.Now().UTC()
+	r.store.data.apiKeys[key.ID] = key
+	return key, nil
+}
+
+func (r *apiKeyRepository) UpdateAPIKeyLastUsed(_ context.Context, id uuid.UUID, lastUsedAt time.Time) error {
+	defer r.lock()()
+
+	if key, ok := r.store.data.apiKeys[id]; ok {
+		key.LastUsedAt = &lastUsedAt
+		r.store.data.apiKeys[id] = key
+	}
+
+	return nil
+}
+
+func (r *apiKeyRepository) DeleteAPIKey(_ context.Context, userID uuid.UUID, tenant string, id uuid.UUID) error {
+	defer r.lock()()
+
+	if key, ok := r.store.data.apiKeys[id]; !ok || !ownsAPIKey(key, userID, tenant) {
+		return sql.ErrNoRows
+	}
+
+	delete(r.store.data.apiKeys, id)
+	return nil
+}
+
+type sessionRepository struct {
+	access
+}
+
+func (r *sessionRepository) GetSessionsOfUser(_ context.Context, userID uuid.UUID, now time.Time) ([]model.SessionModel, error) {
+	defer r.lock()()
+
+	sessions := make([]model.SessionModel, 0)
+	for _, session := range r.store.data.sessions {
+		if session.UserID == userID && session.ExpiresAt.After(now) {
+			sessions = append(sessions, session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
+
+func (r *sessionRepository) GetSession(_ context.Context, id uuid.UUID) (model.SessionModel, error) {
+	defer r.lock()()
+
+	if session, ok := r.store.data.sessions[id]; ok {
+		return session, nil
+	}
+
+	return model.SessionModel{}, sql.ErrNoRows
+}
+
+func (r *sessionRepository) InsertSession(_ context.Context, session model.SessionModel) (model.SessionModel, error) {
+	defer r.lock()()
+
+	if _, ok := r.store.data.users[session.UserID]; !ok {
+		return session, fmt.Errorf("memory: user %s does not exist", session.UserID)
+	}
+
+	if session.ID == uuid.Nil {
+		session.ID = uuid.New()
+	}
+	session.CreatedAt = time.Now().UTC()
+	r.store.data.sessions[session.ID] = session
+	return session, nil
+}
+
+func (r *sessionRepository) UpdateSessionLastSeen(_ context.Context, id uuid.UUID, lastSeenAt time.Time) error {
+	defer r.lock()()
+
+	if session, ok := r.store.data.sessions[id]; ok {
+		session.LastSeenAt = lastSeenAt
+		r.store.data.sessions[id] = session
+	}
+
+	return nil
+}
+
+func (r *sessionRepository) DeleteSession(_ context.Context, userID uuid.UUID, id uuid.UUID) error {
+	defer r.lock()()
+
+	if session, ok := r.store.data.sessions[id]; !ok || session.UserID != userID {
+		return sql.ErrNoRows
+	}
+
+	delete(r.store.data.sessions, id)
+	return nil
+}
+
+func (r *sessionRepository) DeleteSessionsOfUser(_ context.Context, userID uuid.UUID, keep uuid.UUID) error {
+	defer r.lock()()
+
+	for id, session := range r.store.data.sessions {
+		if session.UserID == userID && id != keep {
+			delete(r.store.data.sessions, id)
+		}
+	}
+
+	return nil
+}
+
+func (r *sessionRepository) DeleteExpiredSessions(_ context.Context, now time.Time) (int64, error) {
+	defer r.lock()()
+
+	var deleted int64
+	for id, session := range r.store.data.sessions {
+		if !session.ExpiresAt.After(now) {
+			delete(r.store.data.sessions, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+type recoveryCodeRepository struct {
+	access
+}
+
+func (r *recoveryCodeRepository) ReplaceRecoveryCodes(_ context.Context, userID uuid.UUID, codeHashes []string) error {
+	defer r.lock()()
+
+	if _, ok := r.store.data.users[userID]; !ok {
+		return fmt.Errorf("memory: user %s does not exist", userID)
+	}
+
+	for id, code := range r.store.data.codes {
+		if code.UserID == userID {
+			delete(r.store.data.codes, id)
+		}
+	}
+
+	for _, codeHash := range codeHashes {
+		code := model.RecoveryCodeModel{UserID: userID, CodeHash: codeHash, CreatedAt: time.Now().UTC()}
+		code.ID = uuid.New()
+		r.store.data.codes[code.ID] = code
+	}
+
+	return nil
+}
+
+func (r *recoveryCodeRepository) ConsumeRecoveryCode(_ context.Context, userID uuid.UUID, codeHash string) error {
+	defer r.lock()()
+
+	for id, code := range r.store.data.codes {
+		if code.UserID == userID && code.CodeHash == codeHash {
+			delete(r.store.data.codes, id)
+			return nil
+		}
+	}
+
+	return sql.ErrNoRows
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/model"
+	"time"
+)
+
+// Repositories hold the data access of the services. Reads return sql.ErrNoRows if a row does not exist and never
+// return soft deleted rows. Writes set the audit columns for actorID, updates and deletes of versioned rows only
+// succeed for the row version of the passed model and return ErrVersionMismatch otherwise.
+type Repositories struct {
+	Forms         FormRepository
+	Schemas       SchemaRepository
+	Users         UserRepository
+	Tokens        TokenRepository
+	RecoveryCodes RecoveryCodeRepository
+	Identities    IdentityRepository
+	APIKeys       APIKeyRepository
+	Sessions      SessionRepository
+}
+
+// Store provides the repositories either directly or bound to a transaction.
+type Store interface {
+	Repositories() Repositories
+	// RunInTx runs fn as a unit of work, all changes made through repos are discarded if fn returns an error.
+	RunInTx(ctx context.Context, fn func(ctx context.Context, repos Repositories) error) error
+}
+
+type FormRepository interface {
+	GetForm(ctx context.Context, id uuid.UUID) (model.FormModel, error)
+	GetForms(ctx context.Context) ([]model.FormModel, error)
+	GetFormsOfUser(ctx context.Context, userID uuid.UUID) ([]model.FormModel, error)
+	InsertForm(ctx context.Context, actorID uuid.UUID, form model.FormModel) (model.FormModel, error)
+	UpdateForm(ctx context.Context, actorID uuid.UUID, form model.FormModel, columns ...string) error
+	// DeleteForm moves a form with its schemas and submissions to the trash.
+	DeleteForm(ctx context.Context, actorID uuid.UUID, form model.FormModel, deletedAt time.Time) error
+}
+
+type SchemaRepository interface {
+	GetSchemas(ctx context.Context, formID uuid.UUID) ([]model.FormSchemaModel, error)
+	GetSchema(ctx context.Context, formID uuid.UUID, schemaID uuid.UUID) (model.FormSchemaModel, error)
+	InsertSchema(ctx context.Context, actorID uuid.UUID, schema model.FormSchemaModel) (model.FormSchemaModel, error)
+	// UpdateSchema sets the given columns of a schema to the values of schemaData.
+	UpdateSchema(ctx context.Context, actorID uuid.UUID, schema model.FormSchemaModel, schemaData map[string]interface{}) error
+	// DeleteSchema moves a schema with its submissions to the trash.
+	DeleteSchema(ctx context.Context, actorID uuid.UUID, schema model.FormSchemaModel, deletedAt time.Time) error
+}
+
+type UserRepository interface {
+	GetUserByID(ctx context.Context, id uuid.UUID) (model.UserModel, error)
+	GetUserByUsername(ctx context.Context, username string) (model.UserModel, error)
+	// GetUserByEmail returns the user who verified the email, or one of the users who have not verified it.
+	GetUserByEmail(ctx context.Context, email string) (model.UserModel, error)
+	// InsertUser returns ErrUsernameExists if the username is already taken.
+	InsertUser(ctx context.Context, user model.UserModel) (model.UserModel, error)
+	// UpdateUser returns ErrEmailExists if the user would have an email verified by another user.
+	UpdateUser(ctx context.Context, actorID uuid.UUID, user model.UserModel, columns ...string) error
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+	// IncrementFailedLogins counts a failed login of the user in a single statement, so concurrent failures are not
+	// lost, and returns the failed logins in a row.
+	IncrementFailedLogins(ctx context.Context, id uuid.UUID) (int, error)
+	// LockUser locks the user until the given time unless further failed logins were counted since failedLogins,
+	// whose lock applies instead.
+	LockUser(ctx context.Context, id uuid.UUID, failedLogins int, until time.Time) error
+}
+
+type TokenRepository interface {
+	InsertToken(ctx context.Context, token model.UserTokenModel) (model.UserTokenModel, error)
+	// ConsumeToken deletes and returns the token with the hash and purpose unless it expired before now. Each token
+	// is only returned once, even to concurrent calls.
+	ConsumeToken(ctx context.Context, purpose string, tokenHash string, now time.Time) (model.UserTokenModel, error)
+	// DeleteTokensOfUser deletes all tokens of a user with the purpose.
+	DeleteTokensOfUser(ctx context.Context, userID uuid.UUID, purpose string) error
+}
+
+type IdentityRepository interface {
+	GetIdentity(ctx context.Context, issuer string, subject string) (model.UserIdentityModel, error)
+	InsertIdentity(ctx context.Context, identity model.UserIdentityModel) (model.UserIdentityModel, error)
+}
+
+type APIKeyRepository interface {
+	// GetAPIKeysOfUser returns the keys created by the user and, unless tenant is empty, the keys of the tenant.
+	GetAPIKeysOfUser(ctx context.Context, userID uuid.UUID, tenant string) ([]model.APIKeyModel, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (model.APIKeyModel, error)
+	InsertAPIKey(ctx context.Context, key model.APIKeyModel) (model.APIKeyModel, error)
+	UpdateAPIKeyLastUsed(ctx context.Context, id uuid.UUID, lastUsedAt time.Time) error
+	// DeleteAPIKey deletes a key created by the user or, unless tenant is empty, a key of the tenant. It returns
+	// sql.ErrNoRows if there is no such key with the ID.
+	DeleteAPIKey(ctx context.Context, userID uuid.UUID, tenant string, id uuid.UUID) error
+}
+
+type SessionRepository interface {
+	// GetSessionsOfUser returns the sessions of a user which expire after now.
+	GetSessionsOfUser(ctx context.Context, userID uuid.UUID, now time.Time) ([]model.SessionModel, error)
+	GetSession(ctx context.Context, id uuid.UUID) (model.SessionModel, error)
+	InsertSession(ctx context.Context, session model.SessionModel) (model.SessionModel, error)
+	UpdateSessionLastSeen(ctx context.Context, id uuid.UUID, lastSeenAt time.Time) error
+	// DeleteSession returns sql.ErrNoRows if the user has no session with the ID.
+	DeleteSession(ctx context.Context, userID uuid.UUID, id uuid.UUID) error
+	// DeleteSessionsOfUser deletes the sessions of a user except the session keep, uuid.Nil deletes all of them.
+	DeleteSessionsOfUser(ctx context.Context, userID uuid.UUID, keep uuid.UUID) error
+	DeleteExpiredSessions(ctx context.Context, now time.Time) (int64, error)
+}
+
+type RecoveryCodeRepository interface {
+	// ReplaceRecoveryCodes deletes the recovery codes of a user and inserts the codes with the given hashes.
+	ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error
+	// ConsumeRecoveryCode deletes the recovery code of a user with the hash, it returns sql.ErrNoRows if the user
+	// has no such code.
+	ConsumeRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) error
+}
+
+// requireFormOwner returns ErrNoPermission if the form is not owned by the user.
+func requireFormOwner(ctx context.Context, forms FormRepository, formID uuid.UUID, userID uuid.UUID) error {
+	form, err := forms.GetForm(ctx, formID)
+	if err != nil {
+		return err
+	}
+
+	if form.UserID != userID.String() {
+		return ErrNoPermission
+	}
+
+	return nil
+}
@@ -0,0 +1,395 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/database"
+	"github.com/sean-b-martin/dynamic-webforms-server/model"
+	"github.com/uptrace/bun"
+	"time"
+)
+
+type dbStore struct {
+	db *bun.DB
+}
+
+// NewDBStore creates a Store backed by the database.
+func NewDBStore(db *bun.DB) Store {
+	return &dbStore{db: db}
+}
+
+func (s *dbStore) Repositories() Repositories {
+	return newDBRepositories(s.db)
+}
+
+func (s *dbStore) RunInTx(ctx context.Context, fn func(ctx context.Context, repos Repositories) error) error {
+	return database.RunInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		return fn(ctx, newDBRepositories(tx))
+	})
+}
+
+func newDBRepositories(db bun.IDB) Repositories {
+	return Repositories{
+		Forms:         &dbFormRepository{db: db, dbService: NewGenericDBService[model.FormModel](db)},
+		Schemas:       &dbSchemaRepository{db: db, dbService: NewGenericDBService[model.FormSchemaModel](db)},
+		Users:         &dbUserRepository{db: db, dbService: NewGenericDBService[model.UserModel](db)},
+		Tokens:        &dbTokenRepository{db: db},
+		RecoveryCodes: &dbRecoveryCodeRepository{db: db},
+		Identities:    &dbIdentityRepository{db: db},
+		APIKeys:       &dbAPIKeyRepository{db: db},
+		Sessions:      &dbSessionRepository{db: db},
+	}
+}
+
+type dbFormRepository struct {
+	db        bun.IDB
+	dbService GenericDBService[model.FormModel]
+}
+
+func (r *dbFormRepository) GetForm(ctx context.Context, id uuid.UUID) (model.FormModel, error) {
+	return r.dbService.GetModelByID(ctx, id)
+}
+
+func (r *dbFormRepository) GetForms(ctx context.Context) ([]model.FormModel, error) {
+	return r.dbService.GetModels(ctx, "")
+}
+
+func (r *dbFormRepository) GetFormsOfUser(ctx context.Context, userID uuid.UUID) ([]model.FormModel, error) {
+	var forms []model.FormModel
+
+	err := r.db.NewSelect().Model((*model.FormModel)(nil)).Where("user_id = ?", userID).
+		Order("created_at DESC").Scan(ctx, &forms)
+	if err != nil {
+		return nil, err
+	}
+
+	return forms, nil
+}
+
+func (r *dbFormRepository) InsertForm(ctx context.Context, actorID uuid.UUID, form model.FormModel) (model.FormModel, error) {
+	return r.dbService.InsertModel(ctx, actorID, form, "user_id", "title", "submissions_per_hour")
+}
+
+func (r *dbFormRepository) UpdateForm(ctx context.Context, actorID uuid.UUID, form model.FormModel, columns ...string) error {
+	return r.dbService.UpdateModel(ctx, actorID, form, form.ID, columns...)
+}
+
+func (r *dbFormRepository) DeleteForm(ctx context.Context, actorID uuid.UUID, form model.FormModel, deletedAt time.Time) error {
+	// schemas and submissions are moved to the trash together with the form and share its deletion time
+	if rows, err := softDelete[model.FormModel](ctx, r.db, actorID, deletedAt, "id = ? AND row_version = ?", form.ID,
+		form.RowVersion); err != nil {
+		return err
+	} else if rows == 0 {
+		return ErrVersionMismatch
+	}
+
+	if _, err := softDelete[model.FormSchemaModel](ctx, r.db, actorID, deletedAt, "form_id = ?", form.ID); err != nil {
+		return err
+	}
+
+	_, err := softDelete[model.FormDataModel](ctx, r.db, actorID, deletedAt,
+		"form_schema_id IN (SELECT id FROM form_schemas WHERE form_id = ?)", form.ID)
+	return err
+}
+
+type dbSchemaRepository struct {
+	db        bun.IDB
+	dbService GenericDBService[model.FormSchemaModel]
+}
+
+func (r *dbSchemaRepository) GetSchemas(ctx context.Context, formID uuid.UUID) ([]model.FormSchemaModel, error) {
+	return r.dbService.GetModels(ctx, "form_id = ?", formID)
+}
+
+func (r *dbSchemaRepository) GetSchema(ctx context.Context, formID uuid.UUID, schemaID uuid.UUID) (model.FormSchemaModel, error) {
+	return r.dbService.GetModel(ctx, "id = ? AND form_id = ? ", schemaID, formID)
+}
+
+// InsertSchema inserts a schema into the form set in schema.FormID and creates the indexes of its fields.
+func (r *dbSchemaRepository) InsertSchema(ctx context.Context, actorID uuid.UUID, schema model.FormSchemaModel) (model.FormSchemaModel, error) {
+	schema, err := r.dbService.InsertModel(ctx, actorID, schema, "title", "version", "schema", "read_only", "form_id")
+	if err != nil {
+		return schema, err
+	}
+
+	return schema, createSubmissionIndexes(ctx, r.db, schema)
+}
+
+func (r *dbSchemaRepository) UpdateSchema(ctx context.Context, actorID uuid.UUID, schema model.FormSchemaModel, schemaData map[string]interface{}) error {
+	query := r.db.NewUpdate().Model((*model.FormSchemaModel)(nil)).Where("id = ? AND form_id = ? ", schema.ID, schema.FormID).
+		Where("row_version = ?", schema.RowVersion).Set("row_version = row_version + 1")
+	auditUpdateQuery(query, actorID)
+	for k, v := range schemaData {
+		query.SetColumn(k, "?", v)
+	}
+	if res, err := query.Exec(ctx); err != nil {
+		return err
+	} else if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrVersionMismatch
+	}
+
+	if schemaDefinition, ok := schemaData["schema"].(json.RawMessage); ok {
+		schema.Schema = schemaDefinition
+		return createSubmissionIndexes(ctx, r.db, schema)
+	}
+
+	return nil
+}
+
+func (r *dbSchemaRepository) DeleteSchema(ctx context.Context, actorID uuid.UUID, schema model.FormSchemaModel, deletedAt time.Time) error {
+	rows, err := softDelete[model.FormSchemaModel](ctx, r.db, actorID, deletedAt, "id = ? AND row_version = ?",
+		schema.ID, schema.RowVersion)
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrVersionMismatch
+	}
+
+	_, err = softDelete[model.FormDataModel](ctx, r.db, actorID, deletedAt, "form_schema_id = ?", schema.ID)
+	return err
+}
+
+type dbUserRepository struct {
+	db        bun.IDB
+	dbService GenericDBService[model.UserModel]
+}
+
+func (r *dbUserRepository) GetUserByID(ctx context.Context, id uuid.UUID) (model.UserModel, error) {
+	return r.dbService.GetModelByID(ctx, id)
+}
+
+func (r *dbUserRepository) GetUserByUsername(ctx context.Context, username string) (model.UserModel, error) {
+	var user model.UserModel
+	err := r.db.NewSelect().Model(&user).Where("username = ?", username).Scan(ctx)
+	return user, err
+}
+
+func (r *dbUserRepository) GetUserByEmail(ctx context.Context, email string) (model.UserModel, error) {
+	var user model.UserModel
+	err := r.db.NewSelect().Model(&user).Where("email = ?", email).OrderExpr("email_verified_at IS NULL").
+		Limit(1).Scan(ctx)
+	return user, err
+}
+
+func (r *dbUserRepository) InsertUser(ctx context.Context, user model.UserModel) (model.UserModel, error) {
+	// the username is the only unique column of new users, as only verified emails are unique
+	inserted, err := r.dbService.InsertModel(ctx, uuid.Nil, user, "username", "password", "email")
+	if database.IsIntegrityViolation(err) {
+		return inserted, ErrUsernameExists
+	}
+
+	return inserted, err
+}
+
+func (r *dbUserRepository) UpdateUser(ctx context.Context, actorID uuid.UUID, user model.UserModel, columns ...string) error {
+	err := r.dbService.UpdateModel(ctx, actorID, user, user.ID, columns...)
+	if database.IsIntegrityViolation(err) {
+		return ErrEmailExists
+	}
+
+	return err
+}
+
+func (r *dbUserRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	return r.dbService.DeleteModelByID(ctx, id)
+}
+
+func (r *dbUserRepository) IncrementFailedLogins(ctx context.Context, id uuid.UUID) (int, error) {
+	var failedLogins int
+	err := r.db.NewUpdate().Model((*model.UserModel)(nil)).Set("failed_logins = failed_logins + 1").
+		Where("id = ?", id).Returning("failed_logins").Scan(ctx, &failedLogins)
+	return failedLogins, err
+}
+
+func (r *dbUserRepository) LockUser(ctx context.Context, id uuid.UUID, failedLogins int, until time.Time) error {
+	_, err := r.db.NewUpdate().Model((*model.UserModel)(nil)).Set("locked_until = ?", until).
+		Where("id = ? AND failed_logins = ?", id, failedLogins).Exec(ctx)
+	return err
+}
+
+type dbTokenRepository struct {
+	db bun.IDB
+}
+
+func (r *dbTokenRepository) InsertToken(ctx context.Context, token model.UserTokenModel) (model.UserTokenModel, error) {
+	_, err := r.db.NewInsert().Model(&token).Returning("*").Exec(ctx)
+	return token, err
+}
+
+func (r *dbTokenRepository) ConsumeToken(ctx context.Context, purpose string, tokenHash string, now time.Time) (model.UserTokenModel, error) {
+	var token model.UserTokenModel
+	if err := r.db.NewSelect().Model(&token).Where("purpose = ? AND token_hash = ?", purpose, tokenHash).
+		Where("expires_at > ?", now).Scan(ctx); err != nil {
+		return token, err
+	}
+
+	// the token was consumed concurrently if it is gone already
+	if res, err := r.db.NewDelete().Model((*model.UserTokenModel)(nil)).Where("id = ?", token.ID).
+		Exec(ctx); err != nil {
+		return token, err
+	} else if rows, _ := res.RowsAffected(); rows == 0 {
+		return token, sql.ErrNoRows
+	}
+
+	return token, nil
+}
+
+func (r *dbTokenRepository) DeleteTokensOfUser(ctx context.Context, userID uuid.UUID, purpose string) error {
+	_, err := r.db.NewDelete().Model((*model.UserTokenModel)(nil)).Where("user_id = ? AND purpose = ?", userID, purpose).
+		Exec(ctx)
+	return err
+}
+
+type dbIdentityRepository struct {
+	db bun.IDB
+}
+
+func (r *dbIdentityRepository) GetIdentity(ctx context.Context, issuer string, subject string) (model.UserIdentityModel, error) {
+	var identity model.UserIdentityModel
+	err := r.db.NewSelect().Model(&identity).Where("issuer = ? AND subject = ?", issuer, subject).Scan(ctx)
+	return identity, err
+}
+
+func (r *dbIdentityRepository) InsertIdentity(ctx context.Context, identity model.UserIdentityModel) (model.UserIdentityModel, error) {
+	_, err := r.db.NewInsert().Model(&identity).Returning("*").Exec(ctx)
+	return identity, err
+}
+
+// ownedAPIKeys selects the keys created by a user and the keys of a tenant. The tenant of keys of users is NULL, so
+// an empty tenant selects no further keys.
+const ownedAPIKeys = "user_id = ? OR tenant = ?"
+
+type dbAPIKeyRepository struct {
+	db bun.IDB
+}
+
+func (r *dbAPIKeyRepository) GetAPIKeysOfUser(ctx context.Context, userID uuid.UUID, tenant string) ([]model.APIKeyModel, error) {
+	keys := make([]model.APIKeyModel, 0)
+	err := r.db.NewSelect().Model(&keys).Where(ownedAPIKeys, userID, tenant).Order("created_at").Scan(ctx)
+	return keys, err
+}
+
+func (r *dbAPIKeyRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (model.APIKeyModel, error) {
+	var key model.APIKeyModel
+	err := r.db.NewSelect().Model(&key).Where("key_hash = ?", keyHash).Scan(ctx)
+	return key, err
+}
+
+func (r *dbAPIKeyRepository) InsertAPIKey(ctx context.Context, key model.APIKeyModel) (model.APIKeyModel, error) {
+	_, err := r.db.NewInsert().Model(&key).Returning("*").Exec(ctx)
+	return key, err
+}
+
+func (r *dbAPIKeyRepository) UpdateAPIKeyLastUsed(ctx context.Context, id uuid.UUID, lastUsedAt time.Time) error {
+	_, err := r.db.NewUpdate().Model((*model.APIKeyModel)(nil)).Set("last_used_at = ?", lastUsedAt).
+		Where("id = ?", id).Exec(ctx)
+	return err
+}
+
+func (r *dbAPIKeyRepository) DeleteAPIKey(ctx context.Context, userID uuid.UUID, tenant string, id uuid.UUID) error {
+	res, err := r.db.NewDelete().Model((*model.APIKeyModel)(nil)).Where("id = ?", id).
+		Where(ownedAPIKeys, userID, tenant).Exec(ctx)
+	if err != nil {
+		return err
+	} else if rows, _ := res.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+type dbSessionRepository struct {
+	db bun.IDB
+}
+
+func (r *dbSessionRepository) GetSessionsOfUser(ctx context.Context, userID uuid.UUID, now time.Time) ([]model.SessionModel, error) {
+	sessions := make([]model.SessionModel, 0)
+	err := r.db.NewSelect().Model(&sessions).Where("user_id = ? AND expires_at > ?", userID, now).
+		Order("last_seen_at DESC").Scan(ctx)
+	return sessions, err
+}
+
+func (r *dbSessionRepository) GetSession(ctx context.Context, id uuid.UUID) (model.SessionModel, error) {
+	var session model.SessionModel
+	err := r.db.NewSelect().Model(&session).Where("id = ?", id).Scan(ctx)
+	return session, err
+}
+
+func (r *dbSessionRepository) InsertSession(ctx context.Context, session model.SessionModel) (model.SessionModel, error) {
+	_, err := r.db.NewInsert().Model(&session).Returning("*").Exec(ctx)
+	return session, err
+}
+
+func (r *dbSessionRepository) UpdateSessionLastSeen(ctx context.Context, id uuid.UUID, lastSeenAt time.Time) error {
+	_, err := r.db.NewUpdate().Model((*model.SessionModel)(nil)).Set("last_seen_at = ?", lastSeenAt).
+		Where("id = ?", id).Exec(ctx)
+	return err
+}
+
+func (r *dbSessionRepository) DeleteSession(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	res, err := r.db.NewDelete().Model((*model.SessionModel)(nil)).Where("id = ? AND user_id = ?", id, userID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	} else if rows, _ := res.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *dbSessionRepository) DeleteSessionsOfUser(ctx context.Context, userID uuid.UUID, keep uuid.UUID) error {
+	_, err := r.db.NewDelete().Model((*model.SessionModel)(nil)).Where("user_id = ?", userID).
+		Where("id <> ?", keep).Exec(ctx)
+	return err
+}
+
+func (r *dbSessionRepository) DeleteExpiredSessions(ctx context.Context, now time.Time) (int64, error) {
+	res, err := r.db.NewDelete().Model((*model.SessionModel)(nil)).Where("expires_at <= ?", now).Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+type dbRecoveryCodeRepository struct {
+	db bun.IDB
+}
+
+func (r *dbRecoveryCodeRepository) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	if _, err := r.db.NewDelete().Model((*model.RecoveryCodeModel)(nil)).Where("user_id = ?", userID).
+		Exec(ctx); err != nil {
+		return err
+	}
+
+	if len(codeHashes) == 0 {
+		return nil
+	}
+
+	codes := make([]model.RecoveryCodeModel, len(codeHashes))
+	for i, codeHash := range codeHashes {
+		codes[i] = model.RecoveryCodeModel{UserID: userID, CodeHash: codeHash}
+	}
+
+	_, err := r.db.NewInsert().Model(&codes).Exec(ctx)
+	return err
+}
+
+func (r *dbRecoveryCodeRepository) ConsumeRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) error {
+	res, err := r.db.NewDelete().Model((*model.RecoveryCodeModel)(nil)).
+		Where("user_id = ? AND code_hash = ?", userID, codeHash).Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
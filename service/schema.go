@@ -2,110 +2,89 @@ package service
 
 import (
 	"context"
-	"database/sql"
 	"github.com/google/uuid"
-	"github.com/sean-b-martin/dynamic-webforms-server/database"
 	"github.com/sean-b-martin/dynamic-webforms-server/model"
 	"github.com/uptrace/bun"
 )
 
 type SchemaService interface {
-	GetSchemas(formID uuid.UUID) ([]model.FormSchemaModel, error)
-	GetSchema(formID uuid.UUID, schemaID uuid.UUID) (model.FormSchemaModel, error)
-	CreateSchema(formID uuid.UUID, userID uuid.UUID, formSchema model.FormSchemaModel) error
-	UpdateSchema(username uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, schemaData map[string]interface{}) error
-	DeleteSchema(userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID) error
+	GetSchemas(ctx context.Context, formID uuid.UUID) ([]model.FormSchemaModel, error)
+	GetSchema(ctx context.Context, formID uuid.UUID, schemaID uuid.UUID) (model.FormSchemaModel, error)
+	CreateSchema(ctx context.Context, formID uuid.UUID, userID uuid.UUID, formSchema model.FormSchemaModel) error
+	UpdateSchema(ctx context.Context, username uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, schemaData map[string]interface{}, version int64) error
+	DeleteSchema(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, version int64) error
 }
 
-func NewSchemaService(db *bun.DB) SchemaService {
-	return &SchemaServiceImpl{db: db, dbService: NewGenericDBService[model.FormSchemaModel](db)}
+func NewSchemaService(store Store) SchemaService {
+	return tracedSchemaService{next: &SchemaServiceImpl{store: store}}
 }
 
 type SchemaServiceImpl struct {
-	db        *bun.DB
-	dbService GenericDBService[model.FormSchemaModel]
+	store Store
 }
 
-func (s *SchemaServiceImpl) GetSchemas(formID uuid.UUID) ([]model.FormSchemaModel, error) {
-	return s.dbService.GetModels("form_id = ?", formID)
+func (s *SchemaServiceImpl) GetSchemas(ctx context.Context, formID uuid.UUID) ([]model.FormSchemaModel, error) {
+	return s.store.Repositories().Schemas.GetSchemas(ctx, formID)
 }
 
-func (s *SchemaServiceImpl) GetSchema(formID uuid.UUID, schemaID uuid.UUID) (model.FormSchemaModel, error) {
-	return s.dbService.GetModel("id = ? AND form_id = ? ", schemaID, formID)
+func (s *SchemaServiceImpl) GetSchema(ctx context.Context, formID uuid.UUID, schemaID uuid.UUID) (model.FormSchemaModel, error) {
+	return s.store.Repositories().Schemas.GetSchema(ctx, formID, schemaID)
 }
 
-func (s *SchemaServiceImpl) CreateSchema(userID uuid.UUID, formID uuid.UUID, schema model.FormSchemaModel) error {
-	tx, err := s.db.BeginTx(context.Background(), nil)
-	if err != nil {
-		return err
-	}
-	defer database.TXLogErrRollback(&tx)
+func (s *SchemaServiceImpl) CreateSchema(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schema model.FormSchemaModel) error {
+	return s.store.RunInTx(ctx, func(ctx context.Context, repos Repositories) error {
+		if err := requireFormOwner(ctx, repos.Forms, formID, userID); err != nil {
+			return err
+		}
 
-	schema.FormID = formID
-	if err := isFormOwner(&tx, formID, userID); err != nil {
-		return err
-	}
-
-	_, err = tx.NewInsert().Model(&schema).Column("title", "version", "schema", "read_only", "form_id").
-		Exec(context.Background())
-	if err != nil {
+		schema.FormID = formID
+		_, err := repos.Schemas.InsertSchema(ctx, userID, schema)
 		return err
-	}
-
-	return tx.Commit()
+	})
 }
 
-func (s *SchemaServiceImpl) UpdateSchema(username uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, schemaData map[string]interface{}) error {
-	tx, err := s.db.BeginTx(context.Background(), nil)
-	if err != nil {
-		return err
-	}
-	defer database.TXLogErrRollback(&tx)
+func (s *SchemaServiceImpl) UpdateSchema(ctx context.Context, username uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, schemaData map[string]interface{}, version int64) error {
+	return s.store.RunInTx(ctx, func(ctx context.Context, repos Repositories) error {
+		if err := requireFormOwner(ctx, repos.Forms, formID, username); err != nil {
+			return err
+		}
 
-	if err := isFormOwner(&tx, formID, username); err != nil {
-		return err
-	}
+		current, err := repos.Schemas.GetSchema(ctx, formID, schemaID)
+		if err != nil {
+			return err
+		}
 
-	query := tx.NewUpdate().Model((*model.FormSchemaModel)(nil)).Where("id = ? AND form_id = ? ", schemaID, formID)
-	for k, v := range schemaData {
-		query.SetColumn(k, "?", v)
-	}
-	if _, err := query.Exec(context.Background()); err != nil {
-		return err
-	}
+		if err := checkRowVersion(current.RowVersion, version); err != nil {
+			return err
+		}
 
-	return tx.Commit()
+		return repos.Schemas.UpdateSchema(ctx, username, current, schemaData)
+	})
 }
 
-func (s *SchemaServiceImpl) DeleteSchema(userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID) error {
-	tx, err := s.db.BeginTx(context.Background(), nil)
-	if err != nil {
-		return err
-	}
-	defer database.TXLogErrRollback(&tx)
-
-	if err := isFormOwner(&tx, formID, userID); err != nil {
-		return err
-	}
+func (s *SchemaServiceImpl) DeleteSchema(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, version int64) error {
+	return s.store.RunInTx(ctx, func(ctx context.Context, repos Repositories) error {
+		if err := requireFormOwner(ctx, repos.Forms, formID, userID); err != nil {
+			return err
+		}
 
-	res, err := tx.NewDelete().Model((*model.FormSchemaModel)(nil)).
-		Where("id = ? AND form_id = ? ", schemaID, formID).Exec(context.Background())
+		current, err := repos.Schemas.GetSchema(ctx, formID, schemaID)
+		if err != nil {
+			return err
+		}
 
-	if err != nil {
-		return err
-	}
-
-	if rows, _ := res.RowsAffected(); rows == 0 {
-		return sql.ErrNoRows
-	}
+		if err := checkRowVersion(current.RowVersion, version); err != nil {
+			return err
+		}
 
-	return tx.Commit()
+		return repos.Schemas.DeleteSchema(ctx, userID, current, softDeleteTime())
+	})
 }
 
-func isFormOwner(tx *bun.Tx, formID uuid.UUID, userID uuid.UUID) error {
+func isFormOwner(ctx context.Context, db bun.IDB, formID uuid.UUID, userID uuid.UUID) error {
 	var form model.FormModel
-	err := tx.NewSelect().Model((*model.FormModel)(nil)).Column("user_id").Where("id = ?", formID).
-		Scan(context.Background(), &form)
+	err := db.NewSelect().Model((*model.FormModel)(nil)).Column("user_id").Where("id = ?", formID).
+		Scan(ctx, &form)
 
 	if err != nil {
 		return err
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"html"
+	"strings"
+)
+
+const (
+	SearchResultTypeForm       = "form"
+	SearchResultTypeSchema     = "schema"
+	SearchResultTypeSubmission = "submission"
+)
+
+type SearchResult struct {
+	Type     string     `bun:"type" json:"type"`
+	ID       uuid.UUID  `bun:"id" json:"id"`
+	FormID   uuid.UUID  `bun:"form_id" json:"formID"`
+	SchemaID *uuid.UUID `bun:"schema_id" json:"schemaID,omitempty"`
+	Title    string     `bun:"title" json:"title"`
+	// Headline is HTML, the matched words are wrapped in mark elements and all other text is escaped.
+	Headline string  `bun:"headline" json:"headline"`
+	Rank     float64 `bun:"rank" json:"rank"`
+}
+
+type SearchService interface {
+	Search(ctx context.Context, userID uuid.UUID, query string, limit int) ([]SearchResult, error)
+}
+
+type searchServiceImpl struct {
+	db *bun.DB
+}
+
+func NewSearchService(db *bun.DB) SearchService {
+	return tracedSearchService{next: &searchServiceImpl{db: db}}
+}
+
+// searchQuery searches forms, schemas and submissions at once. Forms and schemas are public, submissions are
+// only visible to the owner of the form and to the user who submitted them.
+const searchQuery = `
+WITH query AS (SELECT websearch_to_tsquery('simple', ?0) AS q)
+SELECT 'form' AS type, f.id, f.id AS form_id, NULL::uuid AS schema_id, f.title,
+	ts_headline('simple', f.title, query.q, ?3) AS headline,
+	ts_rank(f.search_vector, query.q) AS rank
+FROM forms AS f, query
+WHERE f.search_vector @@ query.q AND f.deleted_at IS NULL
+UNION ALL
+SELECT 'schema', s.id, s.form_id, s.id, s.title,
+	ts_headline('simple', concat_ws(' ', s.title, (SELECT string_agg(label, ' ')
+		FROM jsonb_array_elements_text(jsonb_path_query_array(s.schema, '$.fields[*].label')) AS label)), query.q, ?3),
+	ts_rank(s.search_vector, query.q)
+FROM form_schemas AS s, query
+WHERE s.search_vector @@ query.q AND s.deleted_at IS NULL
+UNION ALL
+SELECT 'submission', d.id, s.form_id, d.form_schema_id, d.name,
+	ts_headline('simple', concat_ws(' ', d.name, (SELECT string_agg(answer #>> '{}', ' ')
+		FROM jsonb_path_query(d.data, 'strict $.**') AS answer WHERE jsonb_typeof(answer) = 'string')), query.q, ?3),
+	ts_rank(d.search_vector, query.q)
+FROM form_data AS d
+	JOIN form_schemas AS s ON s.id = d.form_schema_id
+	JOIN forms AS f ON f.id = s.form_id, query
+WHERE d.search_vector @@ query.q AND d.deleted_at IS NULL AND (f.user_id = ?1 OR d.user_id = ?1)
+ORDER BY rank DESC
+LIMIT ?2`
+
+// Postgres marks the matches of headlines with characters from the private use area, which are replaced with mark
+// elements after the text of the forms and answers has been escaped.
+const (
+	headlineStartSel      = "\ue000"
+	headlineStopSel       = "\ue001"
+	searchHeadlineOptions = `StartSel="` + headlineStartSel + `", StopSel="` + headlineStopSel +
+		`", MaxFragments=3, FragmentDelimiter=" … "`
+)
+
+var headlineMarks = strings.NewReplacer(headlineStartSel, "<mark>", headlineStopSel, "</mark>")
+
+func (s *searchServiceImpl) Search(ctx context.Context, userID uuid.UUID, query string, limit int) ([]SearchResult, error) {
+	if !isPostgres(s.db) {
+		return nil, ErrNotSupported
+	}
+
+	results := make([]SearchResult, 0)
+	if err := s.db.NewRaw(searchQuery, query, userID, limit, searchHeadlineOptions).Scan(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		results[i].Headline = highlightHeadline(results[i].Headline)
+	}
+
+	return results, nil
+}
+
+// highlightHeadline escapes a headline generated with searchHeadlineOptions and marks its matches.
+func highlightHeadline(headline string) string {
+	return headlineMarks.Replace(html.EscapeString(headline))
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHighlightHeadline(t *testing.T) {
+	tests := []struct {
+		name     string
+		headline string
+		want     string
+	}{
+		{name: "match", headline: "customer " + headlineStartSel + "feedback" + headlineStopSel,
+			want: "customer <mark>feedback</mark>"},
+		{name: "markup in answer", headline: `<img src=x onerror="alert(1)"> ` + headlineStartSel + "feedback" +
+			headlineStopSel, want: `&lt;img src=x onerror=&#34;alert(1)&#34;&gt; <mark>feedback</mark>`},
+		{name: "mark elements in answer", headline: "<mark>" + headlineStartSel + "x" + headlineStopSel + "</mark>",
+			want: "&lt;mark&gt;<mark>x</mark>&lt;/mark&gt;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, highlightHeadline(tt.headline))
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/model"
+	"log/slog"
+	"time"
+)
+
+type SessionService interface {
+	// GetSessions returns the sessions of a user which have not expired.
+	GetSessions(ctx context.Context, userID uuid.UUID) ([]model.SessionModel, error)
+	RevokeSession(ctx context.Context, userID uuid.UUID, id uuid.UUID) error
+	// ValidateSession records the activity of the session with the ID of an access token. It returns
+	// ErrSessionRevoked if the user has no such session or it has expired.
+	ValidateSession(ctx context.Context, userID uuid.UUID, id uuid.UUID) error
+	DeleteExpiredSessions(ctx context.Context) (int64, error)
+}
+
+type sessionServiceImpl struct {
+	store Store
+}
+
+func NewSessionService(store Store) SessionService {
+	return tracedSessionService{next: &sessionServiceImpl{store: store}}
+}
+
+func (s *sessionServiceImpl) GetSessions(ctx context.Context, userID uuid.UUID) ([]model.SessionModel, error) {
+	return s.store.Repositories().Sessions.GetSessionsOfUser(ctx, userID, time.Now().UTC())
+}
+
+func (s *sessionServiceImpl) RevokeSession(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	return s.store.Repositories().Sessions.DeleteSession(ctx, userID, id)
+}
+
+func (s *sessionServiceImpl) ValidateSession(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	session, err := s.store.Repositories().Sessions.GetSession(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSessionRevoked
+	} else if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if session.UserID != userID || !now.Before(session.ExpiresAt) {
+		return ErrSessionRevoked
+	}
+
+	// like the last use of API keys, the last activity is informational
+	if now.Sub(session.LastSeenAt) >= lastUsedResolution {
+		if err := s.store.Repositories().Sessions.UpdateSessionLastSeen(ctx, id, now); err != nil {
+			slog.WarnContext(ctx, "failed recording activity of session", slog.Any("error", err))
+		}
+	}
+
+	return nil
+}
+
+func (s *sessionServiceImpl) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	return s.store.Repositories().Sessions.DeleteExpiredSessions(ctx, time.Now().UTC())
+}
+
+// DeleteExpiredSessionsPeriodically deletes expired sessions every interval until ctx is done.
+func DeleteExpiredSessionsPeriodically(ctx context.Context, logger *slog.Logger, sessionService SessionService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if deleted, err := sessionService.DeleteExpiredSessions(ctx); err != nil {
+			logger.ErrorContext(ctx, "failed deleting expired sessions", "error", err)
+		} else if deleted > 0 {
+			logger.InfoContext(ctx, "deleted expired sessions", "sessions", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/database"
+	"github.com/sean-b-martin/dynamic-webforms-server/model"
+	"github.com/uptrace/bun"
+	"slices"
+	"time"
+)
+
+const histogramBuckets = 10
+
+type ValueCount struct {
+	Value string `bun:"value" json:"value"`
+	Count int64  `bun:"count" json:"count"`
+}
+
+type PeriodCount struct {
+	Period time.Time `bun:"period" json:"period"`
+	Count  int64     `bun:"count" json:"count"`
+}
+
+type HistogramBucket struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+	Count int64   `json:"count"`
+}
+
+type NumberStatistics struct {
+	Min       float64           `bun:"min" json:"min"`
+	Max       float64           `bun:"max" json:"max"`
+	Mean      float64           `bun:"mean" json:"mean"`
+	Median    float64           `bun:"median" json:"median"`
+	Histogram []HistogramBucket `bun:"-" json:"histogram"`
+}
+
+type FieldStatistics struct {
+	Field     string                `json:"field"`
+	Type      model.SchemaFieldType `json:"type"`
+	Responses int64                 `json:"responses"`
+	Options   []ValueCount          `json:"options,omitempty"`
+	Number    *NumberStatistics     `json:"number,omitempty"`
+	Dates     []PeriodCount         `json:"dates,omitempty"`
+}
+
+type SchemaStatistics struct {
+	Submissions         int64             `json:"submissions"`
+	SubmissionsOverTime []PeriodCount     `json:"submissionsOverTime"`
+	Fields              []FieldStatistics `json:"fields"`
+}
+
+type StatisticsService interface {
+	GetSchemaStatistics(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, interval string) (SchemaStatistics, error)
+}
+
+type statisticsServiceImpl struct {
+	db *bun.DB
+}
+
+func NewStatisticsService(db *bun.DB) StatisticsService {
+	return tracedStatisticsService{next: &statisticsServiceImpl{db: db}}
+}
+
+// GetSchemaStatistics aggregates the submissions of a schema per field. All aggregates are computed inside a single
+// read-only snapshot, interval is passed to date_trunc and truncateDate and must be validated by the caller.
+func (s *statisticsServiceImpl) GetSchemaStatistics(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, interval string) (SchemaStatistics, error) {
+	var statistics SchemaStatistics
+	if !isPostgres(s.db) {
+		return statistics, ErrNotSupported
+	}
+
+	opts := &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	err := database.RunInTxWithOptions(ctx, s.db, opts, func(ctx context.Context, tx bun.Tx) error {
+		statistics = SchemaStatistics{SubmissionsOverTime: make([]PeriodCount, 0), Fields: make([]FieldStatistics, 0)}
+
+		if err := isFormOwner(ctx, tx, formID, userID); err != nil {
+			return err
+		}
+
+		schema, err := getSchemaOfForm(ctx, tx, formID, schemaID)
+		if err != nil {
+			return err
+		}
+
+		definition, err := model.ParseSchemaDefinition(schema.Schema)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.NewRaw(`SELECT date_trunc(?, created_at) AS period, count(*) AS count FROM form_data
+			WHERE deleted_at IS NULL AND form_schema_id = ? GROUP BY period ORDER BY period`, interval, schemaID).
+			Scan(ctx, &statistics.SubmissionsOverTime); err != nil {
+			return err
+		}
+
+		for _, period := range statistics.SubmissionsOverTime {
+			statistics.Submissions += period.Count
+		}
+
+		for _, field := range definition.Fields {
+			fieldStatistics, err := getFieldStatistics(ctx, tx, schemaID, field, interval)
+			if err != nil {
+				return err
+			}
+
+			statistics.Fields = append(statistics.Fields, fieldStatistics)
+		}
+
+		return nil
+	})
+
+	return statistics, err
+}
+
+func getFieldStatistics(ctx context.Context, db bun.IDB, schemaID uuid.UUID, field model.SchemaField, interval string) (FieldStatistics, error) {
+	statistics := FieldStatistics{Field: field.Name, Type: field.Type}
+
+	err := db.NewRaw(`SELECT count(*) FROM form_data WHERE deleted_at IS NULL AND form_schema_id = ?
+		AND coalesce(jsonb_typeof(data->?), 'null') <> 'null'`, schemaID, field.Name).
+		Scan(ctx, &statistics.Responses)
+	if err != nil || statistics.Responses == 0 {
+		return statistics, err
+	}
+
+	switch field.Type {
+	case model.SchemaFieldTypeChoice, model.SchemaFieldTypeBoolean:
+		// choice fields allowing multiple selections store an array, every selected option is counted
+		err = db.NewRaw(`SELECT value, count(*) AS count FROM form_data,
+			jsonb_array_elements_text(CASE WHEN jsonb_typeof(data->?0) = 'array' THEN data->?0
+				ELSE jsonb_build_array(data->?0) END) AS value
+			WHERE deleted_at IS NULL AND form_schema_id = ?1 AND value IS NOT NULL
+			GROUP BY value ORDER BY count DESC, value`,
+			field.Name, schemaID).Scan(ctx, &statistics.Options)
+	case model.SchemaFieldTypeNumber:
+		statistics.Number, err = getNumberStatistics(ctx, db, schemaID, field)
+	case model.SchemaFieldTypeDate:
+		// the answers are parsed by countDatesPerPeriod, casting them in the query fails for invalid dates
+		var dates []ValueCount
+		err = db.NewRaw(`SELECT left(data->>?0, 10) AS value, count(*) AS count FROM form_data
+			WHERE deleted_at IS NULL AND form_schema_id = ?1 AND jsonb_typeof(data->?0) = 'string'
+			GROUP BY value`, field.Name, schemaID).Scan(ctx, &dates)
+		statistics.Dates = countDatesPerPeriod(dates, interval)
+	}
+
+	return statistics, err
+}
+
+// countDatesPerPeriod sums the counts of dates formatted as YYYY-MM-DD per period like date_trunc, other values are
+// skipped.
+func countDatesPerPeriod(dates []ValueCount, interval string) []PeriodCount {
+	counts := make(map[time.Time]int64)
+	for _, date := range dates {
+		day, err := time.Parse(time.DateOnly, date.Value)
+		if err != nil {
+			continue
+		}
+
+		counts[truncateDate(day, interval)] += date.Count
+	}
+
+	var periods []PeriodCount
+	for period, count := range counts {
+		periods = append(periods, PeriodCount{Period: period, Count: count})
+	}
+	slices.SortFunc(periods, func(a, b PeriodCount) int { return a.Period.Compare(b.Period) })
+
+	return periods
+}
+
+// truncateDate truncates a date to the start of its day, ISO week, month or year.
+func truncateDate(date time.Time, interval string) time.Time {
+	switch interval {
+	case "week":
+		return date.AddDate(0, 0, -(int(date.Weekday())+6)%7)
+	case "month":
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case "year":
+		return time.Date(date.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return date
+	}
+}
+
+func getNumberStatistics(ctx context.Context, db bun.IDB, schemaID uuid.UUID, field model.SchemaField) (*NumberStatistics, error) {
+	var statistics NumberStatistics
+	var count int64
+
+	numbers := db.NewRaw(`SELECT (data->>?0)::float8 AS x FROM form_data
+		WHERE deleted_at IS NULL AND form_schema_id = ?1 AND jsonb_typeof(data->?0) = 'number'`, field.Name, schemaID)
+
+	err := db.NewRaw(`SELECT count(x), min(x) AS min, max(x) AS max, avg(x) AS mean,
+		percentile_cont(0.5) WITHIN GROUP (ORDER BY x) AS median FROM (?) AS numbers`, numbers).
+		Scan(ctx, &count, &statistics.Min, &statistics.Max, &statistics.Mean, &statistics.Median)
+	if err != nil || count == 0 {
+		return nil, err
+	}
+
+	width := (statistics.Max - statistics.Min) / histogramBuckets
+	if width == 0 {
+		statistics.Histogram = []HistogramBucket{{Lower: statistics.Min, Upper: statistics.Max, Count: count}}
+		return &statistics, nil
+	}
+
+	var buckets []struct {
+		Bucket int   `bun:"bucket"`
+		Count  int64 `bun:"count"`
+	}
+	// the maximum falls into bucket n+1 of width_bucket, it is clamped into the last bucket
+	err = db.NewRaw(`SELECT least(width_bucket(x, ?, ?, ?), ?) AS bucket, count(*) AS count FROM (?) AS numbers
+		GROUP BY bucket`, statistics.Min, statistics.Max, histogramBuckets, histogramBuckets, numbers).
+		Scan(ctx, &buckets)
+	if err != nil {
+		return nil, err
+	}
+
+	statistics.Histogram = make([]HistogramBucket, histogramBuckets)
+	for i := range statistics.Histogram {
+		statistics.Histogram[i].Lower = statistics.Min + float64(i)*width
+		statistics.Histogram[i].Upper = statistics.Min + float64(i+1)*width
+	}
+	for _, bucket := range buckets {
+		statistics.Histogram[bucket.Bucket-1].Count = bucket.Count
+	}
+
+	return &statistics, nil
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCountDatesPerPeriod(t *testing.T) {
+	dates := []ValueCount{
+		{Value: "2024-03-06", Count: 2},
+		{Value: "2024-03-04", Count: 1},
+		{Value: "2024-02-29", Count: 1},
+		{Value: "2024-13-45", Count: 5},
+		{Value: "2023-02-29", Count: 3},
+		{Value: "n/a", Count: 1},
+	}
+	day := func(value string) time.Time {
+		date, _ := time.Parse(time.DateOnly, value)
+		return date
+	}
+
+	tests := []struct {
+		interval string
+		want     []PeriodCount
+	}{
+		{interval: "day", want: []PeriodCount{{Period: day("2024-02-29"), Count: 1},
+			{Period: day("2024-03-04"), Count: 1}, {Period: day("2024-03-06"), Count: 2}}},
+		{interval: "week", want: []PeriodCount{{Period: day("2024-02-26"), Count: 1},
+			{Period: day("2024-03-04"), Count: 3}}},
+		{interval: "month", want: []PeriodCount{{Period: day("2024-02-01"), Count: 1},
+			{Period: day("2024-03-01"), Count: 3}}},
+		{interval: "year", want: []PeriodCount{{Period: day("2024-01-01"), Count: 4}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.interval, func(t *testing.T) {
+			assert.Equal(t, tt.want, countDatesPerPeriod(dates, tt.interval))
+		})
+	}
+}
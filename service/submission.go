@@ -0,0 +1,334 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/database"
+	"github.com/sean-b-martin/dynamic-webforms-server/metrics"
+	"github.com/sean-b-martin/dynamic-webforms-server/model"
+	"github.com/uptrace/bun"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SubmissionFilter struct {
+	Field    string
+	Operator string
+	Value    string
+}
+
+type SubmissionService interface {
+	GetSubmissions(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, filters []SubmissionFilter) ([]model.FormDataModel, error)
+	GetSubmission(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, submissionID uuid.UUID) (model.FormDataModel, error)
+	CreateSubmission(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, submission model.FormDataModel) error
+	DeleteSubmission(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, submissionID uuid.UUID, version int64) error
+}
+
+type submissionServiceImpl struct {
+	db *bun.DB
+}
+
+func NewSubmissionService(db *bun.DB) SubmissionService {
+	return tracedSubmissionService{next: &submissionServiceImpl{db: db}}
+}
+
+func (s *submissionServiceImpl) GetSubmissions(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, filters []SubmissionFilter) ([]model.FormDataModel, error) {
+	var submissions []model.FormDataModel
+	if len(filters) > 0 && !isPostgres(s.db) {
+		return nil, ErrNotSupported
+	}
+
+	err := database.RunInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		if err := isFormOwner(ctx, tx, formID, userID); err != nil {
+			return err
+		}
+
+		schema, err := getSchemaOfForm(ctx, tx, formID, schemaID)
+		if err != nil {
+			return err
+		}
+
+		query := tx.NewSelect().Model((*model.FormDataModel)(nil)).Where("form_schema_id = ?", schemaID).
+			Order("created_at DESC")
+		if len(filters) == 0 {
+			return query.Scan(ctx, &submissions)
+		}
+
+		definition, err := model.ParseSchemaDefinition(schema.Schema)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidFilter, err)
+		}
+
+		for _, filter := range filters {
+			if err := applySubmissionFilter(query, definition, filter); err != nil {
+				return err
+			}
+		}
+
+		return query.Scan(ctx, &submissions)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return submissions, nil
+}
+
+func (s *submissionServiceImpl) GetSubmission(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, submissionID uuid.UUID) (model.FormDataModel, error) {
+	var submission model.FormDataModel
+	err := database.RunInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		if err := isFormOwner(ctx, tx, formID, userID); err != nil {
+			return err
+		}
+
+		if _, err := getSchemaOfForm(ctx, tx, formID, schemaID); err != nil {
+			return err
+		}
+
+		return tx.NewSelect().Model(&submission).Where("id = ? AND form_schema_id = ?", submissionID, schemaID).
+			Scan(ctx)
+	})
+
+	return submission, err
+}
+
+func (s *submissionServiceImpl) CreateSubmission(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, submission model.FormDataModel) error {
+	err := database.RunInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := getSchemaOfForm(ctx, tx, formID, schemaID); err != nil {
+			return err
+		}
+
+		if err := checkSubmissionLimit(ctx, tx, userID, formID); err != nil {
+			return err
+		}
+
+		submission.UserID = uuid.NullUUID{UUID: userID, Valid: true}
+		submission.FormSchemaID = schemaID
+		submission.SetCreated(userID)
+		_, err := tx.NewInsert().Model(&submission).Column("id", "user_id", "form_schema_id", "name", "data").
+			Column(model.AuditColumnsCreate...).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	metrics.SubmissionsCreated.Inc()
+	return nil
+}
+
+func (s *submissionServiceImpl) DeleteSubmission(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, submissionID uuid.UUID, version int64) error {
+	return database.RunInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		var submission model.FormDataModel
+
+		if err := isFormOwner(ctx, tx, formID, userID); err != nil {
+			return err
+		}
+
+		if _, err := getSchemaOfForm(ctx, tx, formID, schemaID); err != nil {
+			return err
+		}
+
+		if err := tx.NewSelect().Model(&submission).Where("id = ? AND form_schema_id = ?", submissionID, schemaID).
+			Scan(ctx); err != nil {
+			return err
+		}
+
+		if err := checkRowVersion(submission.RowVersion, version); err != nil {
+			return err
+		}
+
+		rows, err := softDelete[model.FormDataModel](ctx, tx, userID, softDeleteTime(), "id = ? AND row_version = ?",
+			submissionID, submission.RowVersion)
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrVersionMismatch
+		}
+
+		return nil
+	})
+}
+
+// checkSubmissionLimit returns ErrSubmissionLimit if the user reached the submission limit of the form within the
+// last hour. Deleted submissions are counted as well, so deleting them does not lift the limit. The form is locked
+// until the transaction ends, so concurrent submissions cannot all pass the count before any of them is inserted.
+// SQLite transactions hold the write lock of the database from their start anyway.
+func checkSubmissionLimit(ctx context.Context, db bun.IDB, userID uuid.UUID, formID uuid.UUID) error {
+	var form model.FormModel
+	query := db.NewSelect().Model(&form).Column("submissions_per_hour").Where("id = ?", formID)
+	if isPostgres(db) {
+		query.For("UPDATE")
+	}
+	if err := query.Scan(ctx); err != nil {
+		return err
+	}
+
+	if form.SubmissionsPerHour == 0 {
+		return nil
+	}
+
+	submissions, err := db.NewSelect().Model((*model.FormDataModel)(nil)).WhereAllWithDeleted().
+		Where("user_id = ?", userID).
+		Where("form_schema_id IN (SELECT id FROM form_schemas WHERE form_id = ?)", formID).
+		Where("created_at > ?", time.Now().UTC().Add(-time.Hour)).
+		Count(ctx)
+	if err != nil {
+		return err
+	}
+
+	if submissions >= form.SubmissionsPerHour {
+		return ErrSubmissionLimit
+	}
+
+	return nil
+}
+
+func getSchemaOfForm(ctx context.Context, db bun.IDB, formID uuid.UUID, schemaID uuid.UUID) (model.FormSchemaModel, error) {
+	var schema model.FormSchemaModel
+	err := db.NewSelect().Model(&schema).Where("id = ? AND form_id = ?", schemaID, formID).
+		Scan(ctx)
+	return schema, err
+}
+
+var submissionFilterOperators = map[string]string{
+	"eq":  "=",
+	"ne":  "IS DISTINCT FROM",
+	"gt":  ">",
+	"gte": ">=",
+	"lt":  "<",
+	"lte": "<=",
+}
+
+// applySubmissionFilter compiles a filter into a parameterized predicate on the jsonb data column. Equality
+// uses jsonb containment so the GIN index on form_data.data can be used, range predicates use the same
+// expressions as the indexes created by createSubmissionIndexes.
+func applySubmissionFilter(query *bun.SelectQuery, definition model.SchemaDefinition, filter SubmissionFilter) error {
+	field, ok := definition.Field(filter.Field)
+	if !ok {
+		return fmt.Errorf("%w: unknown field %q", ErrInvalidFilter, filter.Field)
+	}
+
+	var value interface{}
+	switch field.Type {
+	case model.SchemaFieldTypeText, model.SchemaFieldTypeChoice:
+		if filter.Operator == "contains" {
+			query.Where("data->>? ILIKE ?", field.Name, "%"+escapeLikePattern(filter.Value)+"%")
+			return nil
+		}
+		value = filter.Value
+	case model.SchemaFieldTypeNumber:
+		number, err := strconv.ParseFloat(filter.Value, 64)
+		if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+			return fmt.Errorf("%w: field %q expects a number", ErrInvalidFilter, field.Name)
+		}
+		value = number
+	case model.SchemaFieldTypeDate:
+		date, err := time.Parse(time.DateOnly, filter.Value)
+		if err != nil {
+			return fmt.Errorf("%w: field %q expects a date formatted as YYYY-MM-DD", ErrInvalidFilter, field.Name)
+		}
+		// ISO 8601 dates compare correctly as text, which keeps the expression immutable and indexable
+		value = date.Format(time.DateOnly)
+	case model.SchemaFieldTypeBoolean:
+		boolean, err := strconv.ParseBool(filter.Value)
+		if err != nil {
+			return fmt.Errorf("%w: field %q expects a boolean", ErrInvalidFilter, field.Name)
+		}
+		if filter.Operator != "eq" && filter.Operator != "ne" {
+			return fmt.Errorf("%w: operator %q is not supported for boolean fields", ErrInvalidFilter, filter.Operator)
+		}
+		value = boolean
+	default:
+		return fmt.Errorf("%w: field %q of type %q can not be filtered", ErrInvalidFilter, field.Name, field.Type)
+	}
+
+	operator, ok := submissionFilterOperators[filter.Operator]
+	if !ok {
+		return fmt.Errorf("%w: unknown operator %q", ErrInvalidFilter, filter.Operator)
+	}
+
+	switch {
+	case filter.Operator == "eq":
+		query.Where("data @> ?::jsonb", map[string]interface{}{field.Name: value})
+	case field.Type == model.SchemaFieldTypeNumber:
+		query.Where(database.NumberAnswerExpression+" "+operator+" ?1", field.Name, value)
+	case field.Type == model.SchemaFieldTypeBoolean:
+		// compared as jsonb, answers of other types are distinct from the value instead of failing a cast
+		query.Where("data->? "+operator+" ?::jsonb", field.Name, strconv.FormatBool(value.(bool)))
+	default:
+		query.Where("data->>? "+operator+" ?", field.Name, value)
+	}
+
+	return nil
+}
+
+func escapeLikePattern(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+const (
+	// maxIndexedFields limits the indexed fields of a schema and maxSubmissionIndexes the expression indexes of all
+	// schemas, every index slows down writes to form_data.
+	maxIndexedFields     = 8
+	maxSubmissionIndexes = 512
+)
+
+// createSubmissionIndexes creates partial expression indexes for all fields of the schema marked as indexed.
+func createSubmissionIndexes(ctx context.Context, db bun.IDB, schema model.FormSchemaModel) error {
+	if !isPostgres(db) {
+		return nil
+	}
+
+	definition, err := model.ParseSchemaDefinition(schema.Schema)
+	if err != nil {
+		// schemas without a parsable definition have no typed fields to index
+		return nil
+	}
+
+	fields := make(map[string]model.SchemaField)
+	for _, field := range definition.Fields {
+		if field.Indexed {
+			fields[database.SubmissionIndexName(schema.ID, field.Name)] = field
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	if len(fields) > maxIndexedFields {
+		return fmt.Errorf("%w: a schema can have at most %d indexed fields", ErrTooManyIndexes, maxIndexedFields)
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+
+	var otherIndexes int
+	if err := db.NewRaw(`SELECT count(*) FROM pg_indexes WHERE tablename = 'form_data'
+		AND indexname ~ '^form_data_[0-9a-f]{32}$' AND indexname NOT IN (?)`, bun.In(names)).
+		Scan(ctx, &otherIndexes); err != nil {
+		return err
+	}
+
+	if otherIndexes+len(fields) > maxSubmissionIndexes {
+		return fmt.Errorf("%w: the submissions of all schemas can have at most %d indexed fields", ErrTooManyIndexes,
+			maxSubmissionIndexes)
+	}
+
+	for name, field := range fields {
+		if err := database.CreateSubmissionIndex(ctx, db, name, schema.ID, field.Name,
+			field.Type == model.SchemaFieldTypeNumber); err != nil {
+			return fmt.Errorf("failed creating index for field %q: %w", field.Name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/database"
+	"github.com/sean-b-martin/dynamic-webforms-server/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+var testFilterSchema = model.SchemaDefinition{Fields: []model.SchemaField{
+	{Name: "name", Type: model.SchemaFieldTypeText},
+	{Name: "age", Type: model.SchemaFieldTypeNumber, Indexed: true},
+	{Name: "born", Type: model.SchemaFieldTypeDate},
+	{Name: "subscribed", Type: model.SchemaFieldTypeBoolean},
+}}
+
+// newTestPostgres connects to the Postgres database of TEST_POSTGRES_DSN and creates the tables, tests using it are
+// skipped if it is not set.
+func newTestPostgres(t *testing.T) *bun.DB {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN not set")
+	}
+
+	db := bun.NewDB(sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(dsn))), pgdialect.New())
+	t.Cleanup(func() { _ = db.Close() })
+	database.CreateTables(db)
+	return db
+}
+
+// newTestSQLite creates an empty SQLite database.
+func newTestSQLite(t *testing.T) *bun.DB {
+	db, err := database.CreateDatabaseConnection(database.ConnectionConfig{Driver: database.DriverSQLite,
+		Path: filepath.Join(t.TempDir(), "forms.db")})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	database.CreateTables(db)
+	return db
+}
+
+func TestApplySubmissionFilter(t *testing.T) {
+	db := bun.NewDB(sql.OpenDB(pgdriver.NewConnector()), pgdialect.New())
+	tests := []struct {
+		name      string
+		filter    SubmissionFilter
+		wantWhere string
+		wantError bool
+	}{
+		{name: "text contains", filter: SubmissionFilter{Field: "name", Operator: "contains", Value: "50%"},
+			wantWhere: `data->>'name' ILIKE '%50\%%'`},
+		{name: "number range", filter: SubmissionFilter{Field: "age", Operator: "gt", Value: "30"},
+			wantWhere: `(CASE WHEN jsonb_typeof(data->'age') = 'number' THEN (data->>'age')::numeric END) > 30`},
+		{name: "number equality", filter: SubmissionFilter{Field: "age", Operator: "eq", Value: "30"},
+			wantWhere: `data @> '{"age":30}'::jsonb`},
+		{name: "boolean inequality", filter: SubmissionFilter{Field: "subscribed", Operator: "ne", Value: "true"},
+			wantWhere: `data->'subscribed' IS DISTINCT FROM 'true'::jsonb`},
+		{name: "date range", filter: SubmissionFilter{Field: "born", Operator: "lt", Value: "2000-01-01"},
+			wantWhere: `data->>'born' < '2000-01-01'`},
+		{name: "unknown field", filter: SubmissionFilter{Field: "email", Operator: "eq", Value: "a"},
+			wantError: true},
+		{name: "invalid number", filter: SubmissionFilter{Field: "age", Operator: "gt", Value: "n/a"},
+			wantError: true},
+		{name: "not a number", filter: SubmissionFilter{Field: "age", Operator: "gt", Value: "NaN"},
+			wantError: true},
+		{name: "infinite number", filter: SubmissionFilter{Field: "age", Operator: "lt", Value: "+Inf"},
+			wantError: true},
+		{name: "invalid date", filter: SubmissionFilter{Field: "born", Operator: "gt", Value: "01.01.2000"},
+			wantError: true},
+		{name: "boolean range", filter: SubmissionFilter{Field: "subscribed", Operator: "gt", Value: "true"},
+			wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := db.NewSelect().Model((*model.FormDataModel)(nil))
+			err := applySubmissionFilter(query, testFilterSchema, tt.filter)
+			if tt.wantError {
+				assert.ErrorIs(t, err, ErrInvalidFilter)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Contains(t, query.String(), tt.wantWhere)
+		})
+	}
+}
+
+func TestSubmissionService_FilterMixedTypes(t *testing.T) {
+	db := newTestPostgres(t)
+	ctx := context.Background()
+	repos := NewDBStore(db).Repositories()
+
+	user, err := repos.Users.InsertUser(ctx, model.UserModel{Username: "filter-" + uuid.NewString()[:8],
+		Password: "hash"})
+	require.NoError(t, err)
+	form, err := repos.Forms.InsertForm(ctx, user.ID, model.FormModel{UserID: user.ID.String(), Title: "filters"})
+	require.NoError(t, err)
+	definition, err := json.Marshal(testFilterSchema)
+	require.NoError(t, err)
+	// the indexed number field gets an expression index, which has to accept answers of other types as well
+	schema, err := repos.Schemas.InsertSchema(ctx, user.ID, model.FormSchemaModel{FormID: form.ID, Title: "v1",
+		Version: "1", Schema: definition})
+	require.NoError(t, err)
+
+	submissions := NewSubmissionService(db)
+	for _, data := range []string{
+		`{"age": 41, "subscribed": true}`,
+		`{"age": "n/a", "subscribed": "yes"}`,
+		`{"age": 25, "subscribed": false}`,
+		`{}`,
+	} {
+		require.NoError(t, submissions.CreateSubmission(ctx, user.ID, form.ID, schema.ID,
+			model.FormDataModel{Name: "submission", Data: json.RawMessage(data)}))
+	}
+
+	tests := []struct {
+		name   string
+		filter SubmissionFilter
+		want   int
+	}{
+		{name: "number greater", filter: SubmissionFilter{Field: "age", Operator: "gt", Value: "30"}, want: 1},
+		{name: "number less or equal", filter: SubmissionFilter{Field: "age", Operator: "lte", Value: "30"}, want: 1},
+		{name: "number not equal", filter: SubmissionFilter{Field: "age", Operator: "ne", Value: "41"}, want: 3},
+		{name: "boolean equal", filter: SubmissionFilter{Field: "subscribed", Operator: "eq", Value: "true"}, want: 1},
+		{name: "boolean not equal", filter: SubmissionFilter{Field: "subscribed", Operator: "ne", Value: "true"},
+			want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := submissions.GetSubmissions(ctx, user.ID, form.ID, schema.ID, []SubmissionFilter{tt.filter})
+			require.NoError(t, err)
+			assert.Len(t, result, tt.want)
+		})
+	}
+}
+
+func TestSubmissionService_IndexLimit(t *testing.T) {
+	db := newTestPostgres(t)
+	ctx := context.Background()
+	repos := NewDBStore(db).Repositories()
+
+	user, err := repos.Users.InsertUser(ctx, model.UserModel{Username: "index-" + uuid.NewString()[:8],
+		Password: "hash"})
+	require.NoError(t, err)
+	form, err := repos.Forms.InsertForm(ctx, user.ID, model.FormModel{UserID: user.ID.String(), Title: "indexes"})
+	require.NoError(t, err)
+
+	var definition model.SchemaDefinition
+	for i := range maxIndexedFields + 1 {
+		definition.Fields = append(definition.Fields, model.SchemaField{Name: fmt.Sprintf("field%d", i),
+			Type: model.SchemaFieldTypeText, Indexed: true})
+	}
+	data, err := json.Marshal(definition)
+	require.NoError(t, err)
+
+	err = NewDBStore(db).RunInTx(ctx, func(ctx context.Context, repos Repositories) error {
+		_, err := repos.Schemas.InsertSchema(ctx, user.ID, model.FormSchemaModel{FormID: form.ID, Title: "v1",
+			Version: "1", Schema: data})
+		return err
+	})
+	assert.ErrorIs(t, err, ErrTooManyIndexes)
+}
+
+func TestSubmissionService_KeepSubmissionsOfDeletedUsersSQLite(t *testing.T) {
+	db := newTestSQLite(t)
+
+	ctx := context.Background()
+	repos := NewDBStore(db).Repositories()
+	owner, err := repos.Users.InsertUser(ctx, model.UserModel{Username: "owner", Password: "hash"})
+	require.NoError(t, err)
+	submitter, err := repos.Users.InsertUser(ctx, model.UserModel{Username: "submitter", Password: "hash"})
+	require.NoError(t, err)
+	form, err := repos.Forms.InsertForm(ctx, owner.ID, model.FormModel{UserID: owner.ID.String(), Title: "survey"})
+	require.NoError(t, err)
+	schema, err := repos.Schemas.InsertSchema(ctx, owner.ID, model.FormSchemaModel{FormID: form.ID, Title: "v1",
+		Version: "1", Schema: []byte(`{"fields":[]}`)})
+	require.NoError(t, err)
+
+	submissions := NewSubmissionService(db)
+	require.NoError(t, submissions.CreateSubmission(ctx, submitter.ID, form.ID, schema.ID,
+		model.FormDataModel{Name: "submission", Data: json.RawMessage(`{}`)}))
+	require.NoError(t, repos.Users.DeleteUser(ctx, submitter.ID))
+
+	result, err := submissions.GetSubmissions(ctx, owner.ID, form.ID, schema.ID, nil)
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+	assert.False(t, result[0].UserID.Valid)
+}
+
+func TestSubmissionService_ConcurrentLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		db   func(t *testing.T) *bun.DB
+	}{
+		{name: "sqlite", db: newTestSQLite},
+		{name: "postgres", db: newTestPostgres},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := tt.db(t)
+			ctx := context.Background()
+			repos := NewDBStore(db).Repositories()
+
+			user, err := repos.Users.InsertUser(ctx, model.UserModel{Username: "limit-" + uuid.NewString()[:8],
+				Password: "hash"})
+			require.NoError(t, err)
+			form, err := repos.Forms.InsertForm(ctx, user.ID, model.FormModel{UserID: user.ID.String(),
+				Title: "limited", SubmissionsPerHour: 3})
+			require.NoError(t, err)
+			schema, err := repos.Schemas.InsertSchema(ctx, user.ID, model.FormSchemaModel{FormID: form.ID,
+				Title: "v1", Version: "1", Schema: []byte(`{"fields":[]}`)})
+			require.NoError(t, err)
+
+			submissions := NewSubmissionService(db)
+			var wg sync.WaitGroup
+			var created atomic.Int32
+			for range 10 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					err := submissions.CreateSubmission(ctx, user.ID, form.ID, schema.ID,
+						model.FormDataModel{Name: "submission", Data: json.RawMessage(`{}`)})
+					if err == nil {
+						created.Add(1)
+					} else {
+						assert.ErrorIs(t, err, ErrSubmissionLimit)
+					}
+				}()
+			}
+			wg.Wait()
+
+			assert.Equal(t, int32(form.SubmissionsPerHour), created.Load())
+		})
+	}
+}
@@ -0,0 +1,396 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/auth"
+	"github.com/sean-b-martin/dynamic-webforms-server/model"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// The services are wrapped by their constructors, so each service call is traced as a span. Spans of the
+// repositories and queries run by a call become its children.
+
+var tracer = otel.Tracer("github.com/sean-b-martin/dynamic-webforms-server/service")
+
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name)
+}
+
+// endSpan ends a span with the result of a service call. Expected errors of the services are recorded with their
+// code, only unexpected errors mark the span as failed.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		var serviceErr *Error
+		if errors.As(err, &serviceErr) {
+			span.SetAttributes(attribute.String("error.code", serviceErr.Code))
+		} else {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	span.End()
+}
+
+type tracedFormService struct {
+	next FormService
+}
+
+func (t tracedFormService) GetFormsOfUser(ctx context.Context, userID uuid.UUID) ([]model.FormModel, error) {
+	ctx, span := startSpan(ctx, "FormService.GetFormsOfUser")
+	forms, err := t.next.GetFormsOfUser(ctx, userID)
+	endSpan(span, err)
+	return forms, err
+}
+
+func (t tracedFormService) GetForm(ctx context.Context, formID uuid.UUID) (model.FormModel, error) {
+	ctx, span := startSpan(ctx, "FormService.GetForm")
+	form, err := t.next.GetForm(ctx, formID)
+	endSpan(span, err)
+	return form, err
+}
+
+func (t tracedFormService) GetForms(ctx context.Context) ([]model.FormModel, error) {
+	ctx, span := startSpan(ctx, "FormService.GetForms")
+	forms, err := t.next.GetForms(ctx)
+	endSpan(span, err)
+	return forms, err
+}
+
+func (t tracedFormService) CreateForm(ctx context.Context, userID uuid.UUID, title string, submissionsPerHour int, initialSchema *model.FormSchemaModel) error {
+	ctx, span := startSpan(ctx, "FormService.CreateForm")
+	err := t.next.CreateForm(ctx, userID, title, submissionsPerHour, initialSchema)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedFormService) UpdateForm(ctx context.Context, userID uuid.UUID, id uuid.UUID, title string, submissionsPerHour *int, version int64) error {
+	ctx, span := startSpan(ctx, "FormService.UpdateForm")
+	err := t.next.UpdateForm(ctx, userID, id, title, submissionsPerHour, version)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedFormService) DeleteForm(ctx context.Context, userID uuid.UUID, id uuid.UUID, version int64) error {
+	ctx, span := startSpan(ctx, "FormService.DeleteForm")
+	err := t.next.DeleteForm(ctx, userID, id, version)
+	endSpan(span, err)
+	return err
+}
+
+type tracedSchemaService struct {
+	next SchemaService
+}
+
+func (t tracedSchemaService) GetSchemas(ctx context.Context, formID uuid.UUID) ([]model.FormSchemaModel, error) {
+	ctx, span := startSpan(ctx, "SchemaService.GetSchemas")
+	schemas, err := t.next.GetSchemas(ctx, formID)
+	endSpan(span, err)
+	return schemas, err
+}
+
+func (t tracedSchemaService) GetSchema(ctx context.Context, formID uuid.UUID, schemaID uuid.UUID) (model.FormSchemaModel, error) {
+	ctx, span := startSpan(ctx, "SchemaService.GetSchema")
+	schema, err := t.next.GetSchema(ctx, formID, schemaID)
+	endSpan(span, err)
+	return schema, err
+}
+
+func (t tracedSchemaService) CreateSchema(ctx context.Context, formID uuid.UUID, userID uuid.UUID, formSchema model.FormSchemaModel) error {
+	ctx, span := startSpan(ctx, "SchemaService.CreateSchema")
+	err := t.next.CreateSchema(ctx, formID, userID, formSchema)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedSchemaService) UpdateSchema(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, schemaData map[string]interface{}, version int64) error {
+	ctx, span := startSpan(ctx, "SchemaService.UpdateSchema")
+	err := t.next.UpdateSchema(ctx, userID, formID, schemaID, schemaData, version)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedSchemaService) DeleteSchema(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, version int64) error {
+	ctx, span := startSpan(ctx, "SchemaService.DeleteSchema")
+	err := t.next.DeleteSchema(ctx, userID, formID, schemaID, version)
+	endSpan(span, err)
+	return err
+}
+
+type tracedSearchService struct {
+	next SearchService
+}
+
+func (t tracedSearchService) Search(ctx context.Context, userID uuid.UUID, query string, limit int) ([]SearchResult, error) {
+	ctx, span := startSpan(ctx, "SearchService.Search")
+	results, err := t.next.Search(ctx, userID, query, limit)
+	endSpan(span, err)
+	return results, err
+}
+
+type tracedStatisticsService struct {
+	next StatisticsService
+}
+
+func (t tracedStatisticsService) GetSchemaStatistics(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, interval string) (SchemaStatistics, error) {
+	ctx, span := startSpan(ctx, "StatisticsService.GetSchemaStatistics")
+	statistics, err := t.next.GetSchemaStatistics(ctx, userID, formID, schemaID, interval)
+	endSpan(span, err)
+	return statistics, err
+}
+
+type tracedSubmissionService struct {
+	next SubmissionService
+}
+
+func (t tracedSubmissionService) GetSubmissions(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, filters []SubmissionFilter) ([]model.FormDataModel, error) {
+	ctx, span := startSpan(ctx, "SubmissionService.GetSubmissions")
+	submissions, err := t.next.GetSubmissions(ctx, userID, formID, schemaID, filters)
+	endSpan(span, err)
+	return submissions, err
+}
+
+func (t tracedSubmissionService) GetSubmission(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, submissionID uuid.UUID) (model.FormDataModel, error) {
+	ctx, span := startSpan(ctx, "SubmissionService.GetSubmission")
+	submission, err := t.next.GetSubmission(ctx, userID, formID, schemaID, submissionID)
+	endSpan(span, err)
+	return submission, err
+}
+
+func (t tracedSubmissionService) CreateSubmission(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, submission model.FormDataModel) error {
+	ctx, span := startSpan(ctx, "SubmissionService.CreateSubmission")
+	err := t.next.CreateSubmission(ctx, userID, formID, schemaID, submission)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedSubmissionService) DeleteSubmission(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, submissionID uuid.UUID, version int64) error {
+	ctx, span := startSpan(ctx, "SubmissionService.DeleteSubmission")
+	err := t.next.DeleteSubmission(ctx, userID, formID, schemaID, submissionID, version)
+	endSpan(span, err)
+	return err
+}
+
+type tracedTrashService struct {
+	next TrashService
+}
+
+func (t tracedTrashService) GetTrash(ctx context.Context, userID uuid.UUID) ([]TrashItem, error) {
+	ctx, span := startSpan(ctx, "TrashService.GetTrash")
+	items, err := t.next.GetTrash(ctx, userID)
+	endSpan(span, err)
+	return items, err
+}
+
+func (t tracedTrashService) RestoreForm(ctx context.Context, userID uuid.UUID, formID uuid.UUID) error {
+	ctx, span := startSpan(ctx, "TrashService.RestoreForm")
+	err := t.next.RestoreForm(ctx, userID, formID)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedTrashService) RestoreSchema(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID) error {
+	ctx, span := startSpan(ctx, "TrashService.RestoreSchema")
+	err := t.next.RestoreSchema(ctx, userID, formID, schemaID)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedTrashService) RestoreSubmission(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, submissionID uuid.UUID) error {
+	ctx, span := startSpan(ctx, "TrashService.RestoreSubmission")
+	err := t.next.RestoreSubmission(ctx, userID, formID, schemaID, submissionID)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedTrashService) PurgeTrash(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	ctx, span := startSpan(ctx, "TrashService.PurgeTrash")
+	purged, err := t.next.PurgeTrash(ctx, deletedBefore)
+	endSpan(span, err)
+	return purged, err
+}
+
+type tracedUserService struct {
+	next UserService
+}
+
+func (t tracedUserService) RegisterUser(ctx context.Context, user model.UserModel) error {
+	ctx, span := startSpan(ctx, "UserService.RegisterUser")
+	err := t.next.RegisterUser(ctx, user)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedUserService) LoginUser(ctx context.Context, user model.UserModel, client ClientInfo) (LoginResult, error) {
+	ctx, span := startSpan(ctx, "UserService.LoginUser")
+	result, err := t.next.LoginUser(ctx, user, client)
+	endSpan(span, err)
+	return result, err
+}
+
+func (t tracedUserService) LoginExternal(ctx context.Context, identity auth.OIDCIdentity, client ClientInfo) (LoginResult, error) {
+	ctx, span := startSpan(ctx, "UserService.LoginExternal")
+	result, err := t.next.LoginExternal(ctx, identity, client)
+	endSpan(span, err)
+	return result, err
+}
+
+func (t tracedUserService) GetUserById(ctx context.Context, id uuid.UUID) (model.UserModel, error) {
+	ctx, span := startSpan(ctx, "UserService.GetUserById")
+	user, err := t.next.GetUserById(ctx, id)
+	endSpan(span, err)
+	return user, err
+}
+
+func (t tracedUserService) UpdateUser(ctx context.Context, id uuid.UUID, sessionID uuid.UUID, password string) error {
+	ctx, span := startSpan(ctx, "UserService.UpdateUser")
+	err := t.next.UpdateUser(ctx, id, sessionID, password)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedUserService) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	ctx, span := startSpan(ctx, "UserService.DeleteUser")
+	err := t.next.DeleteUser(ctx, id)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedUserService) UpdateEmail(ctx context.Context, id uuid.UUID, password string, email string) error {
+	ctx, span := startSpan(ctx, "UserService.UpdateEmail")
+	err := t.next.UpdateEmail(ctx, id, password, email)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedUserService) SendEmailVerification(ctx context.Context, id uuid.UUID) error {
+	ctx, span := startSpan(ctx, "UserService.SendEmailVerification")
+	err := t.next.SendEmailVerification(ctx, id)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedUserService) VerifyEmail(ctx context.Context, token string) error {
+	ctx, span := startSpan(ctx, "UserService.VerifyEmail")
+	err := t.next.VerifyEmail(ctx, token)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedUserService) RequestPasswordReset(ctx context.Context, email string) error {
+	ctx, span := startSpan(ctx, "UserService.RequestPasswordReset")
+	err := t.next.RequestPasswordReset(ctx, email)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedUserService) ResetPassword(ctx context.Context, token string, password string) error {
+	ctx, span := startSpan(ctx, "UserService.ResetPassword")
+	err := t.next.ResetPassword(ctx, token, password)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedUserService) VerifyTwoFactor(ctx context.Context, challengeToken string, code string, client ClientInfo) (string, error) {
+	ctx, span := startSpan(ctx, "UserService.VerifyTwoFactor")
+	token, err := t.next.VerifyTwoFactor(ctx, challengeToken, code, client)
+	endSpan(span, err)
+	return token, err
+}
+
+func (t tracedUserService) EnrollTwoFactor(ctx context.Context, id uuid.UUID) (TwoFactorEnrollment, error) {
+	ctx, span := startSpan(ctx, "UserService.EnrollTwoFactor")
+	enrollment, err := t.next.EnrollTwoFactor(ctx, id)
+	endSpan(span, err)
+	return enrollment, err
+}
+
+func (t tracedUserService) ConfirmTwoFactor(ctx context.Context, id uuid.UUID, code string) ([]string, error) {
+	ctx, span := startSpan(ctx, "UserService.ConfirmTwoFactor")
+	codes, err := t.next.ConfirmTwoFactor(ctx, id, code)
+	endSpan(span, err)
+	return codes, err
+}
+
+func (t tracedUserService) RegenerateRecoveryCodes(ctx context.Context, id uuid.UUID, code string) ([]string, error) {
+	ctx, span := startSpan(ctx, "UserService.RegenerateRecoveryCodes")
+	codes, err := t.next.RegenerateRecoveryCodes(ctx, id, code)
+	endSpan(span, err)
+	return codes, err
+}
+
+func (t tracedUserService) DisableTwoFactor(ctx context.Context, id uuid.UUID, code string) error {
+	ctx, span := startSpan(ctx, "UserService.DisableTwoFactor")
+	err := t.next.DisableTwoFactor(ctx, id, code)
+	endSpan(span, err)
+	return err
+}
+
+type tracedAPIKeyService struct {
+	next APIKeyService
+}
+
+func (t tracedAPIKeyService) GetAPIKeys(ctx context.Context, userID uuid.UUID) ([]model.APIKeyModel, error) {
+	ctx, span := startSpan(ctx, "APIKeyService.GetAPIKeys")
+	keys, err := t.next.GetAPIKeys(ctx, userID)
+	endSpan(span, err)
+	return keys, err
+}
+
+func (t tracedAPIKeyService) CreateAPIKey(ctx context.Context, userID uuid.UUID, name string, scopes []string, expiresAt *time.Time, forTenant bool) (string, model.APIKeyModel, error) {
+	ctx, span := startSpan(ctx, "APIKeyService.CreateAPIKey")
+	key, apiKey, err := t.next.CreateAPIKey(ctx, userID, name, scopes, expiresAt, forTenant)
+	endSpan(span, err)
+	return key, apiKey, err
+}
+
+func (t tracedAPIKeyService) DeleteAPIKey(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	ctx, span := startSpan(ctx, "APIKeyService.DeleteAPIKey")
+	err := t.next.DeleteAPIKey(ctx, userID, id)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedAPIKeyService) AuthenticateAPIKey(ctx context.Context, key string) (model.APIKeyModel, error) {
+	ctx, span := startSpan(ctx, "APIKeyService.AuthenticateAPIKey")
+	apiKey, err := t.next.AuthenticateAPIKey(ctx, key)
+	endSpan(span, err)
+	return apiKey, err
+}
+
+type tracedSessionService struct {
+	next SessionService
+}
+
+func (t tracedSessionService) GetSessions(ctx context.Context, userID uuid.UUID) ([]model.SessionModel, error) {
+	ctx, span := startSpan(ctx, "SessionService.GetSessions")
+	sessions, err := t.next.GetSessions(ctx, userID)
+	endSpan(span, err)
+	return sessions, err
+}
+
+func (t tracedSessionService) RevokeSession(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	ctx, span := startSpan(ctx, "SessionService.RevokeSession")
+	err := t.next.RevokeSession(ctx, userID, id)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedSessionService) ValidateSession(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	ctx, span := startSpan(ctx, "SessionService.ValidateSession")
+	err := t.next.ValidateSession(ctx, userID, id)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedSessionService) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	ctx, span := startSpan(ctx, "SessionService.DeleteExpiredSessions")
+	deleted, err := t.next.DeleteExpiredSessions(ctx)
+	endSpan(span, err)
+	return deleted, err
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/sean-b-martin/dynamic-webforms-server/database"
+	"github.com/sean-b-martin/dynamic-webforms-server/model"
+	"github.com/uptrace/bun"
+	"log/slog"
+	"time"
+)
+
+type TrashItem struct {
+	Type      string     `bun:"type" json:"type"`
+	ID        uuid.UUID  `bun:"id" json:"id"`
+	FormID    uuid.UUID  `bun:"form_id" json:"formID"`
+	SchemaID  *uuid.UUID `bun:"schema_id" json:"schemaID,omitempty"`
+	Title     string     `bun:"title" json:"title"`
+	DeletedAt time.Time  `bun:"deleted_at" json:"deletedAt"`
+	PurgeAt   time.Time  `bun:"-" json:"purgeAt"`
+}
+
+type TrashService interface {
+	GetTrash(ctx context.Context, userID uuid.UUID) ([]TrashItem, error)
+	RestoreForm(ctx context.Context, userID uuid.UUID, formID uuid.UUID) error
+	RestoreSchema(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID) error
+	RestoreSubmission(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, submissionID uuid.UUID) error
+	PurgeTrash(ctx context.Context, deletedBefore time.Time) (int64, error)
+}
+
+type trashServiceImpl struct {
+	db        *bun.DB
+	retention time.Duration
+}
+
+func NewTrashService(db *bun.DB, retention time.Duration) TrashService {
+	return tracedTrashService{next: &trashServiceImpl{db: db, retention: retention}}
+}
+
+// trashQuery lists the soft deleted items of all forms owned by a user. Items deleted together with their parent
+// share its deletion time and are restored with it, so only the parent is listed.
+const trashQuery = `
+SELECT 'form' AS type, f.id, f.id AS form_id, CAST(NULL AS uuid) AS schema_id, f.title, f.deleted_at
+FROM forms AS f
+WHERE f.user_id = ?0 AND f.deleted_at IS NOT NULL
+UNION ALL
+SELECT 'schema', s.id, s.form_id, s.id, s.title, s.deleted_at
+FROM form_schemas AS s
+	JOIN forms AS f ON f.id = s.form_id
+WHERE f.user_id = ?0 AND s.deleted_at IS NOT NULL AND f.deleted_at IS DISTINCT FROM s.deleted_at
+UNION ALL
+SELECT 'submission', d.id, s.form_id, s.id, d.name, d.deleted_at
+FROM form_data AS d
+	JOIN form_schemas AS s ON s.id = d.form_schema_id
+	JOIN forms AS f ON f.id = s.form_id
+WHERE f.user_id = ?0 AND d.deleted_at IS NOT NULL AND s.deleted_at IS DISTINCT FROM d.deleted_at
+ORDER BY deleted_at DESC`
+
+func (t *trashServiceImpl) GetTrash(ctx context.Context, userID uuid.UUID) ([]TrashItem, error) {
+	items := make([]TrashItem, 0)
+	if err := t.db.NewRaw(trashQuery, userID).Scan(ctx, &items); err != nil {
+		return nil, err
+	}
+
+	for i := range items {
+		items[i].PurgeAt = items[i].DeletedAt.Add(t.retention)
+	}
+
+	return items, nil
+}
+
+func (t *trashServiceImpl) RestoreForm(ctx context.Context, userID uuid.UUID, formID uuid.UUID) error {
+	return database.RunInTx(ctx, t.db, func(ctx context.Context, tx bun.Tx) error {
+		var form model.FormModel
+
+		if err := tx.NewSelect().Model(&form).WhereDeleted().Where("id = ?", formID).
+			Scan(ctx); err != nil {
+			return err
+		}
+
+		if form.UserID != userID.String() {
+			return ErrNoPermission
+		}
+
+		if err := restoreDeleted[model.FormModel](ctx, tx, userID, *form.DeletedAt, "id = ?", formID); err != nil {
+			return err
+		}
+
+		if err := restoreDeleted[model.FormSchemaModel](ctx, tx, userID, *form.DeletedAt, "form_id = ?", formID); err != nil {
+			return err
+		}
+
+		return restoreDeleted[model.FormDataModel](ctx, tx, userID, *form.DeletedAt,
+			"form_schema_id IN (SELECT id FROM form_schemas WHERE form_id = ?)", formID)
+	})
+}
+
+func (t *trashServiceImpl) RestoreSchema(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID) error {
+	return database.RunInTx(ctx, t.db, func(ctx context.Context, tx bun.Tx) error {
+		var schema model.FormSchemaModel
+
+		// isFormOwner only finds forms which are not deleted, a schema can not be restored into a deleted form
+		if err := isFormOwner(ctx, tx, formID, userID); err != nil {
+			return err
+		}
+
+		if err := tx.NewSelect().Model(&schema).WhereDeleted().Where("id = ? AND form_id = ?", schemaID, formID).
+			Scan(ctx); err != nil {
+			return err
+		}
+
+		if err := restoreDeleted[model.FormSchemaModel](ctx, tx, userID, *schema.DeletedAt, "id = ?", schemaID); err != nil {
+			return err
+		}
+
+		return restoreDeleted[model.FormDataModel](ctx, tx, userID, *schema.DeletedAt, "form_schema_id = ?", schemaID)
+	})
+}
+
+func (t *trashServiceImpl) RestoreSubmission(ctx context.Context, userID uuid.UUID, formID uuid.UUID, schemaID uuid.UUID, submissionID uuid.UUID) error {
+	return database.RunInTx(ctx, t.db, func(ctx context.Context, tx bun.Tx) error {
+		var submission model.FormDataModel
+
+		if err := isFormOwner(ctx, tx, formID, userID); err != nil {
+			return err
+		}
+
+		if _, err := getSchemaOfForm(ctx, tx, formID, schemaID); err != nil {
+			return err
+		}
+
+		if err := tx.NewSelect().Model(&submission).WhereDeleted().
+			Where("id = ? AND form_schema_id = ?", submissionID, schemaID).Scan(ctx); err != nil {
+			return err
+		}
+
+		return restoreDeleted[model.FormDataModel](ctx, tx, userID, *submission.DeletedAt, "id = ?", submissionID)
+	})
+}
+
+// PurgeTrash permanently deletes all items deleted before the given time, the foreign keys cascade to rows
+// referencing them.
+func (t *trashServiceImpl) PurgeTrash(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var purged int64
+
+	err := database.RunInTx(ctx, t.db, func(ctx context.Context, tx bun.Tx) error {
+		// reset on retries, rows purged by an aborted attempt were rolled back
+		purged = 0
+		for _, m := range []interface{}{(*model.FormModel)(nil), (*model.FormSchemaModel)(nil), (*model.FormDataModel)(nil)} {
+			res, err := tx.NewDelete().Model(m).WhereDeleted().Where("deleted_at < ?", deletedBefore).ForceDelete().
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+
+			rows, _ := res.RowsAffected()
+			purged += rows
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+// PurgeTrashPeriodically purges items which have been in the trash longer than retention every interval until
+// the context is done.
+func PurgeTrashPeriodically(ctx context.Context, logger *slog.Logger, trashService TrashService, retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if purged, err := trashService.PurgeTrash(ctx, time.Now().Add(-retention)); err != nil {
+			logger.ErrorContext(ctx, "failed purging trash", "error", err)
+		} else if purged > 0 {
+			logger.InfoContext(ctx, "purged trash", "items", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// softDeleteTime returns the deletion time shared by an item and its children, it is truncated to the precision
+// of Postgres so it can be compared with the stored value when restoring.
+func softDeleteTime() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func softDelete[T any](ctx context.Context, db bun.IDB, userID uuid.UUID, deletedAt time.Time, whereQuery string, args ...interface{}) (int64, error) {
+	query := db.NewUpdate().Model((*T)(nil)).Set("deleted_at = ?", deletedAt).Set("row_version = row_version + 1").
+		Where(whereQuery, args...)
+	res, err := auditUpdateQuery(query, userID).Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func restoreDeleted[T any](ctx context.Context, db bun.IDB, userID uuid.UUID, deletedAt time.Time, whereQuery string, args ...interface{}) error {
+	query := db.NewUpdate().Model((*T)(nil)).WhereDeleted().Set("deleted_at = NULL").
+		Set("row_version = row_version + 1").Where("deleted_at = ?", deletedAt).Where(whereQuery, args...)
+	_, err := auditUpdateQuery(query, userID).Exec(ctx)
+	return err
+}
@@ -2,96 +2,849 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/sean-b-martin/dynamic-webforms-server/auth"
+	"github.com/sean-b-martin/dynamic-webforms-server/mail"
+	"github.com/sean-b-martin/dynamic-webforms-server/metrics"
 	"github.com/sean-b-martin/dynamic-webforms-server/model"
-	"github.com/uptrace/bun"
-	"github.com/uptrace/bun/driver/pgdriver"
+	"github.com/sean-b-martin/dynamic-webforms-server/validation"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 type UserService interface {
-	RegisterUser(user model.UserModel) error
-	LoginUser(user model.UserModel) (string, error)
-	GetUserById(id uuid.UUID) (model.UserModel, error)
-	UpdateUser(id uuid.UUID, password string) error
-	DeleteUser(id uuid.UUID) error
+	RegisterUser(ctx context.Context, user model.UserModel) error
+	// LoginUser creates a session for client, which the returned access token belongs to.
+	LoginUser(ctx context.Context, user model.UserModel, client ClientInfo) (LoginResult, error)
+	GetUserById(ctx context.Context, id uuid.UUID) (model.UserModel, error)
+	// UpdateUser changes the password of a user and logs out all sessions except sessionID, the session of the
+	// change.
+	UpdateUser(ctx context.Context, id uuid.UUID, sessionID uuid.UUID, password string) error
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+	// UpdateEmail changes the email of a user who confirmed the current password and sends a verification link to
+	// it. Users without a password have to set one first.
+	UpdateEmail(ctx context.Context, id uuid.UUID, password string, email string) error
+	SendEmailVerification(ctx context.Context, id uuid.UUID) error
+	VerifyEmail(ctx context.Context, token string) error
+	// RequestPasswordReset sends a reset link to a verified email. It succeeds for unknown emails as well, so it
+	// does not reveal which emails are registered.
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token string, password string) error
+	// VerifyTwoFactor completes a login with the challenge token returned by LoginUser and a TOTP or recovery code.
+	VerifyTwoFactor(ctx context.Context, challengeToken string, code string, client ClientInfo) (string, error)
+	// EnrollTwoFactor generates a new TOTP secret, which is only required on login once confirmed.
+	EnrollTwoFactor(ctx context.Context, id uuid.UUID) (TwoFactorEnrollment, error)
+	// ConfirmTwoFactor enables two-factor authentication with a TOTP code of the enrolled secret and returns the
+	// recovery codes of the user.
+	ConfirmTwoFactor(ctx context.Context, id uuid.UUID, code string) ([]string, error)
+	// RegenerateRecoveryCodes replaces the recovery codes of a user, the code is a TOTP or recovery code.
+	RegenerateRecoveryCodes(ctx context.Context, id uuid.UUID, code string) ([]string, error)
+	// DisableTwoFactor disables two-factor authentication, the code is a TOTP or recovery code.
+	DisableTwoFactor(ctx context.Context, id uuid.UUID, code string) error
+	// LoginExternal logs in the user linked to an identity verified by an OpenID Connect provider. Unknown
+	// identities are linked to the user with the same verified email or provisioned as new users.
+	LoginExternal(ctx context.Context, identity auth.OIDCIdentity, client ClientInfo) (LoginResult, error)
+}
+
+// LoginResult holds the access token of a login. Users with two-factor authentication get a ChallengeToken
+// instead, which is exchanged together with a code for the access token by VerifyTwoFactor.
+type LoginResult struct {
+	Token          string
+	ChallengeToken string
+}
+
+// ClientInfo describes the client of a login, which is shown in the list of sessions.
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+// TwoFactorEnrollment is a new TOTP secret, the ProvisioningURI is shown as QR code to add the secret to an
+// authenticator app.
+type TwoFactorEnrollment struct {
+	Secret          string
+	ProvisioningURI string
+}
+
+// UserServiceConfig configures the user service. The URLs point to the pages of the frontend the links in the
+// emails open, {token} is replaced with the token.
+type UserServiceConfig struct {
+	Lockout              LockoutPolicy
+	PasswordResetURL     string
+	EmailVerificationURL string
+	// TOTPIssuer is shown by authenticator apps next to the codes.
+	TOTPIssuer string
+}
+
+const (
+	passwordResetTokenTTL     = time.Hour
+	passwordResetSendTimeout  = time.Minute
+	emailVerificationTokenTTL = 48 * time.Hour
+	recoveryCodeCount         = 10
+	// the bounds of the usernames provisioned for external identities match the validation of registrations
+	minUsernameLength           = 3
+	maxUsernameLength           = 32
+	provisionedUsernameAttempts = 5
+	maxUserAgentLength          = 512
+)
+
+// LockoutPolicy locks an account after Threshold failed logins in a row for BaseSeconds, each further failed login
+// doubles the duration up to MaxSeconds. A policy without threshold never locks accounts.
+type LockoutPolicy struct {
+	Threshold   int `json:"threshold" validate:"min=0"`
+	BaseSeconds int `json:"baseSeconds" validate:"min=0"`
+	MaxSeconds  int `json:"maxSeconds" validate:"min=0"`
+}
+
+// lockDuration returns how long an account is locked after the given number of failed logins in a row.
+func (p LockoutPolicy) lockDuration(failedLogins int) time.Duration {
+	if p.Threshold <= 0 || failedLogins < p.Threshold {
+		return 0
+	}
+
+	duration := time.Duration(p.BaseSeconds) * time.Second
+	maxDuration := time.Duration(p.MaxSeconds) * time.Second
+	for i := p.Threshold; i < failedLogins && duration < maxDuration; i++ {
+		duration *= 2
+	}
+
+	return min(duration, maxDuration)
 }
 
 type userServiceImpl struct {
-	db              *bun.DB
-	dbService       GenericDBService[model.UserModel]
+	store           Store
 	passwordService *auth.PasswordService
+	passwordPolicy  *auth.PasswordPolicy
 	jwtService      *auth.JWTService
+	mailer          mail.Sender
+	totp            *auth.TOTP
+	config          UserServiceConfig
 }
 
-func NewUserService(db *bun.DB, passwordService *auth.PasswordService, jwtService *auth.JWTService) UserService {
-	return &userServiceImpl{
-		db:              db,
-		dbService:       NewGenericDBService[model.UserModel](db),
+func NewUserService(store Store, passwordService *auth.PasswordService, passwordPolicy *auth.PasswordPolicy, jwtService *auth.JWTService, mailer mail.Sender, config UserServiceConfig) UserService {
+	return tracedUserService{next: &userServiceImpl{
+		store:           store,
 		passwordService: passwordService,
+		passwordPolicy:  passwordPolicy,
 		jwtService:      jwtService,
+		mailer:          mailer,
+		totp:            auth.NewTOTP(config.TOTPIssuer),
+		config:          config,
+	}}
+}
+
+func (s *userServiceImpl) GetUserById(ctx context.Context, id uuid.UUID) (model.UserModel, error) {
+	return s.store.Repositories().Users.GetUserByID(ctx, id)
+}
+
+func (s *userServiceImpl) RegisterUser(ctx context.Context, user model.UserModel) error {
+	if err := s.checkPasswordPolicy(user.Username, user.Password); err != nil {
+		return err
+	}
+
+	var err error
+	user.Password, err = s.passwordService.HashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+
+	user.Email = normalizeEmail(user.Email)
+	user, err = s.store.Repositories().Users.InsertUser(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	// the user is registered anyway, the verification can be requested again
+	if user.Email != "" {
+		if err := s.sendEmailVerification(ctx, user); err != nil {
+			slog.WarnContext(ctx, "failed sending email verification", slog.Any("error", err))
+		}
 	}
+
+	return nil
 }
 
-func (s *userServiceImpl) GetUserByUsername(username string) (model.UserModel, error) {
-	var user model.UserModel
-	err := s.db.NewSelect().Model(&user).Column("id", "username", "password").
-		Where("username = ?", username).Scan(context.Background())
+func (s *userServiceImpl) LoginUser(ctx context.Context, user model.UserModel, client ClientInfo) (LoginResult, error) {
+	dbUser, err := s.store.Repositories().Users.GetUserByUsername(ctx, user.Username)
+	if errors.Is(err, sql.ErrNoRows) {
+		// a password is verified on all paths, so the response time does not reveal whether the username exists
+		s.passwordService.VerifyDummy(user.Password)
+		metrics.FailedLogins.Inc()
+		return LoginResult{}, ErrInvalidCredentials
+	} else if err != nil {
+		return LoginResult{}, err
+	}
+
+	// locked accounts are rejected like invalid credentials, which does not reveal that the username exists
+	now := time.Now().UTC()
+	if dbUser.LockedUntil != nil && now.Before(*dbUser.LockedUntil) {
+		s.passwordService.VerifyDummy(user.Password)
+		metrics.FailedLogins.Inc()
+		return LoginResult{}, ErrInvalidCredentials
+	}
+
+	if err := s.passwordService.VerifyPassword(dbUser.Password, user.Password); err != nil {
+		metrics.FailedLogins.Inc()
+		if err := s.recordFailedLogin(ctx, dbUser.ID, now); err != nil {
+			return LoginResult{}, err
+		}
+		return LoginResult{}, ErrInvalidCredentials
+	}
+
+	// the password is only known on login, so hashes of previous algorithms or parameters are replaced now
+	if s.passwordService.NeedsRehash(dbUser.Password) {
+		if err := s.rehashPassword(ctx, dbUser, user.Password); err != nil {
+			slog.WarnContext(ctx, "failed rehashing password", slog.Any("error", err))
+		}
+	}
+
+	return s.firstFactorLogin(ctx, dbUser, client)
+}
+
+// firstFactorLogin returns the access token of a user who proved the first factor, or a challenge token if the user
+// has to prove the second factor as well.
+func (s *userServiceImpl) firstFactorLogin(ctx context.Context, user model.UserModel, client ClientInfo) (LoginResult, error) {
+	// the failed logins are only reset after the second factor, the first factor alone must not allow guessing codes
+	// without limit
+	if user.TOTPEnabledAt != nil {
+		challenge, err := s.jwtService.NewChallengeToken(user.ID)
+		if err != nil {
+			return LoginResult{}, err
+		}
+
+		return LoginResult{ChallengeToken: challenge}, nil
+	}
+
+	token, err := s.completeLogin(ctx, user, client)
+	return LoginResult{Token: token}, err
+}
+
+// completeLogin resets the failed logins of a user who proved all factors and returns the access token of a new
+// session.
+func (s *userServiceImpl) completeLogin(ctx context.Context, user model.UserModel, client ClientInfo) (string, error) {
+	if user.FailedLogins > 0 || user.LockedUntil != nil {
+		user.FailedLogins = 0
+		user.LockedUntil = nil
+		if err := s.store.Repositories().Users.UpdateUser(ctx, user.ID, user, "failed_logins",
+			"locked_until"); err != nil {
+			return "", err
+		}
+	}
+
+	now := time.Now().UTC()
+	session, err := s.store.Repositories().Sessions.InsertSession(ctx, model.SessionModel{UserID: user.ID,
+		UserAgent: truncate(client.UserAgent, maxUserAgentLength), IP: client.IP, LastSeenAt: now,
+		ExpiresAt: now.Add(s.jwtService.Expiry())})
 	if err != nil {
-		return user, err
+		return "", err
 	}
 
-	return user, nil
+	// logins are not restricted by scopes, unlike API keys
+	token, err := s.jwtService.NewToken(user.ID, session.ID, auth.TokenGrants{Roles: user.Roles,
+		Scopes: auth.Scopes, Tenant: user.Tenant})
+	if err != nil {
+		return "", err
+	}
+
+	metrics.Logins.Inc()
+	return token, nil
+}
+
+func (s *userServiceImpl) rehashPassword(ctx context.Context, user model.UserModel, password string) error {
+	hash, err := s.passwordService.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	user.Password = hash
+	return s.store.Repositories().Users.UpdateUser(ctx, user.ID, user, "password")
 }
 
-func (s *userServiceImpl) GetUserById(id uuid.UUID) (model.UserModel, error) {
-	return s.dbService.GetModelByID(id)
+// checkPasswordPolicy returns a validation error listing the violated rules of the password policy as failed
+// constraints of the password field. The password is never sent back.
+func (s *userServiceImpl) checkPasswordPolicy(username, password string) error {
+	err := s.passwordPolicy.Check(username, password)
+	var policyErr *auth.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return err
+	}
+
+	fields := make([]validation.ErrorResponse, len(policyErr.Violations))
+	for i, violation := range policyErr.Violations {
+		fields[i] = validation.ErrorResponse{
+			Field:  "password",
+			Failed: validation.ErrorFailedConstraint{Constraint: violation.Rule, Configuration: violation.Param},
+		}
+	}
+
+	return &Error{Kind: KindValidation, Code: "password_policy_violated", Message: policyErr.Error(), Fields: fields}
 }
 
-func (s *userServiceImpl) RegisterUser(user model.UserModel) error {
-	var err error
+// recordFailedLogin counts a failed login of the user and locks the account once the lockout policy applies.
+func (s *userServiceImpl) recordFailedLogin(ctx context.Context, userID uuid.UUID, now time.Time) error {
+	failedLogins, err := s.store.Repositories().Users.IncrementFailedLogins(ctx, userID)
+	if err != nil {
+		return err
+	}
 
-	user.Password, err = s.passwordService.HashPassword(user.Password)
+	if duration := s.config.Lockout.lockDuration(failedLogins); duration > 0 {
+		return s.store.Repositories().Users.LockUser(ctx, userID, failedLogins, now.Add(duration))
+	}
+
+	return nil
+}
+
+func (s *userServiceImpl) UpdateUser(ctx context.Context, id uuid.UUID, sessionID uuid.UUID, password string) error {
+	user, err := s.store.Repositories().Users.GetUserByID(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	if err = s.dbService.InsertModel(user, "username", "password"); err != nil {
-		var pgErr pgdriver.Error
-		if errors.As(err, &pgErr) {
-			if pgErr.IntegrityViolation() {
-				return errors.New("username already exists")
-			}
+	if err := s.checkPasswordPolicy(user.Username, password); err != nil {
+		return err
+	}
+
+	user.Password, err = s.passwordService.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return s.store.RunInTx(ctx, func(ctx context.Context, repos Repositories) error {
+		if err := repos.Users.UpdateUser(ctx, id, user, "password"); err != nil {
+			return err
+		}
+
+		// like a reset, whoever knew the previous password is logged out
+		return repos.Sessions.DeleteSessionsOfUser(ctx, id, sessionID)
+	})
+}
+
+func (s *userServiceImpl) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	return s.store.Repositories().Users.DeleteUser(ctx, id)
+}
+
+func (s *userServiceImpl) UpdateEmail(ctx context.Context, id uuid.UUID, password string, email string) error {
+	user, err := s.store.Repositories().Users.GetUserByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// the email receives the password reset links, so whoever holds a token of the user must not be able to take
+	// over the account by changing it. Wrong passwords count like failed logins.
+	if err := s.passwordService.VerifyPassword(user.Password, password); err != nil {
+		if err := s.recordFailedLogin(ctx, id, time.Now().UTC()); err != nil {
+			return err
 		}
-		return errors.New("error creating user")
+		return ErrWrongPassword
+	}
+
+	email = normalizeEmail(email)
+	if user.Email == email {
+		return nil
+	}
+
+	user.Email = email
+	user.EmailVerifiedAt = nil
+	if err := s.store.RunInTx(ctx, func(ctx context.Context, repos Repositories) error {
+		if err := repos.Users.UpdateUser(ctx, id, user, "email", "email_verified_at"); err != nil {
+			return err
+		}
+
+		// reset links sent to the previous email must not work anymore
+		return repos.Tokens.DeleteTokensOfUser(ctx, id, model.TokenPurposePasswordReset)
+	}); err != nil {
+		return err
+	}
+
+	if err := s.sendEmailVerification(ctx, user); err != nil {
+		slog.WarnContext(ctx, "failed sending email verification", slog.Any("error", err))
 	}
+
 	return nil
 }
 
-func (s *userServiceImpl) LoginUser(user model.UserModel) (string, error) {
-	dbUser, err := s.GetUserByUsername(user.Username)
+func (s *userServiceImpl) SendEmailVerification(ctx context.Context, id uuid.UUID) error {
+	user, err := s.store.Repositories().Users.GetUserByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if user.Email == "" {
+		return ErrNoEmail
+	}
+
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailVerified
+	}
+
+	return s.sendEmailVerification(ctx, user)
+}
+
+func (s *userServiceImpl) sendEmailVerification(ctx context.Context, user model.UserModel) error {
+	token, err := s.newUserToken(ctx, user, model.TokenPurposeEmailVerification, emailVerificationTokenTTL)
 	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hello %s,\n\nplease verify your email by opening the following link within 48 hours:\n\n%s\n\n"+
+			"If you did not add this email to an account, you can ignore this message.\n",
+			user.Username, tokenURL(s.config.EmailVerificationURL, token)),
+	})
+}
+
+func (s *userServiceImpl) VerifyEmail(ctx context.Context, token string) error {
+	return s.store.RunInTx(ctx, func(ctx context.Context, repos Repositories) error {
+		now := time.Now().UTC()
+		user, err := consumeUserToken(ctx, repos, model.TokenPurposeEmailVerification, token, now)
+		if err != nil {
+			return err
+		}
+
+		user.EmailVerifiedAt = &now
+		return repos.Users.UpdateUser(ctx, user.ID, user, "email_verified_at")
+	})
+}
+
+func (s *userServiceImpl) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.store.Repositories().Users.GetUserByEmail(ctx, normalizeEmail(email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// links are only sent to emails proven to belong to the user
+	if user.EmailVerifiedAt == nil {
+		return nil
+	}
+
+	// the link is sent in the background, so the response time does not reveal whether the email belongs to a user
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), passwordResetSendTimeout)
+		defer cancel()
+		if err := s.sendPasswordReset(ctx, user); err != nil {
+			slog.ErrorContext(ctx, "failed sending password reset", slog.Any("error", err))
+		}
+	}()
+
+	return nil
+}
+
+func (s *userServiceImpl) sendPasswordReset(ctx context.Context, user model.UserModel) error {
+	token, err := s.newUserToken(ctx, user, model.TokenPurposePasswordReset, passwordResetTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nyou can set a new password by opening the following link within one hour:"+
+			"\n\n%s\n\nIf you did not request a password reset, you can ignore this message.\n",
+			user.Username, tokenURL(s.config.PasswordResetURL, token)),
+	})
+}
+
+// ResetPassword keeps the token valid if the password violates the password policy.
+func (s *userServiceImpl) ResetPassword(ctx context.Context, token string, password string) error {
+	return s.store.RunInTx(ctx, func(ctx context.Context, repos Repositories) error {
+		user, err := consumeUserToken(ctx, repos, model.TokenPurposePasswordReset, token, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+
+		if err := s.checkPasswordPolicy(user.Username, password); err != nil {
+			return err
+		}
+
+		user.Password, err = s.passwordService.HashPassword(password)
+		if err != nil {
+			return err
+		}
+
+		// the owner of the account is known now, so a lock caused by someone guessing the password is lifted
+		user.FailedLogins = 0
+		user.LockedUntil = nil
+		if err := repos.Users.UpdateUser(ctx, user.ID, user, "password", "failed_logins", "locked_until"); err != nil {
+			return err
+		}
+
+		if err := repos.Tokens.DeleteTokensOfUser(ctx, user.ID, model.TokenPurposePasswordReset); err != nil {
+			return err
+		}
+
+		// whoever knew the previous password is logged out
+		return repos.Sessions.DeleteSessionsOfUser(ctx, user.ID, uuid.Nil)
+	})
+}
+
+// newUserToken creates a token of the purpose for the current email of user. Earlier tokens of the purpose are
+// deleted, so only the link of the latest email works.
+func (s *userServiceImpl) newUserToken(ctx context.Context, user model.UserModel, purpose string, ttl time.Duration) (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
 		return "", err
 	}
+	token := base64.RawURLEncoding.EncodeToString(data)
 
-	if err := s.passwordService.VerifyPassword(dbUser.Password, user.Password); err != nil {
-		return "", errors.New("invalid password")
+	err := s.store.RunInTx(ctx, func(ctx context.Context, repos Repositories) error {
+		if err := repos.Tokens.DeleteTokensOfUser(ctx, user.ID, purpose); err != nil {
+			return err
+		}
+
+		_, err := repos.Tokens.InsertToken(ctx, model.UserTokenModel{
+			UserID:    user.ID,
+			Purpose:   purpose,
+			TokenHash: hashToken(token),
+			Email:     user.Email,
+			ExpiresAt: time.Now().UTC().Add(ttl),
+		})
+		return err
+	})
+
+	return token, err
+}
+
+// consumeUserToken returns the user a token was sent to. It returns ErrInvalidToken if the token does not exist,
+// expired, was used already or the email of the user changed since it was sent.
+func consumeUserToken(ctx context.Context, repos Repositories, purpose string, token string, now time.Time) (model.UserModel, error) {
+	userToken, err := repos.Tokens.ConsumeToken(ctx, purpose, hashToken(token), now)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.UserModel{}, ErrInvalidToken
+	} else if err != nil {
+		return model.UserModel{}, err
+	}
+
+	user, err := repos.Users.GetUserByID(ctx, userToken.UserID)
+	if err != nil {
+		return user, err
+	}
+
+	if user.Email != userToken.Email {
+		return user, ErrInvalidToken
+	}
+
+	return user, nil
+}
+
+func (s *userServiceImpl) VerifyTwoFactor(ctx context.Context, challengeToken string, code string, client ClientInfo) (string, error) {
+	claims, err := s.jwtService.ValidateChallengeToken(challengeToken)
+	if err != nil {
+		return "", ErrInvalidChallenge
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return "", ErrInvalidChallenge
+	}
+
+	user, err := s.verifySecondFactor(ctx, userID, code, true,
+		func(ctx context.Context, repos Repositories, user model.UserModel) error {
+			if user.TOTPEnabledAt == nil {
+				return ErrInvalidChallenge
+			}
+			return nil
+		})
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, ErrTwoFactorNotEnabled) {
+		return "", ErrInvalidChallenge
+	} else if err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) || errors.Is(err, ErrAccountLocked) {
+			metrics.FailedLogins.Inc()
+		}
+		return "", err
 	}
 
-	return s.jwtService.NewToken(dbUser.ID)
+	return s.completeLogin(ctx, user, client)
 }
 
-func (s *userServiceImpl) UpdateUser(id uuid.UUID, password string) error {
-	hash, err := s.passwordService.HashPassword(password)
+func (s *userServiceImpl) EnrollTwoFactor(ctx context.Context, id uuid.UUID) (TwoFactorEnrollment, error) {
+	user, err := s.store.Repositories().Users.GetUserByID(ctx, id)
+	if err != nil {
+		return TwoFactorEnrollment{}, err
+	}
+
+	if user.TOTPEnabledAt != nil {
+		return TwoFactorEnrollment{}, ErrTwoFactorEnabled
+	}
+
+	user.TOTPSecret, err = s.totp.GenerateSecret()
 	if err != nil {
+		return TwoFactorEnrollment{}, err
+	}
+
+	if err := s.store.Repositories().Users.UpdateUser(ctx, id, user, "totp_secret"); err != nil {
+		return TwoFactorEnrollment{}, err
+	}
+
+	return TwoFactorEnrollment{
+		Secret:          user.TOTPSecret,
+		ProvisioningURI: s.totp.ProvisioningURI(user.TOTPSecret, user.Username),
+	}, nil
+}
+
+func (s *userServiceImpl) ConfirmTwoFactor(ctx context.Context, id uuid.UUID, code string) ([]string, error) {
+	var codes []string
+	_, err := s.verifySecondFactor(ctx, id, code, false,
+		func(ctx context.Context, repos Repositories, user model.UserModel) error {
+			if user.TOTPEnabledAt != nil {
+				return ErrTwoFactorEnabled
+			}
+
+			now := time.Now().UTC()
+			user.TOTPEnabledAt = &now
+			if err := repos.Users.UpdateUser(ctx, id, user, "totp_enabled_at"); err != nil {
+				return err
+			}
+
+			var err error
+			codes, err = replaceRecoveryCodes(ctx, repos, id)
+			return err
+		})
+
+	return codes, err
+}
+
+func (s *userServiceImpl) RegenerateRecoveryCodes(ctx context.Context, id uuid.UUID, code string) ([]string, error) {
+	var codes []string
+	_, err := s.verifySecondFactor(ctx, id, code, true,
+		func(ctx context.Context, repos Repositories, user model.UserModel) error {
+			if user.TOTPEnabledAt == nil {
+				return ErrTwoFactorNotEnabled
+			}
+
+			var err error
+			codes, err = replaceRecoveryCodes(ctx, repos, id)
+			return err
+		})
+
+	return codes, err
+}
+
+func (s *userServiceImpl) DisableTwoFactor(ctx context.Context, id uuid.UUID, code string) error {
+	_, err := s.verifySecondFactor(ctx, id, code, true,
+		func(ctx context.Context, repos Repositories, user model.UserModel) error {
+			if user.TOTPEnabledAt == nil {
+				return ErrTwoFactorNotEnabled
+			}
+
+			user.TOTPSecret = ""
+			user.TOTPEnabledAt = nil
+			user.TOTPLastStep = 0
+			if err := repos.Users.UpdateUser(ctx, id, user, "totp_secret", "totp_enabled_at",
+				"totp_last_step"); err != nil {
+				return err
+			}
+
+			return repos.RecoveryCodes.ReplaceRecoveryCodes(ctx, id, nil)
+		})
+
+	return err
+}
+
+// verifySecondFactor runs fn in a transaction once code was verified as TOTP code or, if recoveryCodes is set, as
+// recovery code of the user. Wrong codes count as failed logins, so guessing codes locks the account like guessing
+// passwords.
+func (s *userServiceImpl) verifySecondFactor(ctx context.Context, userID uuid.UUID, code string, recoveryCodes bool, fn func(ctx context.Context, repos Repositories, user model.UserModel) error) (model.UserModel, error) {
+	now := time.Now().UTC()
+	var user model.UserModel
+	err := s.store.RunInTx(ctx, func(ctx context.Context, repos Repositories) error {
+		var err error
+		if user, err = repos.Users.GetUserByID(ctx, userID); err != nil {
+			return err
+		}
+
+		if user.LockedUntil != nil && now.Before(*user.LockedUntil) {
+			return ErrAccountLocked
+		}
+
+		if user.TOTPSecret == "" {
+			return ErrTwoFactorNotEnabled
+		}
+
+		// codes are only accepted once, even within the time they are valid
+		if step, ok := s.totp.Validate(user.TOTPSecret, strings.ReplaceAll(code, " ", ""), now); ok &&
+			step > user.TOTPLastStep {
+			user.TOTPLastStep = step
+			if err := repos.Users.UpdateUser(ctx, userID, user, "totp_last_step"); err != nil {
+				return err
+			}
+		} else if !recoveryCodes {
+			return ErrInvalidTwoFactorCode
+		} else if err := repos.RecoveryCodes.ConsumeRecoveryCode(ctx, userID,
+			hashRecoveryCode(code)); errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidTwoFactorCode
+		} else if err != nil {
+			return err
+		}
+
+		return fn(ctx, repos, user)
+	})
+
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		if err := s.recordFailedLogin(ctx, userID, now); err != nil {
+			return user, err
+		}
+	}
+
+	return user, err
+}
+
+func (s *userServiceImpl) LoginExternal(ctx context.Context, identity auth.OIDCIdentity, client ClientInfo) (LoginResult, error) {
+	var user model.UserModel
+	err := s.store.RunInTx(ctx, func(ctx context.Context, repos Repositories) error {
+		linked, err := repos.Identities.GetIdentity(ctx, identity.Issuer, identity.Subject)
+		if err == nil {
+			user, err = repos.Users.GetUserByID(ctx, linked.UserID)
+			return err
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		user, err = findOrProvisionUser(ctx, repos, identity)
+		if err != nil {
+			return err
+		}
+
+		_, err = repos.Identities.InsertIdentity(ctx, model.UserIdentityModel{UserID: user.ID, Issuer: identity.Issuer,
+			Subject: identity.Subject})
 		return err
+	})
+	if err != nil {
+		if errors.Is(err, ErrIdentityNotLinked) {
+			metrics.FailedLogins.Inc()
+		}
+		return LoginResult{}, err
 	}
 
-	user := model.UserModel{Password: hash}
-	return s.dbService.UpdateModel(user, id, "password")
+	return s.firstFactorLogin(ctx, user, client)
+}
+
+// findOrProvisionUser returns the user an identity is linked to on its first login. Identities are only linked to
+// users by emails both the provider and the user verified, otherwise whoever registers the email first could take
+// over the account.
+func findOrProvisionUser(ctx context.Context, repos Repositories, identity auth.OIDCIdentity) (model.UserModel, error) {
+	email := ""
+	if identity.EmailVerified {
+		email = normalizeEmail(identity.Email)
+	}
+
+	if email != "" {
+		user, err := repos.Users.GetUserByEmail(ctx, email)
+		if err == nil {
+			if user.EmailVerifiedAt == nil {
+				return model.UserModel{}, ErrIdentityNotLinked
+			}
+			return user, nil
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return model.UserModel{}, err
+		}
+	}
+
+	username, err := availableUsername(ctx, repos, identity)
+	if err != nil {
+		return model.UserModel{}, err
+	}
+
+	// provisioned users have no password and log in with the provider until they set one
+	user, err := repos.Users.InsertUser(ctx, model.UserModel{Username: username, Password: auth.NoPassword,
+		Email: email})
+	if err != nil || email == "" {
+		return user, err
+	}
+
+	// the provider verified the email already
+	verifiedAt := time.Now().UTC()
+	user.EmailVerifiedAt = &verifiedAt
+	return user, repos.Users.UpdateUser(ctx, user.ID, user, "email_verified_at")
+}
+
+// availableUsername derives a username from the preferred username or the email of an identity and appends a random
+// suffix if the username is taken.
+func availableUsername(ctx context.Context, repos Repositories, identity auth.OIDCIdentity) (string, error) {
+	base := strings.TrimSpace(identity.PreferredUsername)
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	if len(base) < minUsernameLength {
+		base = "user"
+	}
+	base = truncate(base, maxUsernameLength)
+
+	username := base
+	for range provisionedUsernameAttempts {
+		if _, err := repos.Users.GetUserByUsername(ctx, username); errors.Is(err, sql.ErrNoRows) {
+			return username, nil
+		} else if err != nil {
+			return "", err
+		}
+
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", err
+		}
+		username = truncate(base, maxUsernameLength-7) + "-" + hex.EncodeToString(suffix)
+	}
+
+	return "", ErrUsernameExists
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// replaceRecoveryCodes generates new recovery codes for a user, e.g. 7kq2m-xw4pa.
+func replaceRecoveryCodes(ctx context.Context, repos Repositories, userID uuid.UUID) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		data := make([]byte, 8)
+		if _, err := rand.Read(data); err != nil {
+			return nil, err
+		}
+
+		encoded := strings.ToLower(base32.StdEncoding.EncodeToString(data))
+		codes[i] = encoded[:5] + "-" + encoded[5:10]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	return codes, repos.RecoveryCodes.ReplaceRecoveryCodes(ctx, userID, hashes)
+}
+
+// hashRecoveryCode ignores the case and separators of a recovery code, as users type them.
+func hashRecoveryCode(code string) string {
+	code = strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	return hashToken(code)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func tokenURL(url string, token string) string {
+	return strings.ReplaceAll(url, "{token}", token)
 }
 
-func (s *userServiceImpl) DeleteUser(id uuid.UUID) error {
-	return s.dbService.DeleteModelByID(id)
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
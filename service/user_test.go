@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"github.com/sean-b-martin/dynamic-webforms-server/auth"
+	"github.com/sean-b-martin/dynamic-webforms-server/database"
+	"github.com/sean-b-martin/dynamic-webforms-server/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUserService_LoginLockoutSQLite(t *testing.T) {
+	db, err := database.CreateDatabaseConnection(database.ConnectionConfig{Driver: database.DriverSQLite,
+		Path: filepath.Join(t.TempDir(), "forms.db")})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	database.CreateTables(db)
+
+	hasher, err := auth.NewBcryptHasher(bcrypt.MinCost)
+	require.NoError(t, err)
+	passwordService, err := auth.NewPasswordService(hasher)
+	require.NoError(t, err)
+	jwtService, err := auth.NewJWTService()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	store := NewDBStore(db)
+	hash, err := passwordService.HashPassword("correct-password")
+	require.NoError(t, err)
+	user, err := store.Repositories().Users.InsertUser(ctx, model.UserModel{Username: "alice", Password: hash})
+	require.NoError(t, err)
+
+	// the lock applies with the last attempt, as locked accounts do not count further attempts
+	const attempts = 8
+	users := NewUserService(store, passwordService, nil, jwtService, nil, UserServiceConfig{
+		Lockout: LockoutPolicy{Threshold: attempts, BaseSeconds: 60, MaxSeconds: 600},
+	})
+
+	// concurrent wrong passwords must all be counted
+	var wg sync.WaitGroup
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := users.LoginUser(ctx, model.UserModel{Username: "alice", Password: "wrong-password"}, ClientInfo{})
+			assert.ErrorIs(t, err, ErrInvalidCredentials)
+		}()
+	}
+	wg.Wait()
+
+	dbUser, err := store.Repositories().Users.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, attempts, dbUser.FailedLogins)
+	require.NotNil(t, dbUser.LockedUntil)
+
+	// the correct password is rejected like a wrong one while the account is locked
+	_, err = users.LoginUser(ctx, model.UserModel{Username: "alice", Password: "correct-password"}, ClientInfo{})
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestUserRepository_VerifiedEmailUniqueSQLite(t *testing.T) {
+	ctx := context.Background()
+	users := NewDBStore(newTestSQLite(t)).Repositories().Users
+
+	alice, err := users.InsertUser(ctx, model.UserModel{Username: "alice", Password: "hash", Email: "shared@example.com"})
+	require.NoError(t, err)
+	bob, err := users.InsertUser(ctx, model.UserModel{Username: "bob", Password: "hash", Email: "shared@example.com"})
+	require.NoError(t, err)
+
+	verifiedAt := time.Now().UTC()
+	bob.EmailVerifiedAt = &verifiedAt
+	require.NoError(t, users.UpdateUser(ctx, bob.ID, bob, "email_verified_at"))
+
+	// the user who verified the email is found by it
+	user, err := users.GetUserByEmail(ctx, "shared@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, bob.ID, user.ID)
+
+	alice.EmailVerifiedAt = &verifiedAt
+	assert.ErrorIs(t, users.UpdateUser(ctx, alice.ID, alice, "email_verified_at"), ErrEmailExists)
+}
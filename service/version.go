@@ -0,0 +1,38 @@
+package service
+
+import (
+	"github.com/sean-b-martin/dynamic-webforms-server/model"
+	"github.com/uptrace/bun"
+)
+
+// AnyRowVersion skips the row version check of an update or delete, e.g. for requests with If-Match: *.
+const AnyRowVersion int64 = 0
+
+// checkRowVersion compares the current row version of a row with the version expected by the client.
+func checkRowVersion(current int64, expected int64) error {
+	if expected != AnyRowVersion && current != expected {
+		return ErrVersionMismatch
+	}
+
+	return nil
+}
+
+// applyRowVersion restricts a model update of a versioned model to the row version stored in the model and
+// increments it. It returns the columns to update and whether the model is versioned.
+func applyRowVersion(query *bun.UpdateQuery, value interface{}, columns []string) ([]string, bool) {
+	versioned, ok := value.(model.Versioned)
+	if !ok {
+		return columns, false
+	}
+
+	if version := versioned.GetRowVersion(); version != AnyRowVersion {
+		query.Where("row_version = ?", version)
+	}
+
+	query.Value("row_version", "row_version + 1")
+	if len(columns) == 0 {
+		return columns, true
+	}
+
+	return append(columns, "row_version"), true
+}